@@ -0,0 +1,174 @@
+package goreplay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkpointInterval is how often the positions of the inputs are written to their checkpoint
+const checkpointInterval = time.Second
+
+// checkpointPosition is the position of a reader of an input, a replay resumes from it
+type checkpointPosition struct {
+	Offset    int64 `json:"offset"`              // offset of the next record of a file, or of the next message of a Kafka partition
+	Record    int64 `json:"record,omitempty"`    // number of the next record of a file
+	Timestamp int64 `json:"timestamp,omitempty"` // timestamp of the last record replayed
+}
+
+// checkpoint persists the positions of the readers of the inputs, by file or Kafka partition,
+// so a replay which was stopped or crashed resumes where it was. The inputs given the same path share it.
+// The records read by PluginRead are replayed, the position only moves past them.
+type checkpoint struct {
+	mu        sync.Mutex
+	path      string
+	refs      int
+	positions map[string]checkpointPosition
+	dirty     bool
+	done      chan struct{}
+}
+
+var (
+	checkpointsMu sync.Mutex
+	checkpoints   = make(map[string]*checkpoint)
+)
+
+// openCheckpoint loads the checkpoint at path, it is empty if the file does not exist
+func openCheckpoint(path string) (*checkpoint, error) {
+	checkpointsMu.Lock()
+	defer checkpointsMu.Unlock()
+
+	if c, ok := checkpoints[path]; ok {
+		c.refs++
+		return c, nil
+	}
+
+	c := &checkpoint{path: path, refs: 1, positions: make(map[string]checkpointPosition), done: make(chan struct{})}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &c.positions); err != nil {
+			return nil, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+		}
+	}
+
+	checkpoints[path] = c
+	go c.loop()
+	return c, nil
+}
+
+func (c *checkpoint) loop() {
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.save(); err != nil {
+				Debug(1, fmt.Sprintf("[CHECKPOINT] can't write %s: %s", c.path, err))
+			}
+		}
+	}
+}
+
+// position returns the position of a reader
+func (c *checkpoint) position(key string) (pos checkpointPosition, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pos, ok = c.positions[key]
+	return
+}
+
+// set moves the position of a reader
+func (c *checkpoint) set(key string, pos checkpointPosition) {
+	c.mu.Lock()
+	c.positions[key] = pos
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+// remove forgets the readers which replayed all their records, the next replay starts from their beginning
+func (c *checkpoint) remove(keys ...string) {
+	c.mu.Lock()
+	for _, key := range keys {
+		delete(c.positions, key)
+	}
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+// save writes the positions if they moved, the file is replaced so a crash does not leave it half written.
+// The file is removed when there are no positions left.
+func (c *checkpoint) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+	c.dirty = false
+
+	if len(c.positions) == 0 {
+		if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(c.positions)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// close writes the positions, the checkpoint stops when all the inputs sharing it are closed
+func (c *checkpoint) close() error {
+	checkpointsMu.Lock()
+	c.refs--
+	if c.refs == 0 {
+		delete(checkpoints, c.path)
+		close(c.done)
+	}
+	checkpointsMu.Unlock()
+
+	return c.save()
+}
+
+// resume moves the reader to the position of a checkpoint and reports if it was seeked.
+// Local recordings are seeked to its offset, the records before it are skipped in the gzipped and S3 ones.
+func (f *fileInputReader) resume(pos checkpointPosition) bool {
+	file, ok := f.file.(*os.File)
+	if !ok || strings.HasSuffix(f.path, ".gz") || pos.Offset == 0 {
+		f.rng.skip = max(f.rng.skip, pos.Record)
+		return false
+	}
+
+	binary := isBinaryRecording(f.reader)
+	if _, err := file.Seek(pos.Offset, io.SeekStart); err != nil {
+		Debug(1, fmt.Sprintf("[INPUT-FILE] can't resume %s: %s", f.path, err))
+		file.Seek(0, io.SeekStart)
+		f.reader.Reset(file)
+		return false
+	}
+	f.reader.Reset(file)
+
+	f.offset, f.record = pos.Offset, pos.Record
+	if binary {
+		f.records = &recordReader{r: f.reader, offset: pos.Offset, record: pos.Record}
+	}
+	return true
+}
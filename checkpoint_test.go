@@ -0,0 +1,136 @@
+package goreplay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.checkpoint")
+
+	c, err := openCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shared, _ := openCheckpoint(path); shared != c {
+		t.Error("expected the inputs to share the checkpoint of the same path")
+	}
+	c.set("a.gor", checkpointPosition{Offset: 100, Record: 2, Timestamp: 1000})
+	c.set("b.gor", checkpointPosition{Offset: 200, Record: 4, Timestamp: 2000})
+	c.close()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected the checkpoint to be written by close: %v", err)
+	}
+	c.close()
+
+	c, err = openCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos, ok := c.position("b.gor"); !ok || pos != (checkpointPosition{Offset: 200, Record: 4, Timestamp: 2000}) {
+		t.Errorf("expected the position of b.gor to be loaded, got %+v %v", pos, ok)
+	}
+	c.remove("a.gor", "b.gor")
+	c.close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected an empty checkpoint to be removed, got %v", err)
+	}
+
+	os.WriteFile(path, []byte("{"), 0644)
+	if _, err := openCheckpoint(path); err == nil {
+		t.Error("expected an error for an invalid checkpoint")
+	}
+}
+
+func TestInputFileCheckpoint(t *testing.T) {
+	msgs := testRecords(20, 10)
+	var text, gz bytes.Buffer
+	for _, msg := range msgs {
+		writeTextRecord(&text, msg)
+	}
+	binary := writeRecording(t, msgs, true)
+	w := gzip.NewWriter(&gz)
+	w.Write(binary)
+	w.Close()
+
+	recordings := map[string][]byte{
+		"requests.gor":     binary,
+		"requests.txt.gor": text.Bytes(),
+		"requests.gor.gz":  gz.Bytes(),
+	}
+
+	for name, data := range recordings {
+		dir := t.TempDir()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		config := &FileInputConfig{Checkpoint: filepath.Join(dir, "replay.checkpoint")}
+
+		read := func(input *FileInput, from, to int) {
+			for i := from; i < to; i++ {
+				msg, err := input.PluginRead()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(msg.Meta, msgs[i].Meta) {
+					t.Fatalf("%s: expected record %d, got %q", name, i, msg.Meta)
+				}
+			}
+		}
+
+		input := NewFileInputWithConfig(path, false, 100, 0, false, config)
+		read(input, 0, 8)
+		input.Close()
+
+		// the stats of the inputs are named after their path, the pattern matches the same file
+		input = NewFileInputWithConfig(path+"*", false, 100, 0, false, config)
+		read(input, 8, len(msgs))
+
+		go input.PluginRead()
+		deadline := time.Now().Add(time.Second)
+		for _, ok := input.checkpoint.position(path); ok && time.Now().Before(deadline); _, ok = input.checkpoint.position(path) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		input.Close()
+		if _, err := os.Stat(config.Checkpoint); !os.IsNotExist(err) {
+			t.Errorf("%s: expected the checkpoint to be removed once replayed, got %v", name, err)
+		}
+	}
+}
+
+func TestInputKafkaCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kafka.checkpoint")
+	os.WriteFile(path, []byte(`{"test/0":{"offset":5}}`), 0644)
+
+	consumer := mocks.NewConsumer(t, nil)
+	defer consumer.Close()
+
+	pc := consumer.ExpectConsumePartition("test", 0, 5)
+	pc.YieldMessage(&sarama.ConsumerMessage{Value: []byte("1 2 3\nGET / HTTP1.1\r\n\r\n")})
+	consumer.SetTopicMetadata(map[string][]int32{"test": {0}})
+
+	input := NewKafkaInput("-1", &InputKafkaConfig{
+		consumer:   consumer,
+		Topic:      "test",
+		Checkpoint: path,
+	}, nil)
+
+	if _, err := input.PluginRead(); err != nil {
+		t.Fatal(err)
+	}
+	input.Close()
+
+	c, _ := openCheckpoint(path)
+	defer c.close()
+	if pos, ok := c.position("test/0"); !ok || pos.Offset != 6 || pos.Timestamp != 3 {
+		t.Errorf("expected the offset after the message read, got %+v %v", pos, ok)
+	}
+}
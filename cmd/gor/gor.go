@@ -82,6 +82,17 @@ func main() {
 		goreplay.Debug(0, "Started example file server for current directory on address ", args[1])
 
 		log.Fatal(http.ListenAndServe(args[1], loggingMiddleware(args[1], http.FileServer(http.Dir(dir)))))
+	} else if len(args) > 0 && args[0] == "file-convert" {
+		if len(args) != 4 {
+			log.Fatal("You should specify the format, and the source and destination recordings. Example: `gor file-convert binary requests.gor requests_binary.gor`")
+		}
+
+		records, err := goreplay.ConvertFile(args[2], args[3], args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Converted %d records to %s\n", records, args[3])
+		return
 	} else {
 		flag.Parse()
 		goreplay.CheckSettings()
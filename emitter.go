@@ -87,12 +87,14 @@ func CopyMulty(src PluginReader, writers ...PluginWriter) error {
 			return err
 		}
 		if msg != nil && len(msg.Data) > 0 {
-			if len(msg.Data) > int(Settings.CopyBufferSize) {
+			if err := spill(msg, int(Settings.CopyBufferSize)); err != nil {
+				Debug(1, fmt.Sprintf("[EMITTER] %s, truncating it", err))
 				msg.Data = msg.Data[:Settings.CopyBufferSize]
 			}
 			meta := payloadMeta(msg.Meta)
 			if len(meta) < 3 {
 				Debug(2, fmt.Sprintf("[EMITTER] Found malformed record %q from %q", msg.Meta, src))
+				msg.Spill.Release()
 				continue
 			}
 			requestID := meta[1]
@@ -100,6 +102,19 @@ func CopyMulty(src PluginReader, writers ...PluginWriter) error {
 			if Settings.Verbose >= 3 {
 				Debug(3, "[EMITTER] input: ", byteutils.SliceToString(msg.Meta[:len(msg.Meta)-1]), " from: ", src)
 			}
+			if len(Settings.K8sFilters) > 0 || len(Settings.K8sNegativeFilters) > 0 {
+				if isRequestPayload(msg.Meta) {
+					if !podsAllowed(msg, Settings.K8sFilters, Settings.K8sNegativeFilters) {
+						filteredRequests.Set(requestID, []byte{}, 60)
+						msg.Spill.Release()
+						continue
+					}
+				} else if _, err := filteredRequests.Get(requestID); err == nil {
+					filteredRequests.Del(requestID)
+					msg.Spill.Release()
+					continue
+				}
+			}
 			if modifier != nil {
 				Debug(3, "[EMITTER] modifier:", requestID, "from:", src)
 				if isRequestPayload(msg.Meta) {
@@ -107,6 +122,7 @@ func CopyMulty(src PluginReader, writers ...PluginWriter) error {
 					// If modifier tells to skip request
 					if len(msg.Data) == 0 {
 						filteredRequests.Set(requestID, []byte{}, 60) //
+						msg.Spill.Release()
 						continue
 					}
 					Debug(3, "[EMITTER] Rewritten input:", requestID, "from:", src)
@@ -115,12 +131,14 @@ func CopyMulty(src PluginReader, writers ...PluginWriter) error {
 					_, err := filteredRequests.Get(requestID)
 					if err == nil {
 						filteredRequests.Del(requestID)
+						msg.Spill.Release()
 						continue
 					}
 				}
 			}
 
-			if Settings.PrettifyHTTP {
+			// the body of spilled payloads is not in memory to be decoded
+			if Settings.PrettifyHTTP && msg.Spill == nil {
 				msg.Data = prettifyHTTP(msg.Data)
 				if len(msg.Data) == 0 {
 					continue
@@ -154,6 +172,8 @@ func CopyMulty(src PluginReader, writers ...PluginWriter) error {
 					}
 				}
 			}
+			// the outputs reading the spilled payload after PluginWrite retained it
+			msg.Spill.Release()
 		}
 	}
 }
@@ -0,0 +1,470 @@
+package goreplay
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// The binary format of the recordings of FileOutput, the text format separates the payloads with payloadSeparator,
+// which breaks when a body holds it, and can't be seeked.
+//
+// A recording starts with the magic "GORFILE" and the version of the format, then come blocks:
+// the kind of the block (1 byte), the length of its body (uint32), the body, and the CRC-32C of the kind, length and body (uint32).
+//
+//	'R' a record: its timestamp (int64), then the payload as in the text format, the meta line followed by the data
+//	'I' the index: the offset, number of the first record, and smallest and largest timestamps (4 int64) of every chunk of records
+//	'F' the footer: the offset of the index (int64), it is the last block of the recording
+//
+// The index and the footer are written when the recording is closed, the records of a recording that was not closed are still read.
+// Integers are big endian.
+const (
+	recordingMagic   = "GORFILE"
+	recordingVersion = 1
+
+	blockRecord = 'R'
+	blockIndex  = 'I'
+	blockFooter = 'F'
+
+	recordingMagicSize = len(recordingMagic) + 1
+
+	blockHeaderSize = 5
+	blockCRCSize    = 4
+	footerSize      = blockHeaderSize + 8 + blockCRCSize
+	indexEntrySize  = 32
+
+	// a new index entry starts after this many bytes of records
+	indexChunkSize = 1 << 20
+)
+
+// File formats of --output-file-format
+const (
+	FileFormatBinary = "binary"
+	FileFormatText   = "text"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	errCorruptRecord  = errors.New("corrupt record, its CRC does not match")
+	errInvalidBlock   = errors.New("invalid block")
+	errNoIndex        = errors.New("the recording has no index")
+	errRecordTooLarge = errors.New("record larger than 4GB")
+	errUnknownVersion = errors.New("unknown version of the recording format")
+	errUnknownFormat  = errors.New("unknown recording format")
+)
+
+// indexEntry locates a chunk of records of a recording
+type indexEntry struct {
+	offset       int64
+	record       int64 // number of the first record of the chunk
+	minTimestamp int64
+	maxTimestamp int64
+}
+
+// recordWriter writes a recording in the binary format
+type recordWriter struct {
+	w       io.Writer
+	offset  int64
+	records int64
+	chunk   indexEntry // the chunk being written, it is empty when chunk.record == records
+	index   []indexEntry
+}
+
+// newRecordWriter writes the header of a recording to w
+func newRecordWriter(w io.Writer) (*recordWriter, int, error) {
+	header := append([]byte(recordingMagic), recordingVersion)
+	n, err := w.Write(header)
+	return &recordWriter{w: w, offset: int64(n)}, n, err
+}
+
+// blockWriter writes the body of a block, and its CRC on close
+type blockWriter struct {
+	w   io.Writer // the recording and the CRC
+	out io.Writer // the recording
+	crc hash.Hash32
+}
+
+func (w *recordWriter) startBlock(kind byte, length int64) (*blockWriter, int, error) {
+	if length > 1<<32-1 {
+		return nil, 0, errRecordTooLarge
+	}
+	b := &blockWriter{out: w.w, crc: crc32.New(crcTable)}
+	b.w = io.MultiWriter(w.w, b.crc)
+
+	header := [blockHeaderSize]byte{kind}
+	binary.BigEndian.PutUint32(header[1:], uint32(length))
+	n, err := b.w.Write(header[:])
+	return b, n, err
+}
+
+func (b *blockWriter) close() (int, error) {
+	return b.out.Write(binary.BigEndian.AppendUint32(nil, b.crc.Sum32()))
+}
+
+// write writes msg as a record
+func (w *recordWriter) write(msg *Message) (n int, err error) {
+	timestamp := payloadTimestamp(msg.Meta)
+	b, n, err := w.startBlock(blockRecord, 8+int64(len(msg.Meta))+msg.Size())
+	if err != nil {
+		return n, err
+	}
+
+	var nn int
+	if nn, err = b.w.Write(binary.BigEndian.AppendUint64(nil, uint64(timestamp))); err == nil {
+		n += nn
+		if nn, err = b.w.Write(msg.Meta); err == nil {
+			n += nn
+			nn, err = writePayload(b.w, msg)
+		}
+	}
+	n += nn
+	if err != nil {
+		return n, err
+	}
+	nn, err = b.close()
+	n += nn
+
+	if w.chunk.record == w.records {
+		w.chunk = indexEntry{offset: w.offset, record: w.records, minTimestamp: timestamp, maxTimestamp: timestamp}
+	} else {
+		w.chunk.minTimestamp = min(w.chunk.minTimestamp, timestamp)
+		w.chunk.maxTimestamp = max(w.chunk.maxTimestamp, timestamp)
+	}
+	w.offset += int64(n)
+	w.records++
+	if w.offset-w.chunk.offset >= indexChunkSize {
+		w.index = append(w.index, w.chunk)
+		w.chunk.record = w.records
+	}
+
+	return n, err
+}
+
+// close writes the index and the footer of the recording
+func (w *recordWriter) close() (n int, err error) {
+	if w.chunk.record != w.records {
+		w.index = append(w.index, w.chunk)
+		w.chunk.record = w.records
+	}
+
+	body := make([]byte, 0, len(w.index)*indexEntrySize)
+	for _, e := range w.index {
+		body = binary.BigEndian.AppendUint64(body, uint64(e.offset))
+		body = binary.BigEndian.AppendUint64(body, uint64(e.record))
+		body = binary.BigEndian.AppendUint64(body, uint64(e.minTimestamp))
+		body = binary.BigEndian.AppendUint64(body, uint64(e.maxTimestamp))
+	}
+	indexOffset := w.offset
+	if n, err = w.writeBlock(blockIndex, body); err != nil {
+		return n, err
+	}
+	nn, err := w.writeBlock(blockFooter, binary.BigEndian.AppendUint64(nil, uint64(indexOffset)))
+	return n + nn, err
+}
+
+func (w *recordWriter) writeBlock(kind byte, body []byte) (n int, err error) {
+	b, n, err := w.startBlock(kind, int64(len(body)))
+	if err != nil {
+		return n, err
+	}
+	nn, err := b.w.Write(body)
+	n += nn
+	if err == nil {
+		nn, err = b.close()
+		n += nn
+	}
+	w.offset += int64(n)
+	return n, err
+}
+
+// isBinaryRecording checks if a recording is in the binary format, the text format starts with a payload type
+func isBinaryRecording(r *bufio.Reader) bool {
+	header, _ := r.Peek(len(recordingMagic))
+	return string(header) == recordingMagic
+}
+
+// recordReader reads the records of a recording in the binary format
+type recordReader struct {
+	r          *bufio.Reader
+	offset     int64  // offset of the next block
+	record     int64  // number of the next record
+	spillAbove int    // when set, the payloads are only read in memory up to this size, see Spill
+	spill      *Spill // the rest of the payload of the last record read
+}
+
+// newRecordReader checks the header of a recording
+func newRecordReader(r *bufio.Reader) (*recordReader, error) {
+	header := make([]byte, recordingMagicSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(recordingMagic)]) != recordingMagic {
+		return nil, errUnknownFormat
+	}
+	if header[len(recordingMagic)] != recordingVersion {
+		return nil, errUnknownVersion
+	}
+	return &recordReader{r: r, offset: int64(recordingMagicSize)}, nil
+}
+
+// next returns the next record, the index and footer are skipped. Records whose CRC does not match are skipped
+// and reported with errCorruptRecord, the reading can go on. Other errors, like an invalid block, end the reading.
+func (r *recordReader) next() (timestamp int64, payload []byte, err error) {
+	for {
+		kind, body, err := r.block()
+		if err != nil && err != errCorruptRecord {
+			return 0, nil, err
+		}
+		if kind != blockRecord {
+			continue
+		}
+		r.record++
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(body) < 8 {
+			return 0, nil, errInvalidBlock
+		}
+		return int64(binary.BigEndian.Uint64(body)), body[8:], nil
+	}
+}
+
+// block reads the next block. The part of a record above spillAbove is written to a Spill, kept in spill.
+func (r *recordReader) block() (kind byte, body []byte, err error) {
+	r.spill = nil
+	var header [blockHeaderSize]byte
+	if _, err = io.ReadFull(r.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	kind = header[0]
+	if kind != blockRecord && kind != blockIndex && kind != blockFooter {
+		return 0, nil, errInvalidBlock
+	}
+	length := int64(binary.BigEndian.Uint32(header[1:]))
+
+	keep := length
+	if kind == blockRecord && r.spillAbove > 0 && length > 8+int64(r.spillAbove) {
+		keep = 8 + int64(r.spillAbove)
+	}
+
+	crc := crc32.New(crcTable)
+	crc.Write(header[:])
+	body, err = r.readBody(crc, keep, length)
+	if err != nil {
+		r.spill.Release()
+		r.spill = nil
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	r.offset += blockHeaderSize + length + blockCRCSize
+
+	if crc.Sum32() != binary.BigEndian.Uint32(body[keep:]) {
+		r.spill.Release()
+		r.spill = nil
+		return kind, nil, errCorruptRecord
+	}
+	return kind, body[:keep], nil
+}
+
+// readBody reads the body of a block of the given length followed by its CRC, the bytes after keep are written to r.spill.
+// The body and the spill are added to crc, the returned buffer holds the kept body and the CRC.
+func (r *recordReader) readBody(crc hash.Hash32, keep, length int64) ([]byte, error) {
+	// the buffer grows with the data read, a corrupt length does not allocate more than the size of the recording
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, io.TeeReader(r.r, crc), keep); err != nil {
+		return nil, err
+	}
+	if keep < length {
+		var err error
+		if r.spill, err = newSpill(); err != nil {
+			return nil, err
+		}
+		if _, err = io.CopyN(r.spill, io.TeeReader(r.r, crc), length-keep); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := io.CopyN(&buf, r.r, blockCRCSize); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readRecordingIndex reads the index of a recording from its footer
+func readRecordingIndex(f io.ReadSeeker) ([]indexEntry, error) {
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if end < int64(recordingMagicSize+footerSize) {
+		return nil, errNoIndex
+	}
+
+	if _, err = f.Seek(end-footerSize, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := &recordReader{r: bufio.NewReaderSize(f, footerSize)}
+	kind, body, err := r.block()
+	if err != nil || kind != blockFooter {
+		return nil, errNoIndex
+	}
+	indexOffset := int64(binary.BigEndian.Uint64(body))
+
+	if _, err = f.Seek(indexOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r = &recordReader{r: bufio.NewReader(f)}
+	kind, body, err = r.block()
+	if err != nil || kind != blockIndex || len(body)%indexEntrySize != 0 {
+		return nil, errNoIndex
+	}
+
+	index := make([]indexEntry, len(body)/indexEntrySize)
+	for i := range index {
+		e := body[i*indexEntrySize:]
+		index[i] = indexEntry{
+			offset:       int64(binary.BigEndian.Uint64(e)),
+			record:       int64(binary.BigEndian.Uint64(e[8:])),
+			minTimestamp: int64(binary.BigEndian.Uint64(e[16:])),
+			maxTimestamp: int64(binary.BigEndian.Uint64(e[24:])),
+		}
+	}
+	return index, nil
+}
+
+// ConvertFile converts the recording src, in any format, to the format of dst, "binary" or "text".
+// Both are gzipped when their name ends with .gz. The records keep the order of src.
+func ConvertFile(src, dst, format string) (records int, err error) {
+	if format != FileFormatBinary && format != FileFormatText {
+		return 0, fmt.Errorf("unknown format %q, it should be %s or %s", format, FileFormatBinary, FileFormatText)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	var r io.Reader = in
+	if strings.HasSuffix(src, ".gz") {
+		if r, err = gzip.NewReader(in); err != nil {
+			return 0, err
+		}
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	var gz *gzip.Writer
+	var dest io.Writer = w
+	if strings.HasSuffix(dst, ".gz") {
+		gz = gzip.NewWriter(w)
+		dest = gz
+	}
+
+	var recordsOut *recordWriter
+	if format == FileFormatBinary {
+		if recordsOut, _, err = newRecordWriter(dest); err != nil {
+			return 0, err
+		}
+	}
+
+	err = readRecording(bufio.NewReader(r), func(_ int64, payload []byte) error {
+		msg := new(Message)
+		msg.Meta, msg.Data = payloadMetaWithBody(payload)
+		var err error
+		if recordsOut != nil {
+			_, err = recordsOut.write(msg)
+		} else {
+			_, err = writeTextRecord(dest, msg)
+		}
+		records++
+		return err
+	})
+	if err != nil {
+		return records, err
+	}
+
+	if recordsOut != nil {
+		if _, err = recordsOut.close(); err != nil {
+			return records, err
+		}
+	}
+	if gz != nil {
+		if err = gz.Close(); err != nil {
+			return records, err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return records, err
+	}
+	return records, out.Close()
+}
+
+// readRecording calls fn with every record of a recording in any format, the corrupt records are skipped
+func readRecording(r *bufio.Reader, fn func(timestamp int64, payload []byte) error) error {
+	if !isBinaryRecording(r) {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, math.MaxInt)
+		scanner.Split(payloadScanner)
+		for scanner.Scan() {
+			payload := scanner.Bytes()
+			if len(payloadMeta(payload)) < 3 {
+				continue
+			}
+			if err := fn(payloadTimestamp(payload), payload); err != nil {
+				return err
+			}
+		}
+		return scanner.Err()
+	}
+
+	records, err := newRecordReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		timestamp, payload, err := records.next()
+		switch err {
+		case nil:
+		case io.EOF:
+			return nil
+		case errCorruptRecord:
+			Debug(1, fmt.Sprintf("[FILE-CONVERT] skipping the corrupt record %d", records.record))
+			continue
+		default:
+			return err
+		}
+		if err := fn(timestamp, payload); err != nil {
+			return err
+		}
+	}
+}
+
+// writeTextRecord writes msg in the text format
+func writeTextRecord(w io.Writer, msg *Message) (n int, err error) {
+	var nn int
+	if n, err = w.Write(msg.Meta); err != nil {
+		return n, err
+	}
+	nn, err = writePayload(w, msg)
+	n += nn
+	if err != nil {
+		return n, err
+	}
+	nn, err = w.Write(payloadSeparatorAsBytes)
+	return n + nn, err
+}
@@ -0,0 +1,164 @@
+package goreplay
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRecords(n, size int) []*Message {
+	msgs := make([]*Message, n)
+	for i := range msgs {
+		// the bodies hold the separator of the text format
+		body := fmt.Sprintf("POST /%d HTTP/1.1\r\n\r\n%s%s", i, payloadSeparator, strings.Repeat("a", size))
+		msgs[i] = &Message{Meta: payloadHeader(RequestPayload, uuid(), int64(1000+i), 0), Data: []byte(body)}
+	}
+	return msgs
+}
+
+func writeRecording(t *testing.T, msgs []*Message, closed bool) []byte {
+	var buf bytes.Buffer
+	w, _, err := newRecordWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range msgs {
+		if _, err := w.write(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if closed {
+		if _, err := w.close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func readRecords(t *testing.T, data []byte) (payloads []string, corrupt int) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	if !isBinaryRecording(r) {
+		t.Fatal("expected a binary recording")
+	}
+	records, err := newRecordReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		_, payload, err := records.next()
+		switch err {
+		case nil:
+			payloads = append(payloads, string(payload))
+		case errCorruptRecord:
+			corrupt++
+		case io.EOF:
+			return
+		default:
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRecordingFormat(t *testing.T) {
+	msgs := testRecords(50, 100<<10)
+	data := writeRecording(t, msgs, true)
+
+	payloads, _ := readRecords(t, data)
+	if len(payloads) != len(msgs) {
+		t.Fatalf("expected %d records, got %d", len(msgs), len(payloads))
+	}
+	for i, msg := range msgs {
+		if payloads[i] != string(msg.Meta)+string(msg.Data) {
+			t.Errorf("record %d was not kept", i)
+		}
+	}
+
+	index, err := readRecordingIndex(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 5 {
+		t.Errorf("expected an index entry every MB, got %d entries", len(index))
+	}
+	for _, e := range index {
+		r := &recordReader{r: bufio.NewReader(bytes.NewReader(data[e.offset:]))}
+		timestamp, payload, err := r.next()
+		if err != nil || string(payload) != payloads[e.record] || timestamp != e.minTimestamp || e.maxTimestamp < e.minTimestamp {
+			t.Errorf("the index entry %+v does not locate its chunk: %v", e, err)
+		}
+	}
+}
+
+func TestRecordingCorruption(t *testing.T) {
+	msgs := testRecords(3, 10)
+	data := writeRecording(t, msgs, true)
+
+	// flip a byte of the body of the second record
+	second := bytes.Index(data, []byte("POST /1 "))
+	data[second] ^= 0xff
+	payloads, corrupt := readRecords(t, data)
+	if corrupt != 1 || len(payloads) != 2 || !strings.Contains(payloads[1], "POST /2 ") {
+		t.Errorf("expected the corrupt record to be skipped, got %d corrupt records and %d records", corrupt, len(payloads))
+	}
+
+	// a recording that was not closed has no index
+	data = writeRecording(t, msgs, false)
+	if payloads, _ = readRecords(t, data); len(payloads) != 3 {
+		t.Errorf("expected the records of a recording that was not closed, got %d", len(payloads))
+	}
+	if _, err := readRecordingIndex(bytes.NewReader(data)); err != errNoIndex {
+		t.Errorf("expected no index, got %v", err)
+	}
+}
+
+func TestConvertFile(t *testing.T) {
+	dir := t.TempDir()
+	// the text format can't hold bodies with the separator
+	msg := &Message{Meta: payloadHeader(RequestPayload, uuid(), 1000, 0), Data: []byte("GET / HTTP/1.1\r\n\r\n")}
+
+	var text bytes.Buffer
+	writeTextRecord(&text, msg)
+	os.WriteFile(filepath.Join(dir, "text.gor"), text.Bytes(), 0600)
+
+	if n, err := ConvertFile(filepath.Join(dir, "text.gor"), filepath.Join(dir, "binary.gor.gz"), FileFormatBinary); err != nil || n != 1 {
+		t.Fatalf("expected 1 record converted, got %d %v", n, err)
+	}
+	if n, err := ConvertFile(filepath.Join(dir, "binary.gor.gz"), filepath.Join(dir, "text2.gor"), FileFormatText); err != nil || n != 1 {
+		t.Fatalf("expected 1 record converted, got %d %v", n, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "text2.gor")); !bytes.Equal(data, text.Bytes()) {
+		t.Errorf("expected the converted recording to be %q, got %q", text.Bytes(), data)
+	}
+	if _, err := ConvertFile(filepath.Join(dir, "text.gor"), filepath.Join(dir, "x.gor"), "json"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestInputFileBinaryRecording(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "requests.gor")
+	msgs := testRecords(3, 10)
+
+	output := NewFileOutput(name, &FileOutputConfig{FlushInterval: time.Minute, Append: true})
+	for _, msg := range msgs {
+		output.PluginWrite(msg)
+	}
+	output.Close()
+
+	input := NewFileInput(name, false, 100, 0, false)
+	defer input.Close()
+	for _, expected := range msgs {
+		msg, err := input.PluginRead()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(msg.Meta, expected.Meta) || !bytes.Equal(msg.Data, expected.Data) {
+			t.Errorf("expected %q, got %q", expected.Data, msg.Data)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"expvar"
 	"fmt"
 	"io"
+	"log"
 	"math"
 	"os"
 	"path/filepath"
@@ -25,7 +26,13 @@ import (
 
 type filePayload struct {
 	data      []byte
+	spill     *Spill // the part of the payload above --copy-buffer-size
 	timestamp int64
+	offset    int64 // offset of the record in the recording
+	record    int64 // number of the record in the recording
+	path      string
+	position  checkpointPosition // position of the reader once the payload is replayed
+	replayed  []string           // set instead of data when the recordings were all replayed
 }
 
 // An IntHeap is a min-heap of ints.
@@ -65,30 +72,45 @@ type fileInputReader struct {
 	readDepth int
 	dryRun    bool
 	path      string
+	rng       fileRange
+	records   *recordReader // set when the reader was moved by seek or resume
+	indexed   bool          // set when seek read the index of the recording
+	endRecord int64         // number of the first record of the chunks after the range, 0 when the reading goes to the end
+	late      int           // number of records in a row past the end of the range
+	offset    int64         // offset of the record after the last one queued
+	record    int64         // number of the record after the last one queued
 }
 
 func (f *fileInputReader) parse(init chan struct{}) error {
+	ready := sync.OnceFunc(func() { close(init) })
+	if f.records != nil || isBinaryRecording(f.reader) {
+		return f.parseRecords(ready)
+	}
+
 	payloadSeparatorAsBytes := []byte(payloadSeparator)
 	var buffer bytes.Buffer
-	var initialized bool
+	// the lines of a payload after --copy-buffer-size are written to a spill file
+	limit := int(Settings.CopyBufferSize)
+	var spilled *Spill
+	truncated := false
 
 	lineNum := 0
+	offset, record := f.offset, f.record
+	start := offset
 
 	for {
 		line, err := f.reader.ReadBytes('\n')
 		lineNum++
+		offset += int64(len(line))
 
 		if err != nil {
 			if err != io.EOF {
 				Debug(1, err)
 			}
 
+			spilled.Release()
 			f.Close()
-
-			if !initialized {
-				close(init)
-				initialized = true
-			}
+			ready()
 
 			return err
 		}
@@ -96,44 +118,134 @@ func (f *fileInputReader) parse(init chan struct{}) error {
 		if bytes.Equal(payloadSeparatorAsBytes[1:], line) {
 			asBytes := buffer.Bytes()
 			meta := payloadMeta(asBytes)
+			payloadSpill := spilled
+			buffer = bytes.Buffer{}
+			spilled, truncated = nil, false
 
 			if len(meta) < 3 {
 				Debug(1, fmt.Sprintf("Found malformed record, file: %s, line %d", f.path, lineNum))
-				buffer = bytes.Buffer{}
+				payloadSpill.Release()
+				start = offset
 				continue
 			}
 
 			timestamp, _ := strconv.ParseInt(string(meta[2]), 10, 64)
+			// the new line before the separator is not part of the payload
 			data := asBytes[:len(asBytes)-1]
+			if payloadSpill != nil {
+				data = asBytes
+				payloadSpill.size--
+			}
 
-			f.queue.Lock()
-			heap.Push(&f.queue, &filePayload{
-				timestamp: timestamp,
-				data:      data,
-			})
-			f.queue.Unlock()
+			if f.done(record, timestamp) {
+				payloadSpill.Release()
+				f.Close()
+				ready()
+				return nil
+			}
+			if f.rng.within(record, timestamp) {
+				f.push(&filePayload{data: data, spill: payloadSpill, timestamp: timestamp, offset: start, record: record}, offset, ready)
+			} else {
+				payloadSpill.Release()
+			}
+			record++
 
-			for {
-				if f.queue.Len() < f.readDepth {
-					break
-				}
+			start = offset
+			continue
+		}
 
-				if !initialized {
-					close(init)
-					initialized = true
+		switch {
+		case truncated:
+		case spilled != nil:
+			if _, err := spilled.Write(line); err != nil {
+				Debug(1, fmt.Sprintf("[INPUT-FILE] can't spill the payload at line %d of %s: %s, truncating it", lineNum, f.path, err))
+				spilled.Release()
+				spilled, truncated = nil, true
+			}
+		default:
+			buffer.Write(line)
+			if limit > 0 && buffer.Len() > limit {
+				var err error
+				if spilled, err = spillChunks(buffer.Bytes()[limit:]); err != nil {
+					Debug(1, fmt.Sprintf("[INPUT-FILE] can't spill the payload at line %d of %s: %s, truncating it", lineNum, f.path, err))
+					truncated = true
 				}
+				buffer.Truncate(limit)
+			}
+		}
+	}
+}
 
-				if !f.dryRun {
-					time.Sleep(100 * time.Millisecond)
-				}
+// parseRecords reads a recording in the binary format, see file_format.go
+func (f *fileInputReader) parseRecords(ready func()) error {
+	var err error
+	records := f.records
+	if records == nil {
+		records, err = newRecordReader(f.reader)
+	}
+	if records != nil {
+		records.spillAbove = int(Settings.CopyBufferSize)
+	}
+	for err == nil {
+		var timestamp int64
+		var data []byte
+		offset := records.offset
+		timestamp, data, err = records.next()
+		switch err {
+		case nil:
+			record := records.record - 1
+			if f.done(record, timestamp) {
+				records.spill.Release()
+				err = io.EOF
+			} else if f.rng.within(record, timestamp) {
+				f.push(&filePayload{data: data, spill: records.spill, timestamp: timestamp, offset: offset, record: record}, records.offset, ready)
+			} else {
+				records.spill.Release()
 			}
+		case errCorruptRecord:
+			Debug(1, fmt.Sprintf("[INPUT-FILE] skipping the corrupt record %d, file: %s", records.record, f.path))
+			err = nil
+		}
+	}
 
-			buffer = bytes.Buffer{}
-			continue
+	if err != io.EOF {
+		Debug(1, fmt.Sprintf("[INPUT-FILE] error reading %s: %s", f.path, err))
+	}
+	f.Close()
+	ready()
+	return err
+}
+
+// push queues a payload, next is the offset of the record after it. It waits while the queue is full.
+func (f *fileInputReader) push(payload *filePayload, next int64, ready func()) {
+	f.queue.Lock()
+	heap.Push(&f.queue, payload)
+	f.offset, f.record = next, payload.record+1
+	f.queue.Unlock()
+
+	for {
+		if f.queue.Len() < f.readDepth {
+			break
+		}
+
+		ready()
+
+		if !f.dryRun {
+			time.Sleep(100 * time.Millisecond)
 		}
+	}
+}
 
-		buffer.Write(line)
+// position returns the position of the first record of the reader which was not replayed,
+// the records are queued out of order. The queue must be locked.
+func (f *fileInputReader) position() checkpointPosition {
+	pos := checkpointPosition{Offset: f.offset, Record: f.record}
+	for _, p := range f.queue.s {
+		if p.record < pos.Record {
+			pos.Offset, pos.Record = p.offset, p.record
+		}
 	}
+	return pos
 }
 
 func (f *fileInputReader) wait() {
@@ -164,31 +276,36 @@ func (f *fileInputReader) Close() error {
 	return nil
 }
 
-func newFileInputReader(path string, readDepth int, dryRun bool) *fileInputReader {
-	var file io.ReadCloser
-	var err error
-
+// openRecording opens a local or S3 recording, gzipped recordings are decompressed by the returned reader
+func openRecording(path string) (file io.ReadCloser, reader *bufio.Reader, err error) {
 	if strings.HasPrefix(path, "s3://") {
 		file = NewS3ReadCloser(path)
-	} else {
-		file, err = os.Open(path)
+	} else if file, err = os.Open(path); err != nil {
+		return nil, nil, err
+	}
+
+	if strings.HasSuffix(path, ".gz") {
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return file, bufio.NewReader(gzReader), nil
 	}
+	return file, bufio.NewReader(file), nil
+}
 
+// newFileInputReader starts reading a recording, from the position resume of a checkpoint if it is not nil
+func newFileInputReader(path string, readDepth int, dryRun bool, rng fileRange, resume *checkpointPosition) *fileInputReader {
+	file, reader, err := openRecording(path)
 	if err != nil {
 		Debug(0, fmt.Sprintf("[INPUT-FILE] err: %q", err))
 		return nil
 	}
 
-	r := &fileInputReader{path: path, file: file, closed: 0, readDepth: readDepth, dryRun: dryRun}
-	if strings.HasSuffix(path, ".gz") {
-		gzReader, err := gzip.NewReader(file)
-		if err != nil {
-			Debug(0, fmt.Sprintf("[INPUT-FILE] err: %q", err))
-			return nil
-		}
-		r.reader = bufio.NewReader(gzReader)
-	} else {
-		r.reader = bufio.NewReader(file)
+	r := &fileInputReader{path: path, file: file, reader: reader, closed: 0, readDepth: readDepth, dryRun: dryRun, rng: rng}
+	if resume == nil || !r.resume(*resume) {
+		r.seek(r.rng)
 	}
 
 	heap.Init(&r.queue)
@@ -203,7 +320,7 @@ func newFileInputReader(path string, readDepth int, dryRun bool) *fileInputReade
 // FileInput can read requests generated by FileOutput
 type FileInput struct {
 	mu          sync.Mutex
-	data        chan []byte
+	data        chan *filePayload
 	exit        chan bool
 	path        string
 	readers     []*fileInputReader
@@ -212,14 +329,23 @@ type FileInput struct {
 	readDepth   int
 	dryRun      bool
 	maxWait     time.Duration
+	start       recordingTime
+	end         recordingTime
+	skipRecords int64
+	checkpoint  *checkpoint
 
 	stats *expvar.Map
 }
 
 // NewFileInput constructor for FileInput. Accepts file path as argument.
 func NewFileInput(path string, loop bool, readDepth int, maxWait time.Duration, dryRun bool) (i *FileInput) {
+	return NewFileInputWithConfig(path, loop, readDepth, maxWait, dryRun, nil)
+}
+
+// NewFileInputWithConfig is NewFileInput replaying the part of the recordings set by config, and resuming from its checkpoint
+func NewFileInputWithConfig(path string, loop bool, readDepth int, maxWait time.Duration, dryRun bool, config *FileInputConfig) (i *FileInput) {
 	i = new(FileInput)
-	i.data = make(chan []byte, 1000)
+	i.data = make(chan *filePayload, 1000)
 	i.exit = make(chan bool)
 	i.path = path
 	i.speedFactor = 1
@@ -229,6 +355,23 @@ func NewFileInput(path string, loop bool, readDepth int, maxWait time.Duration,
 	i.dryRun = dryRun
 	i.maxWait = maxWait
 
+	if config != nil {
+		var err error
+		if i.start, err = parseRecordingTime(config.Start); err != nil {
+			log.Fatal("[INPUT-FILE] --input-file-start: ", err)
+		}
+		if i.end, err = parseRecordingTime(config.End); err != nil {
+			log.Fatal("[INPUT-FILE] --input-file-end: ", err)
+		}
+		i.skipRecords = config.SkipRecords
+
+		if config.Checkpoint != "" {
+			if i.checkpoint, err = openCheckpoint(config.Checkpoint); err != nil {
+				log.Fatal("[INPUT-FILE] --input-file-checkpoint: ", err)
+			}
+		}
+	}
+
 	if err := i.init(); err != nil {
 		return
 	}
@@ -284,10 +427,20 @@ func (i *FileInput) init() (err error) {
 		return errors.New("no matching files")
 	}
 
-	i.readers = make([]*fileInputReader, len(matches))
+	rng := i.fileRange(matches)
 
+	// only the first round of a loop resumes from the checkpoint
+	resuming := i.checkpoint != nil && i.readers == nil
+	i.readers = make([]*fileInputReader, len(matches))
 	for idx, p := range matches {
-		i.readers[idx] = newFileInputReader(p, i.readDepth, i.dryRun)
+		var resume *checkpointPosition
+		if resuming {
+			if pos, ok := i.checkpoint.position(p); ok {
+				Debug(1, fmt.Sprintf("[INPUT-FILE] resuming %s from record %d", p, pos.Record))
+				resume = &pos
+			}
+		}
+		i.readers[idx] = newFileInputReader(p, i.readDepth, i.dryRun, rng, resume)
 	}
 
 	i.stats.Add("reader_count", int64(len(matches)))
@@ -298,13 +451,23 @@ func (i *FileInput) init() (err error) {
 // PluginRead reads message from this plugin
 func (i *FileInput) PluginRead() (*Message, error) {
 	var msg Message
-	select {
-	case <-i.exit:
-		return nil, ErrorStopped
-	case buf := <-i.data:
-		i.stats.Add("read_from", 1)
-		msg.Meta, msg.Data = payloadMetaWithBody(buf)
-		return &msg, nil
+	for {
+		select {
+		case <-i.exit:
+			return nil, ErrorStopped
+		case payload := <-i.data:
+			if payload.replayed != nil {
+				i.checkpoint.remove(payload.replayed...)
+				continue
+			}
+			i.stats.Add("read_from", 1)
+			msg.Meta, msg.Data = payloadMetaWithBody(payload.data)
+			msg.Spill = payload.spill
+			if i.checkpoint != nil {
+				i.checkpoint.set(payload.path, payload.position)
+			}
+			return &msg, nil
+		}
 	}
 }
 
@@ -352,6 +515,7 @@ func (i *FileInput) emit() {
 		reader := i.nextReader()
 
 		if reader == nil {
+			i.replayed()
 			if i.loop {
 				i.init()
 				lastTime = -1
@@ -361,11 +525,14 @@ func (i *FileInput) emit() {
 			}
 		}
 
-		reader.queue.RLock()
+		reader.queue.Lock()
 		payload := heap.Pop(&reader.queue).(*filePayload)
+		payload.path = reader.path
+		payload.position = reader.position()
+		payload.position.Timestamp = payload.timestamp
 		i.stats.Add("total_counter", 1)
-		i.stats.Add("total_bytes", int64(len(payload.data)))
-		reader.queue.RUnlock()
+		i.stats.Add("total_bytes", int64(len(payload.data))+payload.spill.Size())
+		reader.queue.Unlock()
 
 		if lastTime != -1 {
 			diff := payload.timestamp - lastTime
@@ -411,7 +578,7 @@ func (i *FileInput) emit() {
 			return
 		default:
 			if !i.dryRun {
-				i.data <- payload.data
+				i.data <- payload
 			}
 		}
 	}
@@ -436,6 +603,28 @@ func (i *FileInput) emit() {
 	}
 }
 
+// replayed tells PluginRead to remove the recordings from the checkpoint once the payloads before are read,
+// the next replay starts them again
+func (i *FileInput) replayed() {
+	if i.checkpoint == nil || i.dryRun {
+		return
+	}
+
+	var paths []string
+	i.mu.Lock()
+	for _, r := range i.readers {
+		if r != nil {
+			paths = append(paths, r.path)
+		}
+	}
+	i.mu.Unlock()
+
+	select {
+	case <-i.exit:
+	case i.data <- &filePayload{replayed: paths}:
+	}
+}
+
 // Close closes this plugin
 func (i *FileInput) Close() error {
 	defer i.mu.Unlock()
@@ -446,5 +635,8 @@ func (i *FileInput) Close() error {
 		r.Close()
 	}
 
+	if i.checkpoint != nil {
+		return i.checkpoint.close()
+	}
 	return nil
 }
@@ -0,0 +1,185 @@
+package goreplay
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileInputConfig holds the part of the recordings replayed by FileInput, and the checkpoint it resumes from
+type FileInputConfig struct {
+	Start       string `json:"input-file-start"`
+	End         string `json:"input-file-end"`
+	SkipRecords int64  `json:"input-file-skip-records"`
+	Checkpoint  string `json:"input-file-checkpoint"`
+}
+
+// recordingTime is a bound of --input-file-start or --input-file-end,
+// an absolute time or an offset from the start of the recording
+type recordingTime struct {
+	set      bool
+	relative bool
+	value    int64 // unix nanoseconds, or the offset in nanoseconds
+}
+
+// parseRecordingTime parses an offset like "10m", a RFC3339 time,
+// or unix nanoseconds like the timestamps of the payloads
+func parseRecordingTime(s string) (t recordingTime, err error) {
+	if s == "" {
+		return t, nil
+	}
+	t.set = true
+
+	if d, err := time.ParseDuration(s); err == nil {
+		t.relative = true
+		t.value = int64(d)
+		return t, nil
+	}
+	if at, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		t.value = at.UnixNano()
+		return t, nil
+	}
+	if t.value, err = strconv.ParseInt(s, 10, 64); err != nil {
+		return t, fmt.Errorf("invalid time %q, expected an offset like 10m, a RFC3339 time or unix nanoseconds", s)
+	}
+	return t, nil
+}
+
+// resolve returns the time in unix nanoseconds, origin is the start of the recording
+func (t recordingTime) resolve(origin int64) int64 {
+	if t.relative {
+		return origin + t.value
+	}
+	return t.value
+}
+
+// fileRange is the part of a recording to replay
+type fileRange struct {
+	start int64 // unix nanoseconds, 0 when the range starts with the recording
+	end   int64 // unix nanoseconds, 0 when the range ends with the recording
+	skip  int64 // number of records skipped from the start of the recording
+}
+
+// within reports if the record n of a recording, with the given timestamp, is in the range
+func (r fileRange) within(n, timestamp int64) bool {
+	return n >= r.skip && timestamp >= r.start && !r.past(timestamp)
+}
+
+// past reports if a timestamp is after the end of the range
+func (r fileRange) past(timestamp int64) bool {
+	return r.end > 0 && timestamp > r.end
+}
+
+// done reports if the reading can stop at the record n, with the given timestamp. The records of a recording are not
+// strictly ordered by time, it stops at the first chunk of the index starting after the end of the range,
+// or without index after readDepth records in a row past the end.
+func (f *fileInputReader) done(n, timestamp int64) bool {
+	if f.indexed {
+		return f.endRecord > 0 && n >= f.endRecord
+	}
+	if !f.rng.past(timestamp) {
+		f.late = 0
+		return false
+	}
+	f.late++
+	return f.late >= f.readDepth
+}
+
+// recordingStart returns the timestamp of the first record of a recording
+func recordingStart(path string) (start int64, err error) {
+	file, reader, err := openRecording(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	found := false
+	err = readRecording(reader, func(timestamp int64, _ []byte) error {
+		start, found = timestamp, true
+		return io.EOF
+	})
+	if !found {
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, err
+	}
+	return start, nil
+}
+
+// seek moves the reader of a local recording in the binary format to the chunk of its index holding the start of rng,
+// the records before it are not read, and finds the chunks after the end of rng which are not read either.
+// Recordings that are gzipped, in the text format or without index are read from the start.
+func (f *fileInputReader) seek(rng fileRange) {
+	file, ok := f.file.(*os.File)
+	if !ok || strings.HasSuffix(f.path, ".gz") || rng == (fileRange{}) || !isBinaryRecording(f.reader) {
+		return
+	}
+
+	index, err := readRecordingIndex(file)
+	if err != nil {
+		Debug(2, fmt.Sprintf("[INPUT-FILE] can't seek %s, reading it from the start: %s", f.path, err))
+	} else if len(index) > 0 {
+		f.indexed = true
+	}
+
+	// the reading stops at the first of the last chunks which all start after the range
+	for i := len(index) - 1; rng.end > 0 && i >= 0 && index[i].minTimestamp > rng.end; i-- {
+		f.endRecord = index[i].record
+	}
+
+	// a chunk is skipped when all its records are before the range, by number or by time
+	chunk := 0
+	for i := 1; i < len(index); i++ {
+		if index[i].record > rng.skip && index[i-1].maxTimestamp >= rng.start {
+			break
+		}
+		chunk = i
+	}
+
+	offset := int64(0)
+	if chunk > 0 {
+		offset = index[chunk].offset
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		Debug(1, fmt.Sprintf("[INPUT-FILE] can't seek %s: %s", f.path, err))
+	}
+	f.reader.Reset(file)
+
+	if chunk > 0 {
+		f.records = &recordReader{r: f.reader, offset: offset, record: index[chunk].record}
+		Debug(2, fmt.Sprintf("[INPUT-FILE] skipped %d records of %s using its index", index[chunk].record, f.path))
+	}
+}
+
+// fileRange resolves the range of the recordings matched by the path of the input,
+// the offsets are from the first record of all of them
+func (i *FileInput) fileRange(matches []string) (rng fileRange) {
+	rng.skip = i.skipRecords
+
+	var origin int64
+	if i.start.relative || i.end.relative {
+		found := false
+		for _, p := range matches {
+			start, err := recordingStart(p)
+			if err != nil {
+				Debug(2, fmt.Sprintf("[INPUT-FILE] can't find the start of %s: %s", p, err))
+				continue
+			}
+			if !found || start < origin {
+				origin, found = start, true
+			}
+		}
+	}
+
+	if i.start.set {
+		rng.start = i.start.resolve(origin)
+	}
+	if i.end.set {
+		rng.end = i.end.resolve(origin)
+	}
+	return rng
+}
@@ -0,0 +1,171 @@
+package goreplay
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseRecordingTime(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected recordingTime
+		err      bool
+	}{
+		{"", recordingTime{}, false},
+		{"10m", recordingTime{set: true, relative: true, value: int64(10 * time.Minute)}, false},
+		{"0", recordingTime{set: true, relative: true}, false},
+		{"2023-05-01T10:00:00Z", recordingTime{set: true, value: time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC).UnixNano()}, false},
+		{"1682935200000000000", recordingTime{set: true, value: 1682935200000000000}, false},
+		{"yesterday", recordingTime{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRecordingTime(tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: expected error %v, got %v", tt.value, tt.err, err)
+			continue
+		}
+		if !tt.err && got != tt.expected {
+			t.Errorf("%q: expected %+v, got %+v", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestFileInputReaderSeek(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "requests.gor")
+	// the records of 100KB fill several chunks of the index
+	msgs := testRecords(40, 100<<10)
+	if err := os.WriteFile(name, writeRecording(t, msgs, true), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rng   fileRange
+		first int
+	}{
+		{fileRange{skip: 25}, 25},
+		{fileRange{start: 1030}, 30},
+		{fileRange{start: 1030, skip: 12}, 30},
+		{fileRange{start: 1005, skip: 35}, 35},
+	}
+
+	for _, tt := range tests {
+		file, reader, err := openRecording(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &fileInputReader{path: name, file: file, reader: reader, readDepth: 100, rng: tt.rng}
+		r.seek(tt.rng)
+		if r.records == nil || r.records.record == 0 || r.records.record > int64(tt.first) {
+			t.Errorf("%+v: expected the reader to seek to a chunk before record %d, got %+v", tt.rng, tt.first, r.records)
+			r.Close()
+			continue
+		}
+
+		init := make(chan struct{})
+		go r.parse(init)
+		<-init
+		if r.queue.Len() != len(msgs)-tt.first {
+			t.Errorf("%+v: expected %d records, got %d", tt.rng, len(msgs)-tt.first, r.queue.Len())
+		}
+		if r.queue.Len() > 0 && !bytes.Equal(payloadMeta(msgs[tt.first].Meta)[2], payloadMeta(r.queue.Idx(0).data)[2]) {
+			t.Errorf("%+v: expected the first record to be %d, got %q", tt.rng, tt.first, r.queue.Idx(0).data[:50])
+		}
+		r.Close()
+	}
+}
+
+func TestInputFileRange(t *testing.T) {
+	msgs := testRecords(40, 100<<10)
+	var text bytes.Buffer
+	for _, msg := range msgs {
+		if _, err := writeTextRecord(&text, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recordings := map[string][]byte{
+		"binary": writeRecording(t, msgs, true),
+		"text":   text.Bytes(),
+	}
+
+	tests := []struct {
+		config      FileInputConfig
+		first, last int
+	}{
+		{FileInputConfig{Start: "20ns", End: "29ns"}, 20, 29},
+		{FileInputConfig{Start: "1010", End: "1012"}, 10, 12},
+		{FileInputConfig{SkipRecords: 37}, 37, 39},
+		{FileInputConfig{Start: "1ns", End: "4ns", SkipRecords: 3}, 3, 4},
+	}
+
+	for format, data := range recordings {
+		for _, tt := range tests {
+			// the stats of the inputs are named after their path
+			name := filepath.Join(t.TempDir(), "requests.gor")
+			if err := os.WriteFile(name, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			input := NewFileInputWithConfig(name, false, 100, 0, false, &tt.config)
+			for i := tt.first; i <= tt.last; i++ {
+				msg, err := input.PluginRead()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(msg.Meta, msgs[i].Meta) {
+					t.Errorf("%s %+v: expected record %d, got %q", format, tt.config, i, msg.Meta)
+				}
+			}
+
+			read := make(chan *Message, 1)
+			go func() {
+				msg, _ := input.PluginRead()
+				read <- msg
+			}()
+			select {
+			case msg := <-read:
+				t.Errorf("%s %+v: expected no record after %d, got %q", format, tt.config, tt.last, msg.Meta)
+			case <-time.After(200 * time.Millisecond):
+			}
+			input.Close()
+		}
+	}
+}
+
+func TestInputFileRangeUnordered(t *testing.T) {
+	msgs := testRecords(10, 10)
+	// the records of a recording are not strictly ordered by time
+	msgs[5].Meta = payloadHeader(RequestPayload, uuid(), 1006, 0)
+	msgs[6].Meta = payloadHeader(RequestPayload, uuid(), 1005, 0)
+
+	var text bytes.Buffer
+	for _, msg := range msgs {
+		writeTextRecord(&text, msg)
+	}
+	recordings := map[string][]byte{
+		"binary": writeRecording(t, msgs, true),
+		"text":   text.Bytes(),
+	}
+
+	for format, data := range recordings {
+		name := filepath.Join(t.TempDir(), "requests.gor")
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		input := NewFileInputWithConfig(name, false, 100, 0, false, &FileInputConfig{End: "1005"})
+		for _, i := range []int{0, 1, 2, 3, 4, 6} {
+			msg, err := input.PluginRead()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(msg.Meta, msgs[i].Meta) {
+				t.Errorf("%s: expected record %d, got %q", format, i, msg.Meta)
+			}
+		}
+		input.Close()
+	}
+}
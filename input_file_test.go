@@ -358,3 +358,34 @@ func ReadFromCaptureFile(captureFile *os.File, count int, callback writeCallback
 	return
 
 }
+
+func TestInputFileConnectionEvents(t *testing.T) {
+	name := fmt.Sprintf("/tmp/%d", rand.Int63())
+	defer os.Remove(name)
+
+	output := NewFileOutput(name, &FileOutputConfig{FlushInterval: time.Minute, Append: true})
+	connID := []byte("c8500050c0a80001")
+	for i, payloadType := range []byte{ConnectionOpenPayload, RequestPayload, ConnectionClosePayload} {
+		msg := &Message{Meta: payloadHeader(payloadType, append(connID, "00000001"...), int64(i+1), 0), Data: []byte("GET / HTTP/1.1\r\n\r\n")}
+		if payloadType != RequestPayload {
+			msg.Meta, msg.Data = connectionPayload(payloadType, connID, int64(i+1), "10.0.0.1:51234", "10.0.0.2:80")
+		}
+		output.PluginWrite(msg)
+	}
+	output.Close()
+
+	input := NewFileInput(name, false, 100, 0, false)
+	defer input.Close()
+	for _, payloadType := range []byte{ConnectionOpenPayload, RequestPayload, ConnectionClosePayload} {
+		msg, err := input.PluginRead()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Meta[0] != payloadType {
+			t.Errorf("expected the payload type %c, got %q", payloadType, msg.Meta)
+		}
+		if isConnectionPayload(msg.Meta) && (string(payloadID(msg.Meta)) != string(connID) || string(msg.Data) != "10.0.0.1:51234 10.0.0.2:80") {
+			t.Errorf("the connection event was not kept: %q %q", msg.Meta, msg.Data)
+		}
+	}
+}
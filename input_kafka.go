@@ -2,6 +2,7 @@ package goreplay
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
@@ -20,6 +21,7 @@ type KafkaInput struct {
 	speedFactor float64
 	quit        chan struct{}
 	kafkaTimer  *kafkaTimer
+	checkpoint  *checkpoint
 }
 
 func getOffsetOfPartitions(offsetCfg string) int64 {
@@ -62,8 +64,22 @@ func NewKafkaInput(offsetCfg string, config *InputKafkaConfig, tlsConfig *KafkaT
 	}
 	i.config.Offset = offsetCfg
 
+	if config.Checkpoint != "" {
+		if i.checkpoint, err = openCheckpoint(config.Checkpoint); err != nil {
+			log.Fatalln("Failed to open the Kafka checkpoint:", err)
+		}
+	}
+
 	for index, partition := range partitions {
-		consumer, err := con.ConsumePartition(config.Topic, partition, getOffsetOfPartitions(offsetCfg))
+		offset := getOffsetOfPartitions(offsetCfg)
+		if i.checkpoint != nil {
+			if pos, ok := i.checkpoint.position(partitionKey(config.Topic, partition)); ok {
+				Debug(1, fmt.Sprintf("[INPUT-KAFKA] resuming partition %d from offset %d", partition, pos.Offset))
+				offset = pos.Offset
+			}
+		}
+
+		consumer, err := con.ConsumePartition(config.Topic, partition, offset)
 		if err != nil {
 			log.Fatalln("Failed to start Sarama(Kafka) partition consumer:", err)
 		}
@@ -126,10 +142,23 @@ func (i *KafkaInput) PluginRead() (*Message, error) {
 
 	i.timeWait(inputTs)
 
+	if i.checkpoint != nil {
+		ts, _ := strconv.ParseInt(inputTs, 10, 64)
+		if ts == 0 {
+			ts = message.Timestamp.UnixNano()
+		}
+		i.checkpoint.set(partitionKey(message.Topic, message.Partition), checkpointPosition{Offset: message.Offset + 1, Timestamp: ts})
+	}
+
 	return &msg, nil
 
 }
 
+// partitionKey is the key of the position of a Kafka partition in a checkpoint
+func partitionKey(topic string, partition int32) string {
+	return fmt.Sprintf("%s/%d", topic, partition)
+}
+
 func (i *KafkaInput) String() string {
 	return "Kafka Input: " + i.config.Host + "/" + i.config.Topic
 }
@@ -137,6 +166,9 @@ func (i *KafkaInput) String() string {
 // Close closes this plugin
 func (i *KafkaInput) Close() error {
 	close(i.quit)
+	if i.checkpoint != nil {
+		return i.checkpoint.close()
+	}
 	return nil
 }
 
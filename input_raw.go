@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/buger/goreplay/internal/capture"
 	"github.com/buger/goreplay/internal/tcp"
+	"github.com/buger/goreplay/internal/websocket"
 	"github.com/buger/goreplay/proto"
 	"log"
 	"net"
@@ -40,20 +41,24 @@ func NewRAWInput(address string, config RAWInputConfig) (i *RAWInput) {
 	host, _ports, err := net.SplitHostPort(address)
 	if err != nil {
 		// If we are reading pcap file, no port needed
-		if strings.HasSuffix(address, "pcap") {
+		if capture.IsPcapFile(address) {
 			host = address
 			_ports = "0"
 			err = nil
-		} else if strings.HasPrefix(address, "k8s://") {
+		} else if strings.HasPrefix(address, "k8s://") || strings.HasPrefix(address, "docker://") {
 			portIndex := strings.LastIndex(address, ":")
 			host = address[:portIndex]
 			_ports = address[portIndex+1:]
+		} else if config.Process != "" || config.PID != 0 {
+			// the ports are the ports the process listens on
+			host = address
+			err = nil
 		} else {
 			log.Fatalf("input-raw: error while parsing address: %s", err)
 		}
 	}
 
-	if strings.HasSuffix(host, "pcap") {
+	if capture.IsPcapFile(host) {
 		i.config.Engine = capture.EnginePcapFile
 	}
 
@@ -87,22 +92,56 @@ func (i *RAWInput) PluginRead() (*Message, error) {
 	case <-i.quit:
 		return nil, ErrorStopped
 	case msgTCP = <-i.listener.Messages():
+	}
+
+	msg.SrcPod = i.listener.Pod(msgTCP.SrcAddr)
+	msg.DstPod = i.listener.Pod(msgTCP.DstAddr)
+
+	if msgTCP.Event != tcp.ConnNone {
+		payloadType := map[tcp.ConnEvent]byte{
+			tcp.ConnOpen:  ConnectionOpenPayload,
+			tcp.ConnClose: ConnectionClosePayload,
+			tcp.ConnReset: ConnectionResetPayload,
+		}[msgTCP.Event]
+		msg.Meta, msg.Data = connectionPayload(payloadType, msgTCP.ConnectionID(), msgTCP.Start.UnixNano(), msgTCP.Client(), msgTCP.Server())
+		return &msg, nil
+	}
+
+	if msgTCP.Upgraded() {
+		// a frame of a WebSocket session
 		msg.Data = msgTCP.Data()
+		msg.Meta = framePayloadHeader(msgTCP.UUID(), msgTCP.Start.UnixNano(), msgTCP.End.UnixNano()-msgTCP.Start.UnixNano(),
+			msgTCP.Direction == tcp.DirIncoming, websocket.Opcode(msg.Data))
+		return &msg, nil
+	}
+
+	// the payload above --copy-buffer-size is written to a spill file without being copied in memory
+	data, rest := msgTCP.SplitData(int(Settings.CopyBufferSize))
+	msg.Data = data
+	if len(rest) > 0 {
+		var err error
+		if msg.Spill, err = spillChunks(rest...); err != nil {
+			Debug(1, fmt.Sprintf("[INPUT-RAW] can't spill the payload of %d bytes: %s, truncating it", msgTCP.Length, err))
+		}
 	}
 
 	var msgType byte = ResponsePayload
 	if msgTCP.Direction == tcp.DirIncoming {
 		msgType = RequestPayload
 		if i.config.RealIPHeader != "" {
-			msg.Data = proto.SetHeader(msg.Data, []byte(i.config.RealIPHeader), []byte(msgTCP.SrcAddr))
+			realIP := msgTCP.SrcAddr
+			if msgTCP.ProxyAddr != "" {
+				// the client behind the load balancer
+				realIP = msgTCP.ProxyAddr
+			}
+			msg.Data = proto.SetHeader(msg.Data, []byte(i.config.RealIPHeader), []byte(realIP))
+		}
+		if i.config.K8sMetadataHeader != "" {
+			msg.Data = setPodHeaders(msg.Data, i.config.K8sMetadataHeader, msg.SrcPod, msg.DstPod)
 		}
 	}
 	msg.Meta = payloadHeader(msgType, msgTCP.UUID(), msgTCP.Start.UnixNano(), msgTCP.End.UnixNano()-msgTCP.Start.UnixNano())
 
-	// to be removed....
-	if msgTCP.Truncated {
-		Debug(2, "[INPUT-RAW] message truncated, increase copy-buffer-size")
-	}
 	// to be removed...
 	if msgTCP.TimedOut {
 		Debug(2, "[INPUT-RAW] message timeout reached, increase input-raw-expire")
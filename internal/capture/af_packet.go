@@ -30,3 +30,11 @@ func (h *afpacketHandle) ReadPacketData() (data []byte, ci gopacket.CaptureInfo,
 func (h *afpacketHandle) SetBPFFilter(filter string, snaplen int) (err error) {
 	return fmt.Errorf("Not implemented")
 }
+
+// SetFanout adds the socket to a fanout group, the packets of the interface are spread among its sockets by connection.
+func (h *afpacketHandle) SetFanout(id uint16) error {
+	return fmt.Errorf("Not implemented")
+}
+
+// Close will close afpacket source.
+func (h *afpacketHandle) Close() {}
@@ -75,6 +75,11 @@ func (h *afpacketHandle) SetBPFFilter(filter string, snaplen int) (err error) {
 	return h.TPacket.SetBPF(bpfIns)
 }
 
+// SetFanout adds the socket to a fanout group, the packets of the interface are spread among its sockets by connection.
+func (h *afpacketHandle) SetFanout(id uint16) error {
+	return h.TPacket.SetFanout(afpacket.FanoutHash, id)
+}
+
 // LinkType returns ethernet link type.
 func (h *afpacketHandle) LinkType() layers.LinkType {
 	return layers.LinkTypeEthernet
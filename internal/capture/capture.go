@@ -8,6 +8,7 @@ import (
 	"github.com/buger/goreplay/internal/size"
 	"github.com/buger/goreplay/internal/tcp"
 	"github.com/buger/goreplay/proto"
+	"hash/fnv"
 	"io"
 	"log"
 	"net"
@@ -15,16 +16,14 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
-
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 )
 
 var stats *expvar.Map
@@ -48,26 +47,45 @@ type PcapSetFilter interface {
 // PcapOptions options that can be set on a pcap capture handle,
 // these options take effect on inactive pcap handles
 type PcapOptions struct {
-	BufferTimeout   time.Duration   `json:"input-raw-buffer-timeout"`
-	TimestampType   string          `json:"input-raw-timestamp-type"`
-	BPFFilter       string          `json:"input-raw-bpf-filter"`
-	BufferSize      size.Size       `json:"input-raw-buffer-size"`
-	Promiscuous     bool            `json:"input-raw-promisc"`
-	Monitor         bool            `json:"input-raw-monitor"`
-	Snaplen         bool            `json:"input-raw-override-snaplen"`
-	Engine          EngineType      `json:"input-raw-engine"`
-	VXLANPort       int             `json:"input-raw-vxlan-port"`
-	VXLANVNIs       []int           `json:"input-raw-vxlan-vni"`
-	VLAN            bool            `json:"input-raw-vlan"`
-	VLANVIDs        []int           `json:"input-raw-vlan-vid"`
-	Expire          time.Duration   `json:"input-raw-expire"`
-	TrackResponse   bool            `json:"input-raw-track-response"`
-	Protocol        tcp.TCPProtocol `json:"input-raw-protocol"`
-	RealIPHeader    string          `json:"input-raw-realip-header"`
-	Stats           bool            `json:"input-raw-stats"`
-	AllowIncomplete bool            `json:"input-raw-allow-incomplete"`
-	IgnoreInterface []string        `json:"input-raw-ignore-interface"`
-	Transport       string
+	BufferTimeout     time.Duration   `json:"input-raw-buffer-timeout"`
+	TimestampType     string          `json:"input-raw-timestamp-type"`
+	BPFFilter         string          `json:"input-raw-bpf-filter"`
+	BufferSize        size.Size       `json:"input-raw-buffer-size"`
+	Promiscuous       bool            `json:"input-raw-promisc"`
+	Monitor           bool            `json:"input-raw-monitor"`
+	Snaplen           bool            `json:"input-raw-override-snaplen"`
+	Engine            EngineType      `json:"input-raw-engine"`
+	VXLANPort         int             `json:"input-raw-vxlan-port"`
+	VXLANVNIs         []int           `json:"input-raw-vxlan-vni"`
+	GREKeys           []int           `json:"input-raw-gre-key"`
+	ERSPANSessions    []int           `json:"input-raw-erspan-session"`
+	GenevePort        int             `json:"input-raw-geneve-port"`
+	GeneveVNIs        []int           `json:"input-raw-geneve-vni"`
+	TZSPPort          int             `json:"input-raw-tzsp-port"`
+	VLAN              bool            `json:"input-raw-vlan"`
+	VLANVIDs          []int           `json:"input-raw-vlan-vid"`
+	Expire            time.Duration   `json:"input-raw-expire"`
+	TrackResponse     bool            `json:"input-raw-track-response"`
+	Protocol          tcp.TCPProtocol `json:"input-raw-protocol"`
+	RealIPHeader      string          `json:"input-raw-realip-header"`
+	Stats             bool            `json:"input-raw-stats"`
+	AllowIncomplete   bool            `json:"input-raw-allow-incomplete"`
+	IgnoreInterface   []string        `json:"input-raw-ignore-interface"`
+	TLSKeyLog         string          `json:"input-raw-tls-keylog"`
+	Process           string          `json:"input-raw-process"`
+	PID               int             `json:"input-raw-pid"`
+	K8sMetadata       bool            `json:"input-raw-k8s-metadata"`
+	K8sMetadataHeader string          `json:"input-raw-k8s-metadata-header"`
+	DockerNetns       bool            `json:"input-raw-docker-netns"`
+	Workers           int             `json:"input-raw-workers"`
+	ConnectionEvents  bool            `json:"input-raw-connection-events"`
+	PacketWriter      PacketWriter    `json:"-"`
+	Transport         string          `json:"input-raw-transport"`
+}
+
+// PacketWriter receives every packet read by the listener, see --output-pcap
+type PacketWriter interface {
+	WritePacket(linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte) error
 }
 
 // Listener handle traffic capture, this is its representation.
@@ -83,8 +101,21 @@ type Listener struct {
 	Reading    chan bool // this channel is closed when the listener has started reading packets
 	messages   chan *tcp.Message
 
-	ports []uint16
-	host  string // pcap file name or interface (name, hardware addr, index or ip address)
+	ports   []uint16    // they are the ports the process listens on with --input-raw-process and --input-raw-pid
+	host    string      // pcap file name or interface (name, hardware addr, index or ip address)
+	keyLog  *tcp.KeyLog // secrets used to decrypt TLS connections
+	targets ipWatcher   // pods of a k8s:// input, or containers of a docker:// input
+
+	containers *containerWatcher // containers of a docker:// input
+	netnsPid   int               // pid of the container whose network namespace is captured, see --input-raw-docker-netns
+
+	podMetadata *podWatcher // all the pods, used to find the pods of the messages
+
+	dedup *packetDedup // drops the packets seen on several interfaces
+
+	customFilter bool // the BPF filter was set with --input-raw-bpf-filter
+
+	id uint32 // numbers the listeners of the process, see fanoutID
 
 	closeDone chan struct{}
 	quit      chan struct{}
@@ -94,6 +125,7 @@ type Listener struct {
 type packetHandle struct {
 	handler gopacket.PacketDataSource
 	ips     []net.IP
+	ifi     pcap.Interface // the captured interface, empty for capture files and tunnels
 }
 
 // EngineType ...
@@ -101,11 +133,15 @@ type EngineType uint8
 
 // Available engines for intercepting traffic
 const (
-	EnginePcap EngineType = 1 << iota
+	EnginePcap EngineType = iota + 1
 	EnginePcapFile
 	EngineRawSocket
 	EngineAFPacket
 	EngineVXLAN
+	EngineGRE
+	EngineERSPAN
+	EngineGeneve
+	EngineTZSP
 )
 
 // Set is here so that EngineType can implement flag.Var
@@ -121,6 +157,14 @@ func (eng *EngineType) Set(v string) error {
 		*eng = EngineAFPacket
 	case "vxlan":
 		*eng = EngineVXLAN
+	case "gre":
+		*eng = EngineGRE
+	case "erspan":
+		*eng = EngineERSPAN
+	case "geneve":
+		*eng = EngineGeneve
+	case "tzsp":
+		*eng = EngineTZSP
 	default:
 		return fmt.Errorf("invalid engine %s", v)
 	}
@@ -139,6 +183,14 @@ func (eng *EngineType) String() (e string) {
 		e = "af_packet"
 	case EngineVXLAN:
 		e = "vxlan"
+	case EngineGRE:
+		e = "gre"
+	case EngineERSPAN:
+		e = "erspan"
+	case EngineGeneve:
+		e = "geneve"
+	case EngineTZSP:
+		e = "tzsp"
 	default:
 		e = ""
 	}
@@ -150,6 +202,7 @@ func (eng *EngineType) String() (e string) {
 // if there is an error it will be associated with getting network interfaces
 func NewListener(host string, ports []uint16, config PcapOptions) (l *Listener, err error) {
 	l = &Listener{}
+	l.id = atomic.AddUint32(&listeners, 1)
 
 	l.host = host
 	if l.host == "localhost" {
@@ -158,16 +211,67 @@ func NewListener(host string, ports []uint16, config PcapOptions) (l *Listener,
 	l.ports = ports
 
 	l.config = config
-	l.config.Transport = "tcp"
+	switch l.config.Transport {
+	case "":
+		l.config.Transport = "tcp"
+	case "tcp", "udp":
+	default:
+		return nil, fmt.Errorf("invalid transport %q, expected tcp or udp", l.config.Transport)
+	}
 	l.Handles = make(map[string]packetHandle)
 
+	if l.followsProcess() {
+		if l.ports, err = l.processPorts(); err != nil {
+			return nil, err
+		}
+		if len(l.ports) == 0 {
+			return nil, fmt.Errorf("the process does not listen on any %s port", l.config.Transport)
+		}
+	}
+	l.customFilter = config.BPFFilter != ""
+
 	l.closeDone = make(chan struct{})
 	l.quit = make(chan struct{})
 	l.Reading = make(chan bool)
 	l.messages = make(chan *tcp.Message, 10000)
 
+	if config.TLSKeyLog != "" {
+		if l.keyLog, err = tcp.NewKeyLog(config.TLSKeyLog); err != nil {
+			return nil, fmt.Errorf("TLS key log: %v", err)
+		}
+	}
+
 	if strings.HasPrefix(l.host, "k8s://") {
-		l.config.BPFFilter = l.Filter(pcap.Interface{}, k8sIPs(l.host[6:])...)
+		namespace, options, err := k8sSelector(l.host[6:])
+		if err != nil {
+			return nil, fmt.Errorf("k8s: %v", err)
+		}
+		if l.targets, err = newPodWatcher(namespace, options, true); err != nil {
+			return nil, fmt.Errorf("k8s: %v", err)
+		}
+		l.config.BPFFilter = l.Filter(pcap.Interface{}, l.targets.IPs()...)
+	}
+
+	if strings.HasPrefix(l.host, "docker://") {
+		if l.containers, err = newContainerWatcher(l.host[9:]); err != nil {
+			return nil, fmt.Errorf("docker: %v", err)
+		}
+		l.targets = l.containers
+		if l.config.DockerNetns {
+			// all the traffic of the namespace is the traffic of the container
+			l.config.BPFFilter = l.Filter(pcap.Interface{})
+		} else {
+			l.config.BPFFilter = l.Filter(pcap.Interface{}, l.targets.IPs()...)
+		}
+	} else if l.config.DockerNetns {
+		return nil, fmt.Errorf("--input-raw-docker-netns requires a docker:// input")
+	}
+
+	if config.K8sMetadata || config.K8sMetadataHeader != "" {
+		// the peers of the captured pods can run in any namespace
+		if l.podMetadata, err = newPodWatcher("", metav1.ListOptions{}, false); err != nil {
+			return nil, fmt.Errorf("k8s metadata: %v", err)
+		}
 	}
 
 	switch config.Engine {
@@ -183,6 +287,15 @@ func NewListener(host string, ports []uint16, config PcapOptions) (l *Listener,
 	case EngineVXLAN:
 		l.Activate = l.activateVxLanSocket
 		return
+	case EngineGRE, EngineERSPAN, EngineGeneve, EngineTZSP:
+		l.Activate = l.activateTunnel
+		return
+	}
+
+	if l.config.DockerNetns {
+		// the interfaces are listed in the network namespace of the container when it is activated
+		l.Activate = l.activateContainer(l.Activate)
+		return
 	}
 
 	err = l.setInterfaces()
@@ -197,11 +310,21 @@ func NewListener(host string, ports []uint16, config PcapOptions) (l *Listener,
 // this function must be called after activating pcap handles
 func (l *Listener) Listen(ctx context.Context) (err error) {
 	l.Lock()
+	if l.readsSeveralInterfaces() {
+		l.dedup = newPacketDedup(dedupWindow)
+	}
 	for key, handle := range l.Handles {
 		go l.readHandle(key, handle)
 	}
 	l.Unlock()
 
+	if l.targets != nil {
+		go l.watchTargets()
+	}
+	if l.followsProcess() {
+		go l.watchProcess()
+	}
+
 	go func() {
 		for {
 			time.Sleep(time.Second)
@@ -209,20 +332,9 @@ func (l *Listener) Listen(ctx context.Context) (err error) {
 			if l.closed {
 				return
 			}
-
-			// Check for Pod IP changes
-			if strings.HasPrefix(l.host, "k8s://") {
-				newFilter := l.Filter(pcap.Interface{}, k8sIPs(l.host[6:])...)
-				if newFilter != l.config.BPFFilter {
-					fmt.Println("k8s pods configuration changed, new filter: ", newFilter)
-					for _, h := range l.Handles {
-						if _, ok := h.handler.(PcapSetFilter); ok {
-							h.handler.(PcapSetFilter).SetBPFFilter(newFilter)
-						}
-					}
-
-					l.config.BPFFilter = newFilter
-				}
+			if l.config.DockerNetns {
+				// the network namespace of the container is followed by watchTargets
+				continue
 			}
 
 			var prevInterfaces []string
@@ -246,10 +358,10 @@ func (l *Listener) Listen(ctx context.Context) (err error) {
 					l.Activate()
 
 					for key, handle := range l.Handles {
-						if key == in.Name {
-							fmt.Println("Activating capture on:", in.Name)
+						// with --input-raw-workers, af_packet has several handles per interface, see activateAFPacket
+						if name, _, _ := strings.Cut(key, "#"); name == in.Name {
+							fmt.Println("Activating capture on:", key)
 							go l.readHandle(key, handle)
-							break
 						}
 					}
 					l.Unlock()
@@ -263,11 +375,17 @@ func (l *Listener) Listen(ctx context.Context) (err error) {
 	select {
 	case <-done:
 		close(l.quit) // signal close on all handles
+		l.Lock()
+		l.handlesClosed()
+		l.Unlock()
 		<-l.closeDone // wait all handles to be closed
 		err = ctx.Err()
 	case <-l.closeDone: // all handles closed voluntarily
 	}
 
+	if l.podMetadata != nil {
+		l.podMetadata.Close()
+	}
 	l.closed = true
 	return
 }
@@ -284,79 +402,144 @@ func (l *Listener) ListenBackground(ctx context.Context) chan error {
 	return err
 }
 
-// Allowed format:
-//
-//	[namespace/]pod/[pod_name]
-//	[namespace/]deployment/[deployment_name]
-//	[namespace/]daemonset/[daemonset_name]
-//	[namespace/]labelSelector/[selector]
-//	[namespace/]fieldSelector/[selector]
-func k8sIPs(addr string) []string {
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		panic(err.Error())
-	}
+// ipWatcher follows the IPs of the pods of a k8s:// input, or of the containers of a docker:// input
+type ipWatcher interface {
+	IPs() []string
+	Changed() <-chan struct{} // receives a value when the IPs change
+	Close()
+}
 
-	// creates the clientset
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		panic(err.Error())
-	}
+// watchTargets updates the BPF filter and the IPs of the handles as the pods or containers come and go
+func (l *Listener) watchTargets() {
+	defer l.targets.Close()
+	filter := l.config.BPFFilter
+	for {
+		select {
+		case <-l.quit:
+			return
+		case <-l.closeDone:
+			return
+		case <-l.targets.Changed():
+		}
 
-	sections := strings.Split(addr, "/")
+		if l.config.DockerNetns {
+			l.Lock()
+			if l.containers.Pid() != l.netnsPid {
+				l.enterContainer()
+			}
+			l.Unlock()
+			continue
+		}
 
-	if len(sections) < 2 {
-		panic("Not supported k8s scheme. Allowed values: [namespace/]pod/[pod_name], [namespace/]deployment/[deployment_name], [namespace/]daemonset/[daemonset_name], [namespace/]label/[label-name]/[label-value]")
+		hosts := l.targets.IPs()
+		ips := parseIPs(hosts)
+		l.Lock()
+		if newFilter := l.Filter(pcap.Interface{}, hosts...); newFilter != filter {
+			fmt.Println("k8s pods or docker containers changed, new filter: ", newFilter)
+			filter = newFilter
+			l.setFilters()
+		}
+		for key, h := range l.Handles {
+			h.ips = ips
+			l.Handles[key] = h
+		}
+		l.Unlock()
 	}
+}
+
+// followsProcess tells if the ports are the ports of a process, see --input-raw-process and --input-raw-pid
+func (l *Listener) followsProcess() bool {
+	return l.config.Process != "" || l.config.PID != 0
+}
 
-	// If no namespace passed, assume it is ALL
-	switch sections[0] {
-	case "pod", "deployment", "daemonset", "labelSelector", "fieldSelector":
-		sections = append([]string{""}, sections...)
+// processPorts returns the ports the captured processes listen on
+func (l *Listener) processPorts() ([]uint16, error) {
+	pids := []int{l.config.PID}
+	if l.config.Process != "" {
+		var err error
+		if pids, err = processPIDs(l.config.Process); err != nil {
+			return nil, err
+		}
+		if len(pids) == 0 {
+			return nil, fmt.Errorf("no process named %q", l.config.Process)
+		}
 	}
+	return listeningPorts(pids, l.config.Transport)
+}
 
-	namespace, selectorType, selectorValue := sections[0], sections[1], sections[2]
+// watchProcess updates the BPF filter and the ports of the handles when the captured process listens on other ports
+func (l *Listener) watchProcess() {
+	ticker := time.NewTicker(processRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.quit:
+			return
+		case <-l.closeDone:
+			return
+		case <-ticker.C:
+		}
 
-	labelSelector := ""
-	fieldSelector := ""
+		ports, err := l.processPorts()
+		if err != nil || len(ports) == 0 {
+			// the process is likely restarting, the previous ports are kept meanwhile
+			continue
+		}
 
-	switch selectorType {
-	case "pod":
-		fieldSelector = "metadata.name=" + selectorValue
-	case "deployment":
-		labelSelector = "app=" + selectorValue
-	case "daemonset":
-		labelSelector = "pod-template-generation=1,name=" + selectorValue
-	case "labelSelector":
-		labelSelector = selectorValue
-	case "fieldSelector":
-		fieldSelector = selectorValue
+		l.Lock()
+		if fmt.Sprint(ports) != fmt.Sprint(l.ports) {
+			fmt.Println("the process listens on new ports:", ports)
+			l.ports = ports
+			if !l.customFilter {
+				l.setFilters()
+			}
+		}
+		l.Unlock()
 	}
+}
 
-	pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: labelSelector, FieldSelector: fieldSelector})
-	if err != nil {
-		panic(err.Error())
-	}
+// bpfFilter returns the filter of the handle of an interface, --input-raw-bpf-filter
+// or the filter of the current ports and hosts
+func (l *Listener) bpfFilter(ifi pcap.Interface) string {
+	switch {
+	case l.customFilter:
+		return l.config.BPFFilter
+	case l.config.DockerNetns:
+		return l.Filter(pcap.Interface{})
+	case l.targets != nil:
+		return l.Filter(pcap.Interface{}, l.targets.IPs()...)
+	}
+	return l.Filter(ifi)
+}
 
-	var podIPs []string
-	for _, pod := range pods.Items {
-		for _, podIP := range pod.Status.PodIPs {
-			podIPs = append(podIPs, podIP.IP)
+// setFilters replaces the BPF filter of every handle with the filter of its interface
+func (l *Listener) setFilters() {
+	for _, h := range l.Handles {
+		switch f := h.handler.(type) {
+		case PcapSetFilter:
+			f.SetBPFFilter(l.bpfFilter(h.ifi))
+		case *afpacketHandle:
+			f.SetBPFFilter(l.bpfFilter(h.ifi), 64<<10)
 		}
 	}
-	return podIPs
 }
 
+// noTargetsFilter matches no packet, it is the filter of k8s:// and docker:// inputs without pods or containers
+const noTargetsFilter = "less 1"
+
 // Filter returns automatic filter applied by goreplay
 // to a pcap handle of a specific interface
 func (l *Listener) Filter(ifi pcap.Interface, hosts ...string) (filter string) {
 	// https://www.tcpdump.org/manpages/pcap-filter.7.html
 
 	if len(hosts) == 0 {
-		// If k8s have not found any IPs
-		if strings.HasPrefix(l.host, "k8s://") {
-			hosts = []string{}
-		} else {
+		switch {
+		case l.config.DockerNetns:
+			// all the traffic of the namespace is the traffic of the container
+		case l.targets != nil:
+			// k8s or docker have not found any IPs, nothing is captured until they do
+			return noTargetsFilter
+		default:
 			hosts = []string{l.host}
 
 			if listenAll(l.host) || isDevice(l.host, ifi) {
@@ -465,10 +648,7 @@ func (l *Listener) PcapHandle(ifi pcap.Interface) (handle *pcap.Handle, err erro
 		return nil, fmt.Errorf("PCAP Activate device error: %q, interface: %q", err, ifi.Name)
 	}
 
-	bpfFilter := l.config.BPFFilter
-	if bpfFilter == "" {
-		bpfFilter = l.Filter(ifi)
-	}
+	bpfFilter := l.bpfFilter(ifi)
 	fmt.Println("Interface:", ifi.Name, ". BPF Filter:", bpfFilter)
 	err = handle.SetBPFFilter(bpfFilter)
 	if err != nil {
@@ -487,19 +667,21 @@ func (l *Listener) SocketHandle(ifi pcap.Interface) (handle Socket, err error) {
 	if err = handle.SetPromiscuous(l.config.Promiscuous || l.config.Monitor); err != nil {
 		return nil, fmt.Errorf("promiscuous mode error: %q, interface: %q", err, ifi.Name)
 	}
-	if l.config.BPFFilter == "" {
-		l.config.BPFFilter = l.Filter(ifi)
-	}
-	fmt.Println("BPF Filter: ", l.config.BPFFilter)
-	if err = handle.SetBPFFilter(l.config.BPFFilter); err != nil {
+	bpfFilter := l.bpfFilter(ifi)
+	fmt.Println("BPF Filter: ", bpfFilter)
+	if err = handle.SetBPFFilter(bpfFilter); err != nil {
 		handle.Close()
-		return nil, fmt.Errorf("BPF filter error: %q%s, interface: %q", err, l.config.BPFFilter, ifi.Name)
+		return nil, fmt.Errorf("BPF filter error: %q%s, interface: %q", err, bpfFilter, ifi.Name)
 	}
 	handle.SetLoopbackIndex(int32(l.loopIndex))
 	return
 }
 
+// http1StartHint detects the start of requests and responses. Behind load balancers, the first request
+// of a connection follows a PROXY protocol header, it is removed and the client it announces is kept.
 func http1StartHint(pckt *tcp.Packet) (isRequest, isResponse bool) {
+	tcp.StripProxyHeader(pckt)
+
 	if proto.HasRequestTitle(pckt.Payload) {
 		return true, false
 	}
@@ -521,10 +703,17 @@ func http1EndHint(m *tcp.Message) bool {
 	return proto.HasFullPayload(m, m.PacketData()...) && (req || res)
 }
 
+// http1SplitHint splits the requests of pipelining clients, and the responses to them
+func http1SplitHint(m *tcp.Message) int {
+	return proto.PipelinedLen(m, m.PacketData()...)
+}
+
 func (l *Listener) readHandle(key string, hndl packetHandle) {
 	runtime.LockOSThread()
 
-	defer l.closeHandles(key)
+	defer l.closeHandles(key, hndl.handler)
+	// the handles of a fanout group read the same interface, see activateAFPacket
+	ifi, _, _ := strings.Cut(key, "#")
 	linkSize := 14
 	linkType := int(layers.LinkTypeEthernet)
 	if _, ok := hndl.handler.(*pcap.Handle); ok {
@@ -538,11 +727,36 @@ func (l *Listener) readHandle(key string, hndl packetHandle) {
 		}
 	}
 
-	messageParser := tcp.NewMessageParser(l.messages, l.ports, hndl.ips, l.config.Expire, l.config.AllowIncomplete)
-
-	if l.config.Protocol == tcp.ProtocolHTTP {
-		messageParser.Start = http1StartHint
-		messageParser.End = http1EndHint
+	l.Lock()
+	ports := l.ports
+	l.Unlock()
+	workers := l.config.Workers
+	if _, ok := hndl.handler.(*afpacketHandle); ok {
+		// the connections are already spread among the handles of the fanout group, see activateAFPacket
+		workers = 1
+	}
+	parser := tcp.NewShardedParser(workers, l.messages, ports, hndl.ips, l.config.Expire, l.config.AllowIncomplete)
+
+	for _, messageParser := range parser.Shards() {
+		switch l.config.Protocol {
+		case tcp.ProtocolHTTP:
+			messageParser.Start = http1StartHint
+			messageParser.End = http1EndHint
+			messageParser.Split = http1SplitHint
+			messageParser.Upgrade = websocketUpgradeHint
+		case tcp.ProtocolHTTP2:
+			messageParser.Stream = http2StreamHandler
+		case tcp.ProtocolPostgres:
+			messageParser.Start = pgStartHint
+			messageParser.End = pgEndHint
+		case tcp.ProtocolMySQL:
+			messageParser.Stream = mysqlStreamHandler
+		case tcp.ProtocolRedis:
+			messageParser.Stream = redisStreamHandler
+		}
+		messageParser.TLS = l.keyLog
+		messageParser.UDP = l.config.Transport == "udp"
+		messageParser.Lifecycle = l.config.ConnectionEvents && !messageParser.UDP
 	}
 
 	timer := time.NewTicker(1 * time.Second)
@@ -552,6 +766,13 @@ func (l *Listener) readHandle(key string, hndl packetHandle) {
 		case <-l.quit:
 			return
 		case <-timer.C:
+			if l.targets != nil || l.followsProcess() {
+				// the IPs of the pods or containers and the ports of the process are updated by watchTargets and watchProcess
+				l.Lock()
+				parser.SetIPs(l.Handles[key].ips)
+				parser.SetPorts(l.ports)
+				l.Unlock()
+			}
 			if h, ok := hndl.handler.(PcapStatProvider); ok {
 				s, err := h.Stats()
 				if err == nil {
@@ -563,11 +784,35 @@ func (l *Listener) readHandle(key string, hndl packetHandle) {
 		default:
 			data, ci, err := hndl.handler.ReadPacketData()
 			if err == nil {
+				// capture files can hold packets of several link types
+				if h, ok := hndl.handler.(*pcapFileHandle); ok && int(h.LinkType()) != linkType {
+					linkType = int(h.LinkType())
+					if linkSize, ok = pcapLinkTypeLength(linkType, l.config.VLAN); !ok {
+						stats.Add("unknown_link_type", 1)
+						linkType = -1
+						continue
+					}
+				}
 				if l.config.TimestampType == "go" {
 					ci.Timestamp = time.Now()
 				}
+				if l.config.PacketWriter != nil {
+					if err := l.config.PacketWriter.WritePacket(layers.LinkType(linkType), ci, data); err != nil {
+						stats.Add("pcap_write_error", 1)
+					}
+				}
+
+				if l.dedup != nil {
+					// the packets are parsed once, the invalid ones are counted by the parser
+					if pckt, err := tcp.ParsePacket(data, linkType, linkSize, &ci, false); err == nil {
+						if !l.dedup.duplicate(ifi, pckt) {
+							parser.ParsedPacketHandler(pckt)
+						}
+						continue
+					}
+				}
 
-				messageParser.PacketHandler(&tcp.PcapPacket{
+				parser.PacketHandler(&tcp.PcapPacket{
 					Data:     data,
 					LType:    linkType,
 					LTypeLen: linkSize,
@@ -599,18 +844,86 @@ func (l *Listener) Messages() chan *tcp.Message {
 	return l.messages
 }
 
-func (l *Listener) closeHandles(key string) {
+// Pod returns the metadata of the pod with the given IP, it is nil unless the k8s metadata is enabled
+func (l *Listener) Pod(ip string) *PodInfo {
+	if l.podMetadata == nil {
+		return nil
+	}
+	return l.podMetadata.Pod(ip)
+}
+
+func (l *Listener) closeHandles(key string, handler gopacket.PacketDataSource) {
 	l.Lock()
 	defer l.Unlock()
-	if handle, ok := l.Handles[key]; ok {
+	// the handle is already replaced when the container has a new network namespace, see enterContainer
+	if handle, ok := l.Handles[key]; ok && handle.handler == handler {
 		if c, ok := handle.handler.(io.Closer); ok {
 			c.Close()
 		}
 
 		delete(l.Handles, key)
-		if len(l.Handles) == 0 {
-			close(l.closeDone)
+		l.handlesClosed()
+	}
+}
+
+// handlesClosed signals that all the handles are closed. The handles in the network namespace of a container are closed
+// when the container stops, so the listener waits for the container to be restarted unless it is quitting.
+func (l *Listener) handlesClosed() {
+	if len(l.Handles) > 0 {
+		return
+	}
+	if l.config.DockerNetns {
+		select {
+		case <-l.quit:
+		default:
+			return
+		}
+	}
+	select {
+	case <-l.closeDone:
+	default:
+		close(l.closeDone)
+	}
+}
+
+// activateContainer activates the engine in the network namespace of the container of a docker:// input
+func (l *Listener) activateContainer(activate func() error) func() error {
+	return func() error {
+		pid := l.containers.Pid()
+		if pid == 0 {
+			return fmt.Errorf("docker container %q is not running", l.host[9:])
+		}
+		err := inNetns(pid, func() error {
+			if err := l.setInterfaces(); err != nil {
+				return err
+			}
+			return activate()
+		})
+		if err != nil {
+			return err
 		}
+		l.netnsPid = pid
+		return nil
+	}
+}
+
+// enterContainer replaces the handles of the previous network namespace of the container, after it was restarted
+func (l *Listener) enterContainer() {
+	for key, h := range l.Handles {
+		if c, ok := h.handler.(io.Closer); ok {
+			c.Close()
+		}
+		delete(l.Handles, key)
+	}
+	l.netnsPid = 0
+
+	if err := l.Activate(); err != nil {
+		fmt.Println("docker container changed:", err)
+		return
+	}
+	for key, handle := range l.Handles {
+		fmt.Println("Activating capture on:", key, "of the docker container")
+		go l.readHandle(key, handle)
 	}
 }
 
@@ -630,7 +943,8 @@ func (l *Listener) activatePcap() error {
 		}
 		l.Handles[ifi.Name] = packetHandle{
 			handler: handle,
-			ips:     interfaceIPs(ifi),
+			ips:     l.handleIPs(ifi),
+			ifi:     ifi,
 		}
 	}
 	if len(l.Handles) == 0 {
@@ -651,6 +965,28 @@ func (l *Listener) activateVxLanSocket() error {
 	return nil
 }
 
+func (l *Listener) activateTunnel() (err error) {
+	var handler *tunnelHandle
+	switch l.config.Engine {
+	case EngineGRE:
+		handler, err = newGREHandler(false, l.config.GREKeys)
+	case EngineERSPAN:
+		handler, err = newGREHandler(true, l.config.ERSPANSessions)
+	case EngineGeneve:
+		handler, err = newGeneveHandler(l.config.GenevePort, l.config.GeneveVNIs)
+	case EngineTZSP:
+		handler, err = newTZSPHandler(l.config.TZSPPort)
+	}
+	if err != nil {
+		return err
+	}
+	l.Handles[l.config.Engine.String()] = packetHandle{
+		handler: handler,
+	}
+
+	return nil
+}
+
 func (l *Listener) activateRawSocket() error {
 	if runtime.GOOS != "linux" {
 		return fmt.Errorf("sock_raw is not stabilized on OS other than linux")
@@ -670,7 +1006,8 @@ func (l *Listener) activateRawSocket() error {
 		}
 		l.Handles[ifi.Name] = packetHandle{
 			handler: handle,
-			ips:     interfaceIPs(ifi),
+			ips:     l.handleIPs(ifi),
+			ifi:     ifi,
 		}
 	}
 	if len(l.Handles) == 0 {
@@ -680,9 +1017,9 @@ func (l *Listener) activateRawSocket() error {
 }
 
 func (l *Listener) activatePcapFile() (err error) {
-	var handle *pcap.Handle
+	var handle *pcapFileHandle
 	var e error
-	if handle, e = pcap.OpenOffline(l.host); e != nil {
+	if handle, e = newPcapFileHandle(l.host); e != nil {
 		return fmt.Errorf("open pcap file error: %q", e)
 	}
 
@@ -716,22 +1053,47 @@ func (l *Listener) activateAFPacket() error {
 			continue
 		}
 
-		handle, err := newAfpacketHandle(ifi.Name, szFrame, szBlock, numBlocks, false, pcap.BlockForever)
+		bpfFilter := l.bpfFilter(ifi)
+		fmt.Println("Interface:", ifi.Name, ". BPF Filter:", bpfFilter)
 
-		if err != nil {
-			msg += ("\n" + err.Error())
-			continue
+		// the sockets of a fanout group share the packets of the interface, hashed by connection
+		workers := l.config.Workers
+		if workers < 1 {
+			workers = 1
 		}
+		handles := make(map[string]*afpacketHandle, workers)
+		for i := 0; i < workers; i++ {
+			handle, err := newAfpacketHandle(ifi.Name, szFrame, szBlock, numBlocks, false, pcap.BlockForever)
+			if err == nil && workers > 1 {
+				if err = handle.SetFanout(l.fanoutID(ifi.Name)); err != nil {
+					handle.Close()
+				}
+			}
+			if err != nil {
+				msg += ("\n" + err.Error())
+				break
+			}
+			handle.SetBPFFilter(bpfFilter, 64<<10)
 
-		if l.config.BPFFilter == "" {
-			l.config.BPFFilter = l.Filter(ifi)
+			key := ifi.Name
+			if i > 0 {
+				key = fmt.Sprintf("%s#%d", ifi.Name, i)
+			}
+			handles[key] = handle
+		}
+		if len(handles) != workers {
+			for _, handle := range handles {
+				handle.Close()
+			}
+			continue
 		}
-		fmt.Println("Interface:", ifi.Name, ". BPF Filter:", l.config.BPFFilter)
-		handle.SetBPFFilter(l.config.BPFFilter, 64<<10)
 
-		l.Handles[ifi.Name] = packetHandle{
-			handler: handle,
-			ips:     interfaceIPs(ifi),
+		for key, handle := range handles {
+			l.Handles[key] = packetHandle{
+				handler: handle,
+				ips:     l.handleIPs(ifi),
+				ifi:     ifi,
+			}
 		}
 	}
 
@@ -742,6 +1104,40 @@ func (l *Listener) activateAFPacket() error {
 	return nil
 }
 
+// listeners counts the listeners created by the process
+var listeners uint32
+
+// fanoutGroups are the AF_PACKET fanout groups used by the process
+var fanoutGroups = struct {
+	sync.Mutex
+	ids  map[string]uint16 // by listener and interface
+	used map[uint16]bool
+}{ids: make(map[string]uint16), used: make(map[uint16]bool)}
+
+// fanoutID returns the id of the AF_PACKET fanout group of the handles of the listener on an interface.
+// Groups are shared by all the processes of a network namespace, the pid keeps them apart. Every listener
+// has groups of its own, a socket of another listener would drop the packets its BPF filter doesn't match.
+func (l *Listener) fanoutID(device string) uint16 {
+	key := fmt.Sprintf("%d/%s", l.id, device)
+
+	fanoutGroups.Lock()
+	defer fanoutGroups.Unlock()
+	if id, ok := fanoutGroups.ids[key]; ok {
+		return id
+	}
+
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d/%s", os.Getpid(), key)
+	id := uint16(h.Sum32())
+	// the hashes of two groups of the process can collide
+	for fanoutGroups.used[id] {
+		id++
+	}
+	fanoutGroups.ids[key] = id
+	fanoutGroups.used[id] = true
+	return id
+}
+
 func (l *Listener) setInterfaces() (err error) {
 	var pifis []pcap.Interface
 	pifis, err = pcap.FindAllDevs()
@@ -765,7 +1161,7 @@ func (l *Listener) setInterfaces() (err error) {
 			continue
 		}
 
-		if strings.HasPrefix(l.host, "k8s://") {
+		if l.targets != nil && !l.config.DockerNetns {
 			if !strings.HasPrefix(pi.Name, "veth") {
 				continue
 			}
@@ -846,6 +1242,17 @@ func interfaceAddresses(ifi pcap.Interface) []string {
 	return hosts
 }
 
+// handleIPs returns the IPs of the captured hosts of an interface, they are the IPs of the pods for k8s:// inputs
+func (l *Listener) handleIPs(ifi pcap.Interface) []net.IP {
+	if l.config.DockerNetns {
+		return nil
+	}
+	if l.targets != nil {
+		return parseIPs(l.targets.IPs())
+	}
+	return interfaceIPs(ifi)
+}
+
 func interfaceIPs(ifi pcap.Interface) []net.IP {
 	var ips []net.IP
 	for _, addr := range ifi.Addresses {
@@ -854,6 +1261,50 @@ func interfaceIPs(ifi pcap.Interface) []net.IP {
 	return ips
 }
 
+// readsSeveralInterfaces tells if the same packets can be captured on several handles, see packetDedup
+func (l *Listener) readsSeveralInterfaces() bool {
+	switch l.config.Engine {
+	case EnginePcapFile, EngineVXLAN, EngineGRE, EngineERSPAN, EngineGeneve, EngineTZSP:
+		return false
+	}
+	ownAddresses := l.filtersOwnAddresses()
+	if listenAll(l.host) && !l.config.DockerNetns && !ownAddresses {
+		// interfaces can be added while capturing
+		return true
+	}
+
+	interfaces := make(map[string]bool)
+	for key := range l.Handles {
+		ifi, _, _ := strings.Cut(key, "#")
+		interfaces[ifi] = true
+	}
+	if len(interfaces) < 2 || !ownAddresses {
+		return len(interfaces) > 1
+	}
+
+	// an interface like the loopback only captures the copies of the packets of the addresses it shares
+	addrs := make(map[string]string)
+	for key, h := range l.Handles {
+		ifi, _, _ := strings.Cut(key, "#")
+		if len(h.ifi.Addresses) == 0 {
+			// its filter has no address
+			return true
+		}
+		for _, addr := range interfaceAddresses(h.ifi) {
+			if other, ok := addrs[addr]; ok && other != ifi {
+				return true
+			}
+			addrs[addr] = ifi
+		}
+	}
+	return false
+}
+
+// filtersOwnAddresses tells if the filter of every handle only captures the packets of the addresses of its interface
+func (l *Listener) filtersOwnAddresses() bool {
+	return listenAll(l.host) && l.targets == nil && !l.config.DockerNetns && !l.config.Promiscuous && l.config.BPFFilter == ""
+}
+
 func listenAll(addr string) bool {
 	switch addr {
 	case "", "0.0.0.0", "[::]", "::":
@@ -1,9 +1,46 @@
 package capture
 
 import (
+	"encoding/binary"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/buger/goreplay/internal/tcp"
+
+	"github.com/google/gopacket"
 )
 
+// testPacket builds a raw IPv4 packet between 10.0.0.1:50000 (client) and 10.0.0.2:8080 (server)
+func testPacket(client bool, seq, ack uint32, payload []byte) *tcp.PcapPacket {
+	data := make([]byte, 40+len(payload))
+	ip := data[:20]
+	ip[0] = 4<<4 | 5
+	binary.BigEndian.PutUint16(ip[2:4], uint16(len(data)))
+	ip[9] = 6
+	src, dst := []byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}
+	sport, dport := uint16(50000), uint16(8080)
+	if !client {
+		src, dst, sport, dport = dst, src, dport, sport
+	}
+	copy(ip[12:16], src)
+	copy(ip[16:20], dst)
+
+	t := data[20:40]
+	binary.BigEndian.PutUint16(t[0:2], sport)
+	binary.BigEndian.PutUint16(t[2:4], dport)
+	binary.BigEndian.PutUint32(t[4:8], seq)
+	binary.BigEndian.PutUint32(t[8:12], ack)
+	t[12] = 5 << 4
+	t[13] = 0x18 // PSH, ACK
+	copy(data[40:], payload)
+
+	return &tcp.PcapPacket{
+		Data: data,
+		Ci:   &gopacket.CaptureInfo{Timestamp: time.Now(), Length: len(data), CaptureLength: len(data)},
+	}
+}
+
 func TestSetInterfaces(t *testing.T) {
 	listener := &Listener{
 		loopIndex: 99999,
@@ -20,3 +57,18 @@ func TestSetInterfaces(t *testing.T) {
 		t.Errorf("loopback nic index was not found")
 	}
 }
+
+func TestFanoutID(t *testing.T) {
+	l1 := &Listener{id: atomic.AddUint32(&listeners, 1)}
+	l2 := &Listener{id: atomic.AddUint32(&listeners, 1)}
+
+	if l1.fanoutID("eth0") != l1.fanoutID("eth0") {
+		t.Error("the handles of a listener on an interface should share their fanout group")
+	}
+	if l1.fanoutID("eth0") == l2.fanoutID("eth0") {
+		t.Error("two listeners on an interface should not share a fanout group")
+	}
+	if l1.fanoutID("eth0") == l1.fanoutID("eth1") {
+		t.Error("two interfaces should not share a fanout group")
+	}
+}
@@ -0,0 +1,82 @@
+package capture
+
+import (
+	"hash/maphash"
+	"sync"
+	"time"
+
+	"github.com/buger/goreplay/internal/tcp"
+)
+
+// dedupWindow is how long a packet is remembered, to drop its copies seen on other interfaces
+const dedupWindow = 200 * time.Millisecond
+
+// dedupKey identifies a TCP segment or a UDP datagram, whichever interface it was captured on
+type dedupKey struct {
+	src, dst         [16]byte
+	srcPort, dstPort uint16
+	seq              uint32
+	payload          uint64 // hash of the payload
+}
+
+// dedupShards is the number of independent maps of packetDedup, so that the handles seldom wait for each other
+const dedupShards = 64
+
+// packetDedup drops the copies of the packets seen on several interfaces, like a container bridge and its veth,
+// or the loopback and the interface of a local address. A packet seen again on the same interface is a
+// retransmission and is kept, the parsers handle them.
+type packetDedup struct {
+	window time.Duration
+	seed   maphash.Seed
+	shards [dedupShards]dedupShard // by connection, see tcp.Packet.FlowHash
+}
+
+type dedupShard struct {
+	sync.Mutex
+	current map[dedupKey]string // the interface that saw each packet first
+	prev    map[dedupKey]string // the packets of the previous window, so that the packets are remembered for a whole window
+	rotated time.Time
+}
+
+func newPacketDedup(window time.Duration) *packetDedup {
+	d := &packetDedup{window: window, seed: maphash.MakeSeed()}
+	for i := range d.shards {
+		d.shards[i].current = make(map[dedupKey]string)
+		d.shards[i].prev = make(map[dedupKey]string)
+		d.shards[i].rotated = time.Now()
+	}
+	return d
+}
+
+// duplicate tells if a packet read from an interface is a copy of a packet read from another interface.
+// The handles of a fanout group read the same interface, see activateAFPacket.
+func (d *packetDedup) duplicate(ifi string, pckt *tcp.Packet) bool {
+	var key dedupKey
+	copy(key.src[:], pckt.SrcIP)
+	copy(key.dst[:], pckt.DstIP)
+	key.srcPort, key.dstPort = pckt.SrcPort, pckt.DstPort
+	key.seq = pckt.Seq
+	key.payload = maphash.Bytes(d.seed, pckt.Payload)
+
+	s := &d.shards[pckt.FlowHash()%dedupShards]
+	s.Lock()
+	defer s.Unlock()
+	if now := time.Now(); now.Sub(s.rotated) > d.window {
+		s.prev, s.current = s.current, make(map[dedupKey]string, len(s.current))
+		if now.Sub(s.rotated) > 2*d.window {
+			s.prev = make(map[dedupKey]string)
+		}
+		s.rotated = now
+	}
+
+	first, ok := s.current[key]
+	if !ok {
+		first, ok = s.prev[key]
+	}
+	if ok && first != ifi {
+		stats.Add("packets_duplicate_dropped", 1)
+		return true
+	}
+	s.current[key] = ifi
+	return false
+}
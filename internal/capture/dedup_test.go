@@ -0,0 +1,87 @@
+package capture
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/buger/goreplay/internal/tcp"
+	"github.com/google/gopacket/pcap"
+)
+
+// dedupPacket parses a client packet built by testPacket
+func dedupPacket(t *testing.T, seq uint32, payload string) *tcp.Packet {
+	p := testPacket(true, seq, 1, []byte(payload))
+	pckt, err := tcp.ParsePacket(p.Data, p.LType, p.LTypeLen, p.Ci, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pckt
+}
+
+func TestPacketDedup(t *testing.T) {
+	d := newPacketDedup(50 * time.Millisecond)
+	duplicate := d.duplicate
+	dropped := func() int64 {
+		if v := stats.Get("packets_duplicate_dropped"); v != nil {
+			return v.(interface{ Value() int64 }).Value()
+		}
+		return 0
+	}
+
+	before := dropped()
+	req := dedupPacket(t, 1000, "GET / HTTP/1.1\r\n\r\n")
+	if duplicate("docker0", req) {
+		t.Error("the first packet is not a duplicate")
+	}
+	if !duplicate("veth0", req) {
+		t.Error("the packet seen on another interface should be dropped")
+	}
+	if dropped() != before+1 {
+		t.Errorf("the dropped packets are not counted: %d", dropped()-before)
+	}
+	if duplicate("docker0", req) {
+		t.Error("a retransmission on the same interface is kept")
+	}
+	if duplicate("veth0", dedupPacket(t, 1000, "GET /other HTTP/1.1\r\n\r\n")) {
+		t.Error("a different payload is not a duplicate")
+	}
+	if duplicate("veth0", dedupPacket(t, 2000, "GET / HTTP/1.1\r\n\r\n")) {
+		t.Error("a different sequence is not a duplicate")
+	}
+
+	time.Sleep(120 * time.Millisecond)
+	if duplicate("veth0", req) {
+		t.Error("the packet should be forgotten after the window")
+	}
+}
+
+func TestReadsSeveralInterfaces(t *testing.T) {
+	eth0 := pcap.Interface{Name: "eth0", Addresses: []pcap.InterfaceAddress{{IP: net.IPv4(192, 168, 1, 2)}}}
+	lo := pcap.Interface{Name: "lo", Addresses: []pcap.InterfaceAddress{{IP: net.IPv4(127, 0, 0, 1)}}}
+	docker0 := pcap.Interface{Name: "docker0", Addresses: []pcap.InterfaceAddress{{IP: net.IPv4(192, 168, 1, 2)}}}
+
+	tests := []struct {
+		name     string
+		host     string
+		handles  map[string]packetHandle
+		promisc  bool
+		expected bool
+	}{
+		{"one interface", "eth0", map[string]packetHandle{"eth0": {ifi: eth0}}, false, false},
+		{"fanout group", "eth0", map[string]packetHandle{"eth0#0": {ifi: eth0}, "eth0#1": {ifi: eth0}}, false, false},
+		// the filter of the loopback only captures its own addresses
+		{"loopback", "", map[string]packetHandle{"eth0": {ifi: eth0}, "lo": {ifi: lo}}, false, false},
+		{"shared address", "", map[string]packetHandle{"eth0": {ifi: eth0}, "lo": {ifi: lo}, "docker0": {ifi: docker0}}, false, true},
+		{"promiscuous", "", map[string]packetHandle{"eth0": {ifi: eth0}, "lo": {ifi: lo}}, true, true},
+		{"same host", "10.0.0.1", map[string]packetHandle{"eth0": {ifi: eth0}, "lo": {ifi: lo}}, false, true},
+	}
+
+	for _, tt := range tests {
+		l := &Listener{host: tt.host, Handles: tt.handles}
+		l.config.Promiscuous = tt.promisc
+		if got := l.readsSeveralInterfaces(); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
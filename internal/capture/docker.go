@@ -0,0 +1,243 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dockerTimeout is the maximum time of the requests to the Docker Engine API, except the stream of events
+const dockerTimeout = 10 * time.Second
+
+// dockerSocket is the socket of the Docker Engine API
+var dockerSocket = "/var/run/docker.sock"
+
+// dockerEvents are the events after which the containers are listed again
+var dockerEvents = `{"type":["container","network"],"event":["start","die","destroy","rename","connect","disconnect"]}`
+
+// dockerContainer is a container listed by the Docker Engine API
+type dockerContainer struct {
+	ID              string            `json:"Id"`
+	Names           []string          `json:"Names"`
+	Labels          map[string]string `json:"Labels"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress         string `json:"IPAddress"`
+			GlobalIPv6Address string `json:"GlobalIPv6Address"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// containerWatcher follows the running containers of a docker:// input with the Docker Engine API.
+// The selector is the name of the containers, or one of their labels when it is like key=value.
+type containerWatcher struct {
+	sync.Mutex
+	selector string
+	client   *http.Client
+	ips      []string
+	pid      int           // pid of the first container, used to enter its network namespace
+	changed  chan struct{} // receives a value when the IPs or the pid of the containers change
+	stop     chan struct{}
+}
+
+func newContainerWatcher(selector string) (*containerWatcher, error) {
+	if selector == "" {
+		return nil, fmt.Errorf("missing container name or label, expected docker://<name-or-label>:port")
+	}
+
+	w := &containerWatcher{
+		selector: selector,
+		changed:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	w.client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", dockerSocket)
+		},
+	}}
+	if err := w.update(); err != nil {
+		return nil, err
+	}
+	go w.follow()
+
+	return w, nil
+}
+
+// follow lists the containers again after every event, the stream of events is reopened when it fails
+func (w *containerWatcher) follow() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-w.stop
+		cancel()
+	}()
+
+	for {
+		// events returns when the stream fails, events can have been missed meanwhile
+		w.events(ctx)
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(time.Second):
+		}
+		stats.Add("docker_events_error", 1)
+		if err := w.update(); err != nil {
+			stats.Add("docker_api_error", 1)
+		}
+	}
+}
+
+func (w *containerWatcher) events(ctx context.Context) error {
+	resp, err := w.get(ctx, "/events?filters="+url.QueryEscape(dockerEvents))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event json.RawMessage
+		if err = decoder.Decode(&event); err != nil {
+			return err
+		}
+		if err = w.update(); err != nil {
+			stats.Add("docker_api_error", 1)
+		}
+	}
+}
+
+// update lists the running containers, the first one by name is the one whose network namespace can be captured
+func (w *containerWatcher) update() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerTimeout)
+	defer cancel()
+
+	var containers []dockerContainer
+	if err := w.getJSON(ctx, "/containers/json", &containers); err != nil {
+		return err
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return strings.Join(containers[i].Names, ",") < strings.Join(containers[j].Names, ",")
+	})
+
+	var ips []string
+	var first string
+	for _, c := range containers {
+		if !w.matches(c) {
+			continue
+		}
+		if first == "" {
+			first = c.ID
+		}
+		// containers of the host network have no IP of their own
+		for _, network := range c.NetworkSettings.Networks {
+			for _, ip := range []string{network.IPAddress, network.GlobalIPv6Address} {
+				if ip != "" {
+					ips = append(ips, ip)
+				}
+			}
+		}
+	}
+	sort.Strings(ips)
+
+	var pid int
+	if first != "" {
+		var inspect struct {
+			State struct {
+				Pid int `json:"Pid"`
+			} `json:"State"`
+		}
+		if err := w.getJSON(ctx, "/containers/"+first+"/json", &inspect); err != nil {
+			return err
+		}
+		pid = inspect.State.Pid
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	if strings.Join(ips, ",") == strings.Join(w.ips, ",") && pid == w.pid {
+		return nil
+	}
+	w.ips, w.pid = ips, pid
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (w *containerWatcher) matches(c dockerContainer) bool {
+	if key, value, ok := strings.Cut(w.selector, "="); ok {
+		v, found := c.Labels[key]
+		return found && v == value
+	}
+	for _, name := range c.Names {
+		if strings.TrimPrefix(name, "/") == w.selector {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *containerWatcher) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("docker API %s: %s %s", path, resp.Status, bytes.TrimSpace(body))
+	}
+	return resp, nil
+}
+
+func (w *containerWatcher) getJSON(ctx context.Context, path string, v interface{}) error {
+	resp, err := w.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// IPs returns the IPs of the containers
+func (w *containerWatcher) IPs() []string {
+	w.Lock()
+	defer w.Unlock()
+	return append([]string(nil), w.ips...)
+}
+
+// Pid returns the pid of the first container, or 0 when no container is running
+func (w *containerWatcher) Pid() int {
+	w.Lock()
+	defer w.Unlock()
+	return w.pid
+}
+
+// Changed receives a value when the IPs or the pid of the containers change
+func (w *containerWatcher) Changed() <-chan struct{} {
+	return w.changed
+}
+
+// Close stops following the containers
+func (w *containerWatcher) Close() {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+}
@@ -0,0 +1,170 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDocker serves the containers and the events of the Docker Engine API on a unix socket
+type fakeDocker struct {
+	sync.Mutex
+	containers []map[string]interface{}
+	pids       map[string]int
+	streams    []chan string // streams of events
+}
+
+// event sends an event to the open streams
+func (d *fakeDocker) event(action string) {
+	d.Lock()
+	defer d.Unlock()
+	for _, stream := range d.streams {
+		stream <- action
+	}
+}
+
+func (d *fakeDocker) setContainer(id, name, ip string, pid int, labels map[string]string) {
+	d.Lock()
+	defer d.Unlock()
+	d.containers = append(d.containers, map[string]interface{}{
+		"Id":              id,
+		"Names":           []string{"/" + name},
+		"Labels":          labels,
+		"NetworkSettings": map[string]interface{}{"Networks": map[string]interface{}{"bridge": map[string]string{"IPAddress": ip}}},
+	})
+	d.pids[id] = pid
+}
+
+func (d *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.Lock()
+	defer d.Unlock()
+	switch r.URL.Path {
+	case "/containers/json":
+		json.NewEncoder(w).Encode(d.containers)
+	case "/events":
+		events := make(chan string, 10)
+		d.streams = append(d.streams, events)
+		d.Unlock()
+		defer d.Lock()
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case action := <-events:
+				fmt.Fprintf(w, `{"Type":"container","Action":%q}`+"\n", action)
+				w.(http.Flusher).Flush()
+			}
+		}
+	default:
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/containers/"), "/json")
+		pid, ok := d.pids[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"State":{"Pid":%d}}`, pid)
+	}
+}
+
+func withFakeDocker(t *testing.T) *fakeDocker {
+	docker := &fakeDocker{pids: make(map[string]int)}
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(docker)
+	server.Listener = l
+	server.Start()
+
+	original := dockerSocket
+	dockerSocket = socket
+	t.Cleanup(func() {
+		dockerSocket = original
+		server.Close()
+	})
+	return docker
+}
+
+func TestContainerWatcher(t *testing.T) {
+	docker := withFakeDocker(t)
+	docker.setContainer("bbb", "shop-web-2", "172.18.0.3", 200, map[string]string{"com.docker.compose.service": "web"})
+	docker.setContainer("aaa", "shop-web-1", "172.18.0.2", 100, map[string]string{"com.docker.compose.service": "web"})
+	docker.setContainer("ccc", "shop-db-1", "172.18.0.4", 300, nil)
+
+	byName, err := newContainerWatcher("shop-db-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer byName.Close()
+	if ips := byName.IPs(); len(ips) != 1 || ips[0] != "172.18.0.4" || byName.Pid() != 300 {
+		t.Errorf("wrong container %v %d", ips, byName.Pid())
+	}
+
+	byLabel, err := newContainerWatcher("com.docker.compose.service=web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer byLabel.Close()
+	<-byLabel.Changed()
+	// the network namespace is the one of the first container by name
+	if ips := byLabel.IPs(); len(ips) != 2 || ips[0] != "172.18.0.2" || ips[1] != "172.18.0.3" || byLabel.Pid() != 100 {
+		t.Errorf("wrong containers %v %d", ips, byLabel.Pid())
+	}
+
+	// a container is scaled up, once the watchers follow the events
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		docker.Lock()
+		streams := len(docker.streams)
+		docker.Unlock()
+		if streams == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("events are not followed")
+		}
+	}
+	docker.setContainer("ddd", "shop-web-3", "172.18.0.5", 400, map[string]string{"com.docker.compose.service": "web"})
+	docker.event("start")
+	select {
+	case <-byLabel.Changed():
+	case <-time.After(5 * time.Second):
+		t.Fatal("containers were not updated")
+	}
+	if ips := byLabel.IPs(); len(ips) != 3 || ips[2] != "172.18.0.5" {
+		t.Errorf("wrong containers %v", ips)
+	}
+
+	if _, err = newContainerWatcher(""); err == nil {
+		t.Error("missing selector should fail")
+	}
+}
+
+func TestHandlesClosedInContainer(t *testing.T) {
+	l := &Listener{quit: make(chan struct{}), closeDone: make(chan struct{}), Handles: map[string]packetHandle{}}
+	l.config.DockerNetns = true
+
+	// the handles are closed when the container stops
+	l.handlesClosed()
+	select {
+	case <-l.closeDone:
+		t.Fatal("the listener should wait for the container to be restarted")
+	default:
+	}
+
+	close(l.quit)
+	l.handlesClosed()
+	select {
+	case <-l.closeDone:
+	default:
+		t.Fatal("the listener should be closed when quitting")
+	}
+}
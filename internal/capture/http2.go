@@ -0,0 +1,306 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buger/goreplay/internal/tcp"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+const http2FrameHeaderLen = 9
+
+// http2State is the protocol state of a single HTTP/2 connection
+type http2State struct {
+	preface bool // client connection preface was checked
+
+	// index 0 is the client side of the connection, 1 the server side
+	decoders [2]*hpack.Decoder
+	blocks   [2]http2HeaderBlock
+
+	streams map[uint32]*http2Stream
+}
+
+// http2HeaderBlock is a header block which may be split among HEADERS and CONTINUATION frames
+type http2HeaderBlock struct {
+	streamID  uint32
+	endStream bool
+	discard   bool // PUSH_PROMISE, only decoded to keep the HPACK state in sync
+	fragment  []byte
+}
+
+// http2Stream holds the request and the response of a single HTTP/2 stream
+type http2Stream struct {
+	halves [2]http2Message
+}
+
+type http2Message struct {
+	headers  []hpack.HeaderField
+	trailers []hpack.HeaderField
+	body     []byte
+	start    time.Time
+}
+
+func newHTTP2State() *http2State {
+	state := &http2State{streams: make(map[uint32]*http2Stream)}
+	for i := range state.decoders {
+		state.decoders[i] = hpack.NewDecoder(4096, nil)
+	}
+	return state
+}
+
+func http2Index(dir tcp.Dir) int {
+	if dir == tcp.DirIncoming {
+		return 0
+	}
+	return 1
+}
+
+// http2StreamHandler decodes HTTP/2 (prior knowledge h2c) connections, and emits one message per
+// HTTP/2 stream and direction, converted to the HTTP/1 payload form used by the rest of goreplay.
+func http2StreamHandler(s *tcp.Stream, dir tcp.Dir, data []byte) (consumed int) {
+	state, _ := s.ProtocolState().(*http2State)
+	if state == nil {
+		state = newHTTP2State()
+		s.SetProtocolState(state)
+	}
+
+	if dir == tcp.DirIncoming && !state.preface {
+		if len(data) < len(http2.ClientPreface) && strings.HasPrefix(http2.ClientPreface, string(data)) {
+			return 0 // wait for the rest of the preface
+		}
+		// without the preface we joined an established connection, try our luck with the frames
+		if bytes.HasPrefix(data, []byte(http2.ClientPreface)) {
+			consumed = len(http2.ClientPreface)
+		}
+		state.preface = true
+	}
+
+	for {
+		n := state.frame(s, dir, data[consumed:])
+		if n == 0 {
+			return
+		}
+		consumed += n
+	}
+}
+
+// frame processes the first frame of data and returns its length, or 0 if the frame is not complete
+func (state *http2State) frame(s *tcp.Stream, dir tcp.Dir, data []byte) int {
+	if len(data) < http2FrameHeaderLen {
+		return 0
+	}
+	length := int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+	if len(data) < http2FrameHeaderLen+length {
+		return 0
+	}
+
+	typ := http2.FrameType(data[3])
+	flags := http2.Flags(data[4])
+	id := binary.BigEndian.Uint32(data[5:9]) & (1<<31 - 1)
+	payload := data[http2FrameHeaderLen : http2FrameHeaderLen+length]
+	block := &state.blocks[http2Index(dir)]
+
+	switch typ {
+	case http2.FrameData:
+		payload, ok := http2Unpad(payload, flags.Has(http2.FlagDataPadded))
+		if st, found := state.streams[id]; ok && found {
+			m := &st.halves[http2Index(dir)]
+			m.body = append(m.body, payload...)
+			if flags.Has(http2.FlagDataEndStream) {
+				state.finish(s, dir, id)
+			}
+		}
+	case http2.FrameHeaders:
+		payload, ok := http2Unpad(payload, flags.Has(http2.FlagHeadersPadded))
+		if ok && flags.Has(http2.FlagHeadersPriority) {
+			if len(payload) < 5 {
+				break
+			}
+			payload = payload[5:]
+		}
+		*block = http2HeaderBlock{streamID: id, endStream: flags.Has(http2.FlagHeadersEndStream)}
+		block.fragment = append(block.fragment, payload...)
+		if flags.Has(http2.FlagHeadersEndHeaders) {
+			state.headers(s, dir, block)
+		}
+	case http2.FramePushPromise:
+		payload, ok := http2Unpad(payload, flags.Has(http2.FlagPushPromisePadded))
+		if !ok || len(payload) < 4 {
+			break
+		}
+		*block = http2HeaderBlock{streamID: id, discard: true}
+		block.fragment = append(block.fragment, payload[4:]...)
+		if flags.Has(http2.FlagPushPromiseEndHeaders) {
+			state.headers(s, dir, block)
+		}
+	case http2.FrameContinuation:
+		if block.streamID != id {
+			break
+		}
+		block.fragment = append(block.fragment, payload...)
+		if flags.Has(http2.FlagContinuationEndHeaders) {
+			state.headers(s, dir, block)
+		}
+	case http2.FrameRSTStream:
+		delete(state.streams, id)
+	case http2.FrameSettings:
+		if flags.Has(http2.FlagSettingsAck) {
+			break
+		}
+		for i := 0; i+6 <= len(payload); i += 6 {
+			if http2.SettingID(binary.BigEndian.Uint16(payload[i:])) == http2.SettingHeaderTableSize {
+				// the peer's encoder is allowed to use up to this size
+				state.decoders[1-http2Index(dir)].SetAllowedMaxDynamicTableSize(binary.BigEndian.Uint32(payload[i+2:]))
+			}
+		}
+	}
+
+	return http2FrameHeaderLen + length
+}
+
+func http2Unpad(payload []byte, padded bool) ([]byte, bool) {
+	if !padded {
+		return payload, true
+	}
+	if len(payload) < 1 || int(payload[0]) >= len(payload) {
+		return nil, false
+	}
+	return payload[1 : len(payload)-int(payload[0])], true
+}
+
+// headers decodes a complete header block, decoding errors mean that the HPACK state is lost
+func (state *http2State) headers(s *tcp.Stream, dir tcp.Dir, block *http2HeaderBlock) {
+	fields, err := state.decoders[http2Index(dir)].DecodeFull(block.fragment)
+	id, endStream, discard := block.streamID, block.endStream, block.discard
+	*block = http2HeaderBlock{}
+	if err != nil {
+		stats.Add("http2_hpack_error", 1)
+		delete(state.streams, id)
+		return
+	}
+	if discard {
+		return
+	}
+
+	st, ok := state.streams[id]
+	if !ok {
+		st = new(http2Stream)
+		state.streams[id] = st
+	}
+
+	m := &st.halves[http2Index(dir)]
+	if m.headers == nil {
+		m.headers = fields
+		m.start = s.Timestamp()
+	} else if !http2Informational(m.headers) {
+		m.trailers = append(m.trailers, fields...)
+	} else {
+		// 1xx responses are followed by the final response headers
+		m.headers = fields
+	}
+
+	if endStream {
+		state.finish(s, dir, id)
+	}
+}
+
+func http2Informational(fields []hpack.HeaderField) bool {
+	for _, f := range fields {
+		if f.Name == ":status" {
+			return len(f.Value) == 3 && f.Value[0] == '1'
+		}
+	}
+	return false
+}
+
+// finish emits one direction of the stream, the stream is forgotten once the response is emitted
+func (state *http2State) finish(s *tcp.Stream, dir tcp.Dir, id uint32) {
+	st := state.streams[id]
+	m := &st.halves[http2Index(dir)]
+
+	// same id for the request and its response, unique across connections of the same peers
+	s.Emit(dir, s.ISN(tcp.DirIncoming)+id, http2Payload(m), m.start, s.Timestamp())
+
+	if dir == tcp.DirOutcoming {
+		delete(state.streams, id)
+	} else {
+		st.halves[0] = http2Message{}
+	}
+}
+
+// http2Payload converts the HTTP/2 message to the HTTP/1 payload form, with HTTP/2.0 as version.
+// Trailers are kept by using chunked encoding.
+func http2Payload(m *http2Message) []byte {
+	var title, host string
+	var method, path string
+	buf := new(bytes.Buffer)
+
+	for _, f := range m.headers {
+		switch f.Name {
+		case ":method":
+			method = f.Value
+		case ":path":
+			path = f.Value
+		case ":authority":
+			host = f.Value
+		case ":status":
+			status, _ := strconv.Atoi(f.Value)
+			title = "HTTP/2.0 " + f.Value + " " + http.StatusText(status)
+		}
+	}
+	if title == "" {
+		title = method + " " + path + " HTTP/2.0"
+	}
+
+	buf.WriteString(title + "\r\n")
+	if host != "" {
+		buf.WriteString("Host: " + host + "\r\n")
+	}
+
+	var hasLength bool
+	for _, f := range m.headers {
+		if f.IsPseudo() {
+			continue
+		}
+		if f.Name == "content-length" {
+			hasLength = true
+			continue
+		}
+		buf.WriteString(f.Name + ": " + f.Value + "\r\n")
+	}
+
+	if len(m.trailers) == 0 {
+		if hasLength || len(m.body) > 0 || method == "" {
+			buf.WriteString("Content-Length: " + strconv.Itoa(len(m.body)) + "\r\n")
+		}
+		buf.WriteString("\r\n")
+		buf.Write(m.body)
+		return buf.Bytes()
+	}
+
+	names := make([]string, 0, len(m.trailers))
+	for _, f := range m.trailers {
+		names = append(names, f.Name)
+	}
+	buf.WriteString("Transfer-Encoding: chunked\r\n")
+	buf.WriteString("Trailer: " + strings.Join(names, ", ") + "\r\n\r\n")
+	if len(m.body) > 0 {
+		buf.WriteString(strconv.FormatInt(int64(len(m.body)), 16) + "\r\n")
+		buf.Write(m.body)
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("0\r\n")
+	for _, f := range m.trailers {
+		buf.WriteString(f.Name + ": " + f.Value + "\r\n")
+	}
+	buf.WriteString("\r\n")
+
+	return buf.Bytes()
+}
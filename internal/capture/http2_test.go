@@ -0,0 +1,87 @@
+package capture
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/buger/goreplay/internal/tcp"
+	"github.com/buger/goreplay/proto"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestHTTP2StreamHandler(t *testing.T) {
+	var client, server bytes.Buffer
+	var cbuf, sbuf bytes.Buffer
+	cenc, senc := hpack.NewEncoder(&cbuf), hpack.NewEncoder(&sbuf)
+	block := func(enc *hpack.Encoder, buf *bytes.Buffer, fields ...string) []byte {
+		buf.Reset()
+		for i := 0; i < len(fields); i += 2 {
+			enc.WriteField(hpack.HeaderField{Name: fields[i], Value: fields[i+1]})
+		}
+		return append([]byte(nil), buf.Bytes()...)
+	}
+
+	client.WriteString(http2.ClientPreface)
+	cf := http2.NewFramer(&client, nil)
+	cf.WriteSettings()
+	cf.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, EndHeaders: true, BlockFragment: block(cenc, &cbuf,
+		":method", "POST", ":scheme", "http", ":path", "/pkg.Service/Method", ":authority", "example.com",
+		"content-type", "application/grpc", "te", "trailers",
+	)})
+	cf.WriteData(1, true, []byte{0, 0, 0, 0, 2, 8, 1})
+
+	sf := http2.NewFramer(&server, nil)
+	sf.WriteSettings()
+	sf.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, EndHeaders: true, BlockFragment: block(senc, &sbuf,
+		":status", "200", "content-type", "application/grpc",
+	)})
+	sf.WriteData(1, false, []byte{0, 0, 0, 0, 2, 8, 2})
+	sf.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, EndHeaders: true, EndStream: true, BlockFragment: block(senc, &sbuf,
+		"grpc-status", "0", "grpc-message", "",
+	)})
+
+	parser := tcp.NewMessageParser(nil, []uint16{8080}, nil, time.Second, false)
+	parser.Stream = http2StreamHandler
+
+	c, s := client.Bytes(), server.Bytes()
+	parser.PacketHandler(testPacket(true, 1000, 5000, c[:30]))
+	parser.PacketHandler(testPacket(true, 1030, 5000, c[30:]))
+	// out of order response packets
+	parser.PacketHandler(testPacket(false, 5010, 1000+uint32(len(c)), s[10:]))
+	parser.PacketHandler(testPacket(false, 5000, 1000+uint32(len(c)), s[:10]))
+
+	req := parser.Read()
+	res := parser.Read()
+
+	if req.Direction != tcp.DirIncoming || res.Direction != tcp.DirOutcoming {
+		t.Fatalf("wrong directions %d %d", req.Direction, res.Direction)
+	}
+	if !bytes.Equal(req.UUID(), res.UUID()) {
+		t.Errorf("expected request and response to share the same UUID")
+	}
+
+	data := req.Data()
+	if !bytes.HasPrefix(data, []byte("POST /pkg.Service/Method HTTP/2.0\r\nHost: example.com\r\n")) {
+		t.Errorf("wrong request %q", data)
+	}
+	if !proto.HasRequestTitle(data) || !proto.HasFullPayload(nil, data) {
+		t.Errorf("expected a full HTTP payload %q", data)
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n\r\n\x00\x00\x00\x00\x02\x08\x01")) {
+		t.Errorf("wrong request body %q", data)
+	}
+
+	data = res.Data()
+	if !bytes.HasPrefix(data, []byte("HTTP/2.0 200 OK\r\n")) {
+		t.Errorf("wrong response %q", data)
+	}
+	if string(proto.Header(data, []byte("Trailer"))) != "grpc-status, grpc-message" {
+		t.Errorf("expected trailers to be announced %q", data)
+	}
+	if !proto.HasFullPayload(nil, data) || !bytes.HasSuffix(data, []byte("0\r\ngrpc-status: 0\r\ngrpc-message: \r\n\r\n")) {
+		t.Errorf("expected a full chunked payload with trailers %q", data)
+	}
+}
@@ -0,0 +1,245 @@
+package capture
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// k8sSyncTimeout is the maximum time to wait for the first list of pods
+const k8sSyncTimeout = 30 * time.Second
+
+// k8sClient returns the client of the API server goreplay runs in, tests replace it with a fake clientset
+var k8sClient = func() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// k8sSelector returns the namespace and the selectors of the pods of a k8s:// input.
+// Allowed format:
+//
+//	[namespace/]pod/[pod_name]
+//	[namespace/]deployment/[deployment_name]
+//	[namespace/]daemonset/[daemonset_name]
+//	[namespace/]labelSelector/[selector]
+//	[namespace/]fieldSelector/[selector]
+func k8sSelector(addr string) (namespace string, options metav1.ListOptions, err error) {
+	sections := strings.Split(addr, "/")
+
+	// If no namespace passed, assume it is ALL
+	switch sections[0] {
+	case "pod", "deployment", "daemonset", "labelSelector", "fieldSelector":
+		sections = append([]string{""}, sections...)
+	}
+
+	if len(sections) < 3 {
+		return "", options, fmt.Errorf("not supported k8s scheme %q. Allowed values: [namespace/]pod/[pod_name], [namespace/]deployment/[deployment_name], [namespace/]daemonset/[daemonset_name], [namespace/]labelSelector/[selector], [namespace/]fieldSelector/[selector]", addr)
+	}
+
+	namespace, selectorType, selectorValue := sections[0], sections[1], strings.Join(sections[2:], "/")
+
+	switch selectorType {
+	case "pod":
+		options.FieldSelector = "metadata.name=" + selectorValue
+	case "deployment":
+		options.LabelSelector = "app=" + selectorValue
+	case "daemonset":
+		options.LabelSelector = "pod-template-generation=1,name=" + selectorValue
+	case "labelSelector":
+		options.LabelSelector = selectorValue
+	case "fieldSelector":
+		options.FieldSelector = selectorValue
+	default:
+		return "", options, fmt.Errorf("not supported k8s selector %q", selectorType)
+	}
+	return
+}
+
+// podIPIndex is the name of the informer index of the pods by IP
+const podIPIndex = "ip"
+
+// PodInfo is the metadata of the pod that sent or received a message, see --input-raw-k8s-metadata
+type PodInfo struct {
+	Name      string
+	Namespace string
+	Labels    map[string]string
+	Workload  string // kind and name of the controller of the pod, like Deployment/web
+}
+
+// podWatcher watches pods with an informer. The pods are indexed by IP, so the pod of a message can be looked up,
+// and the IPs of the pods of a k8s:// input are kept up to date.
+type podWatcher struct {
+	sync.Mutex
+	indexer cache.Indexer
+	ips     []string
+	changed chan struct{} // receives a value when the IPs of the pods change
+	stop    chan struct{}
+}
+
+// newPodWatcher watches the pods of a namespace matching the selectors of options, all the namespaces when it is empty.
+// trackIPs keeps the list of IPs returned by IPs up to date.
+func newPodWatcher(namespace string, options metav1.ListOptions, trackIPs bool) (*podWatcher, error) {
+	client, err := k8sClient()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &podWatcher{
+		changed: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = options.LabelSelector
+			o.FieldSelector = options.FieldSelector
+		}))
+	informer := factory.Core().V1().Pods().Informer()
+	err = informer.AddIndexers(cache.Indexers{podIPIndex: func(obj interface{}) ([]string, error) {
+		pod, ok := obj.(*v1.Pod)
+		// pods of the host network share the IP of the node
+		if !ok || pod.Spec.HostNetwork {
+			return nil, nil
+		}
+		var ips []string
+		for _, podIP := range pod.Status.PodIPs {
+			ips = append(ips, podIP.IP)
+		}
+		return ips, nil
+	}})
+	if err != nil {
+		return nil, err
+	}
+	w.indexer = informer.GetIndexer()
+	if trackIPs {
+		_, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(interface{}) { w.update() },
+			UpdateFunc: func(interface{}, interface{}) { w.update() },
+			DeleteFunc: func(interface{}) { w.update() },
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	factory.Start(w.stop)
+
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(k8sSyncTimeout, func() { close(timeout) })
+	defer timer.Stop()
+	if !cache.WaitForCacheSync(timeout, informer.HasSynced) {
+		w.Close()
+		return nil, fmt.Errorf("pods were not listed after %s", k8sSyncTimeout)
+	}
+	if trackIPs {
+		w.update()
+	}
+
+	return w, nil
+}
+
+// update reads the IPs of the pods from the informer store, pods that are done are ignored because their IPs can be reused
+func (w *podWatcher) update() {
+	var ips []string
+	for _, obj := range w.indexer.List() {
+		pod, ok := obj.(*v1.Pod)
+		if !ok || podIsDone(pod) {
+			continue
+		}
+		for _, podIP := range pod.Status.PodIPs {
+			ips = append(ips, podIP.IP)
+		}
+	}
+	sort.Strings(ips)
+
+	w.Lock()
+	defer w.Unlock()
+	if strings.Join(ips, ",") == strings.Join(w.ips, ",") {
+		return
+	}
+	w.ips = ips
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+}
+
+// IPs returns the IPs of the pods
+func (w *podWatcher) IPs() []string {
+	w.Lock()
+	defer w.Unlock()
+	return append([]string(nil), w.ips...)
+}
+
+// Changed receives a value when the IPs of the pods change
+func (w *podWatcher) Changed() <-chan struct{} {
+	return w.changed
+}
+
+// Pod returns the metadata of the pod with the given IP, or nil when there is none
+func (w *podWatcher) Pod(ip string) *PodInfo {
+	objs, err := w.indexer.ByIndex(podIPIndex, ip)
+	if err != nil {
+		return nil
+	}
+	for _, obj := range objs {
+		pod := obj.(*v1.Pod)
+		if podIsDone(pod) {
+			continue
+		}
+		return &PodInfo{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			Labels:    pod.Labels,
+			Workload:  podWorkload(pod),
+		}
+	}
+	return nil
+}
+
+// Close stops watching the pods
+func (w *podWatcher) Close() {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+}
+
+func parseIPs(hosts []string) []net.IP {
+	var ips []net.IP
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+func podIsDone(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
+
+// podWorkload returns the controller of a pod, the deployment of the pods owned by a replica set
+func podWorkload(pod *v1.Pod) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return ""
+	}
+	if hash := pod.Labels["pod-template-hash"]; owner.Kind == "ReplicaSet" && hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+		return "Deployment/" + strings.TrimSuffix(owner.Name, "-"+hash)
+	}
+	return owner.Kind + "/" + owner.Name
+}
@@ -0,0 +1,169 @@
+package capture
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func fakePod(name, ip string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Status:     v1.PodStatus{Phase: v1.PodRunning, PodIPs: []v1.PodIP{{IP: ip}}},
+	}
+}
+
+func withFakeClient(t *testing.T, objects ...*v1.Pod) *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	for _, pod := range objects {
+		client.Tracker().Add(pod)
+	}
+	original := k8sClient
+	k8sClient = func() (kubernetes.Interface, error) { return client, nil }
+	t.Cleanup(func() { k8sClient = original })
+	return client
+}
+
+func TestK8sSelector(t *testing.T) {
+	tests := []struct {
+		addr, namespace, label, field string
+	}{
+		{"default/deployment/web", "default", "app=web", ""},
+		{"pod/web-1", "", "", "metadata.name=web-1"},
+		{"labelSelector/app in (web,api)", "", "app in (web,api)", ""},
+	}
+	for _, tt := range tests {
+		namespace, options, err := k8sSelector(tt.addr)
+		if err != nil || namespace != tt.namespace || options.LabelSelector != tt.label || options.FieldSelector != tt.field {
+			t.Errorf("%s: got %q %q %q %v", tt.addr, namespace, options.LabelSelector, options.FieldSelector, err)
+		}
+	}
+
+	if _, _, err := k8sSelector("default/service/web"); err == nil {
+		t.Error("unknown selector should fail")
+	}
+	if _, _, err := k8sSelector("web"); err == nil {
+		t.Error("missing selector should fail")
+	}
+}
+
+// filterRecorder records the filters set by the listener
+type filterRecorder struct {
+	sync.Mutex
+	filter string
+}
+
+func (f *filterRecorder) SetBPFFilter(filter string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.filter = filter
+	return nil
+}
+
+func (f *filterRecorder) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	select {}
+}
+
+func TestWatchPods(t *testing.T) {
+	client := withFakeClient(t, fakePod("web-1", "10.0.0.1"))
+
+	namespace, options, _ := k8sSelector("default/deployment/web")
+	pods, err := newPodWatcher(namespace, options, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ips := pods.IPs(); len(ips) != 1 || ips[0] != "10.0.0.1" {
+		t.Fatalf("wrong pod IPs %v", ips)
+	}
+
+	recorder := &filterRecorder{}
+	l := &Listener{
+		host:      "k8s://default/deployment/web",
+		ports:     []uint16{80},
+		targets:   pods,
+		quit:      make(chan struct{}),
+		closeDone: make(chan struct{}),
+		Handles:   map[string]packetHandle{"veth0": {handler: recorder}},
+	}
+	l.config.BPFFilter = l.Filter(pcap.Interface{}, pods.IPs()...)
+	defer close(l.quit)
+	go l.watchTargets()
+
+	// a rolling deploy replaces the pod
+	client.CoreV1().Pods("default").Create(context.Background(), fakePod("web-2", "10.0.0.2"), metav1.CreateOptions{})
+	client.CoreV1().Pods("default").Delete(context.Background(), "web-1", metav1.DeleteOptions{})
+
+	expected := l.Filter(pcap.Interface{}, "10.0.0.2")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		recorder.Lock()
+		filter := recorder.filter
+		recorder.Unlock()
+		l.Lock()
+		ips := l.Handles["veth0"].ips
+		l.Unlock()
+		if filter == expected && len(ips) == 1 && ips[0].Equal(net.IPv4(10, 0, 0, 2)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("filter %q and IPs %v were not updated", filter, ips)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFilterWithoutPods(t *testing.T) {
+	withFakeClient(t)
+
+	namespace, options, _ := k8sSelector("default/deployment/web")
+	pods, err := newPodWatcher(namespace, options, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pods.Close()
+
+	l := &Listener{host: "k8s://default/deployment/web", ports: []uint16{80}, targets: pods}
+	if filter := l.Filter(pcap.Interface{}, pods.IPs()...); filter != noTargetsFilter {
+		t.Errorf("expected a filter matching nothing without pods, got %q", filter)
+	}
+}
+
+func TestPodMetadata(t *testing.T) {
+	web := fakePod("web-7848d4b86f-5nxz8", "10.0.0.1")
+	web.Labels["pod-template-hash"] = "7848d4b86f"
+	controller := true
+	web.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-7848d4b86f", Controller: &controller}}
+	node := fakePod("node-exporter", "192.168.1.10")
+	node.Spec.HostNetwork = true
+	done := fakePod("job-1", "10.0.0.3")
+	done.Status.Phase = v1.PodSucceeded
+	withFakeClient(t, web, node, done)
+
+	pods, err := newPodWatcher("", metav1.ListOptions{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pods.Close()
+
+	pod := pods.Pod("10.0.0.1")
+	if pod == nil || pod.Name != web.Name || pod.Namespace != "default" || pod.Workload != "Deployment/web" || pod.Labels["app"] != "web" {
+		t.Errorf("wrong pod %+v", pod)
+	}
+	for _, ip := range []string{"192.168.1.10", "10.0.0.3", "10.0.0.4"} {
+		if pod := pods.Pod(ip); pod != nil {
+			t.Errorf("%s: unexpected pod %+v", ip, pod)
+		}
+	}
+	if len(pods.IPs()) != 0 {
+		t.Error("IPs should not be tracked")
+	}
+}
@@ -0,0 +1,137 @@
+package capture
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/buger/goreplay/internal/mysql"
+	"github.com/buger/goreplay/internal/tcp"
+)
+
+const (
+	mysqlUnknown   = iota // the beginning of the connection was not seen yet
+	mysqlHandshake        // connection phase, nothing is emitted
+	mysqlCommands
+	mysqlEncrypted // TLS was negotiated, the connection can not be decoded
+)
+
+// mysqlState is the protocol state of a single MySQL connection
+type mysqlState struct {
+	phase        int
+	capabilities uint32
+	commands     uint32 // number of commands seen, used to pair commands and responses
+
+	request      []byte
+	requestStart time.Time
+
+	pending       []mysqlPending // commands waiting for their response
+	response      []byte
+	responseStart time.Time
+}
+
+type mysqlPending struct {
+	id   uint32
+	resp *mysql.Response
+}
+
+// mysqlStreamHandler splits MySQL connections into one message per command, and one per response
+// with its whole result set. Messages keep the MySQL packets as they were sent.
+func mysqlStreamHandler(s *tcp.Stream, dir tcp.Dir, data []byte) (consumed int) {
+	state, _ := s.ProtocolState().(*mysqlState)
+	if state == nil {
+		state = new(mysqlState)
+		s.SetProtocolState(state)
+	}
+
+	for state.phase != mysqlEncrypted {
+		payload, seq, n, ok := mysql.Packet(data[consumed:])
+		if !ok {
+			return
+		}
+		if dir == tcp.DirIncoming {
+			state.clientPacket(s, payload, seq, data[consumed:consumed+n])
+		} else {
+			state.serverPacket(s, payload, seq, data[consumed:consumed+n])
+		}
+		consumed += n
+	}
+
+	return len(data)
+}
+
+func (state *mysqlState) clientPacket(s *tcp.Stream, payload []byte, seq byte, raw []byte) {
+	if state.phase == mysqlUnknown {
+		state.phase = mysqlCommands
+		if seq == 1 {
+			state.phase = mysqlHandshake
+		}
+	}
+
+	if state.phase == mysqlHandshake {
+		if seq == 1 && len(payload) >= 4 {
+			state.capabilities = binary.LittleEndian.Uint32(payload)
+			// an SSL request is a truncated handshake response
+			if state.capabilities&mysql.ClientSSL != 0 && len(payload) == 32 {
+				state.phase = mysqlEncrypted
+			}
+		}
+		return
+	}
+
+	// commands start with sequence 0, the rest is LOCAL INFILE data
+	if len(state.request) == 0 && seq != 0 {
+		return
+	}
+	if len(state.request) == 0 {
+		state.requestStart = s.Start(tcp.DirIncoming)
+	}
+	state.request = append(state.request, raw...)
+	if len(payload) == mysql.MaxPacketLen {
+		return
+	}
+
+	var command byte
+	if len(state.request) > 4 {
+		command = state.request[4]
+	}
+	id := s.ISN(tcp.DirIncoming) + state.commands
+	state.commands++
+	if mysql.HasResponse(command) {
+		deprecateEOF := state.capabilities&mysql.ClientDeprecateEOF != 0
+		state.pending = append(state.pending, mysqlPending{id, mysql.NewResponse(command, deprecateEOF)})
+	}
+
+	s.Emit(tcp.DirIncoming, id, state.request, state.requestStart, s.Timestamp())
+	state.request = nil
+}
+
+func (state *mysqlState) serverPacket(s *tcp.Stream, payload []byte, seq byte, raw []byte) {
+	switch state.phase {
+	case mysqlUnknown:
+		if seq == 0 && len(payload) > 0 && payload[0] == 10 {
+			state.phase = mysqlHandshake
+		}
+		return
+	case mysqlHandshake:
+		if seq > 1 && len(payload) > 0 && payload[0] == 0x00 {
+			state.phase = mysqlCommands
+		}
+		return
+	}
+
+	if len(state.pending) == 0 {
+		return
+	}
+	if len(state.response) == 0 {
+		state.responseStart = s.Start(tcp.DirOutcoming)
+	}
+	state.response = append(state.response, raw...)
+
+	cmd := state.pending[0]
+	if !cmd.resp.Add(payload) {
+		return
+	}
+	state.pending = state.pending[1:]
+	s.Emit(tcp.DirOutcoming, cmd.id, state.response, state.responseStart, s.Timestamp())
+	state.response = nil
+}
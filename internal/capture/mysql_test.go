@@ -0,0 +1,71 @@
+package capture
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/buger/goreplay/internal/mysql"
+	"github.com/buger/goreplay/internal/tcp"
+)
+
+func mysqlPackets(seq byte, payloads ...[]byte) []byte {
+	var data []byte
+	for _, p := range payloads {
+		data = mysql.AppendPacket(data, seq, p)
+		seq++
+	}
+	return data
+}
+
+func TestMySQLStreamHandler(t *testing.T) {
+	greeting := mysqlPackets(0, []byte("\x0a8.0.36\x00\x01\x00\x00\x00abcdefgh\x00\xff\xff\x2d\x02\x00\xff\xdf\x15\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00ijklmnopqrst\x00mysql_native_password\x00"))
+	login := mysqlPackets(1, []byte("\x0d\xa2\x0a\x00\x00\x00\x00\x01\x2d\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00app\x00\x00"))
+	ok := mysqlPackets(2, []byte{0, 0, 0, 2, 0, 0, 0})
+
+	query := mysqlPackets(0, []byte("\x03select 1"))
+	result := mysqlPackets(1, []byte{1}, []byte("\x03def\x00\x00\x00\x011\x00\x0c\x3f\x00\x01\x00\x00\x00\x08\x81\x00\x00\x00\x00"),
+		[]byte{0xfe, 0, 0, 2, 0}, []byte{1, '1'}, []byte{0xfe, 0, 0, 2, 0})
+	closeStmt := mysqlPackets(0, []byte{mysql.ComStmtClose, 1, 0, 0, 0})
+	ping := mysqlPackets(0, []byte{mysql.ComPing})
+	pong := mysqlPackets(1, []byte{0, 0, 0, 2, 0, 0, 0})
+
+	parser := tcp.NewMessageParser(nil, []uint16{8080}, nil, time.Second, false)
+	parser.Stream = mysqlStreamHandler
+
+	cseq, sseq := uint32(1000), uint32(5000)
+	send := func(client bool, data []byte) {
+		if client {
+			parser.PacketHandler(testPacket(true, cseq, sseq, data))
+			cseq += uint32(len(data))
+		} else {
+			parser.PacketHandler(testPacket(false, sseq, cseq, data))
+			sseq += uint32(len(data))
+		}
+	}
+	send(false, greeting)
+	send(true, login)
+	send(false, ok)
+	send(true, query)
+	// the result set is split in the middle of a packet
+	send(false, result[:10])
+	send(false, result[10:])
+	send(true, append(closeStmt, ping...))
+	send(false, pong)
+
+	var messages []*tcp.Message
+	for _, payload := range [][]byte{query, result, closeStmt, ping, pong} {
+		m := parser.Read()
+		if !bytes.Equal(m.Data(), payload) {
+			t.Errorf("expected %q to equal %q", m.Data(), payload)
+		}
+		messages = append(messages, m)
+	}
+
+	if !bytes.Equal(messages[0].UUID(), messages[1].UUID()) || !bytes.Equal(messages[3].UUID(), messages[4].UUID()) {
+		t.Error("expected commands and their responses to share the same UUID")
+	}
+	if bytes.Equal(messages[0].UUID(), messages[3].UUID()) {
+		t.Error("expected commands to have different UUIDs")
+	}
+}
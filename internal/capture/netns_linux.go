@@ -0,0 +1,47 @@
+//go:build linux
+
+package capture
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// inNetns runs fn in the network namespace of the process pid, the sockets opened by fn stay in that namespace.
+// fn runs on its own locked thread, which is terminated if it can not go back to its namespace.
+func inNetns(pid int, fn func() error) error {
+	errCh := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		self, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+		if err != nil {
+			runtime.UnlockOSThread()
+			errCh <- err
+			return
+		}
+		defer self.Close()
+		target, err := os.Open(fmt.Sprintf("/proc/%d/ns/net", pid))
+		if err != nil {
+			runtime.UnlockOSThread()
+			errCh <- err
+			return
+		}
+		defer target.Close()
+
+		if err = unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			errCh <- fmt.Errorf("entering the network namespace of process %d: %v", pid, err)
+			return
+		}
+		err = fn()
+		if e := unix.Setns(int(self.Fd()), unix.CLONE_NEWNET); e == nil {
+			runtime.UnlockOSThread()
+		}
+		errCh <- err
+	}()
+	return <-errCh
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package capture
+
+import "errors"
+
+// inNetns runs fn in the network namespace of the process pid
+func inNetns(_ int, _ func() error) error {
+	return errors.New("network namespaces are only available on linux")
+}
@@ -0,0 +1,303 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// pcapSnaplen is the snapshot length used to compile the filters of capture files
+const pcapSnaplen = 262144
+
+// pcapngMagic is the block type of the section header, which starts every pcapng file
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// IsPcapFile checks if the host of input-raw is a capture file (pcap, pcapng, optionally gzipped),
+// a glob of capture files or a directory of capture files
+func IsPcapFile(host string) bool {
+	if strings.ContainsAny(host, "*?[") {
+		return true
+	}
+	if strings.ContainsAny(host, `/\`) {
+		if info, err := os.Stat(host); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return isPcapName(host)
+}
+
+func isPcapName(name string) bool {
+	name = strings.TrimSuffix(name, ".gz")
+	return strings.HasSuffix(name, "pcap") || strings.HasSuffix(name, "pcapng") || strings.HasSuffix(name, ".cap")
+}
+
+// pcapFilePaths returns the capture files of a path, a glob or a directory
+func pcapFilePaths(path string) (paths []string, err error) {
+	if strings.ContainsAny(path, "*?[") {
+		if paths, err = filepath.Glob(path); err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no file matches %q", path)
+		}
+		return paths, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && isPcapName(entry.Name()) {
+			paths = append(paths, filepath.Join(path, entry.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no capture file in %q", path)
+	}
+	return paths, nil
+}
+
+// pcapFileSource reads the packets of a single capture file
+type pcapFileSource struct {
+	path  string
+	first time.Time // timestamp of the first packet
+
+	file     *os.File
+	reader   gopacket.PacketDataSource
+	linkType func(ci gopacket.CaptureInfo) layers.LinkType
+
+	// the next packet of the file
+	data []byte
+	ci   gopacket.CaptureInfo
+	lt   layers.LinkType
+}
+
+// open opens the file and reads its first packet
+func (s *pcapFileSource) open() (err error) {
+	if s.file, err = os.Open(s.path); err != nil {
+		return err
+	}
+	if err = s.openReader(); err != nil {
+		s.close()
+		return fmt.Errorf("%s: %v", s.path, err)
+	}
+	if err = s.next(); err != nil {
+		s.close()
+		return err
+	}
+	return nil
+}
+
+func (s *pcapFileSource) openReader() error {
+	r := bufio.NewReaderSize(s.file, 64<<10)
+	if magic, _ := r.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		r = bufio.NewReaderSize(gz, 64<<10)
+	}
+
+	if magic, _ := r.Peek(4); bytes.Equal(magic, pcapngMagic) {
+		// every interface of a pcapng file has its own link type
+		ng, err := pcapgo.NewNgReader(r, pcapgo.NgReaderOptions{WantMixedLinkType: true, SkipUnknownVersion: true})
+		if err != nil {
+			return err
+		}
+		s.reader = ng
+		s.linkType = func(ci gopacket.CaptureInfo) layers.LinkType {
+			if len(ci.AncillaryData) > 0 {
+				if linkType, ok := ci.AncillaryData[0].(layers.LinkType); ok {
+					return linkType
+				}
+			}
+			return ng.LinkType()
+		}
+		return nil
+	}
+
+	pr, err := pcapgo.NewReader(r)
+	if err != nil {
+		return err
+	}
+	s.reader = pr
+	s.linkType = func(gopacket.CaptureInfo) layers.LinkType { return pr.LinkType() }
+	return nil
+}
+
+// next reads the next packet of the file
+func (s *pcapFileSource) next() (err error) {
+	if s.data, s.ci, err = s.reader.ReadPacketData(); err != nil {
+		return err
+	}
+	s.lt = s.linkType(s.ci)
+	return nil
+}
+
+func (s *pcapFileSource) close() {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+// pcapFileHandle reads the packets of several capture files in timestamp order.
+// Files are only opened when their first packet is due, so that long series of rotated
+// captures are not all opened at the same time.
+type pcapFileHandle struct {
+	pending  []*pcapFileSource // files not opened yet, sorted by their first packet
+	open     []*pcapFileSource // files being read, with their next packet
+	filter   string
+	bpf      map[layers.LinkType]*pcap.BPF
+	linkType layers.LinkType // link type of the last packet read
+}
+
+// newPcapFileHandle opens the capture files of path, which can be a glob or a directory
+func newPcapFileHandle(path string) (*pcapFileHandle, error) {
+	paths, err := pcapFilePaths(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &pcapFileHandle{bpf: make(map[layers.LinkType]*pcap.BPF)}
+	for _, path := range paths {
+		s := &pcapFileSource{path: path}
+		if err = s.open(); err == io.EOF {
+			// empty capture
+			continue
+		}
+		if err != nil {
+			h.Close()
+			return nil, err
+		}
+		s.first = s.ci.Timestamp
+		s.close()
+		h.pending = append(h.pending, s)
+	}
+	if len(h.pending) == 0 {
+		return nil, fmt.Errorf("no packet in %q", path)
+	}
+
+	sort.SliceStable(h.pending, func(i, j int) bool {
+		return h.pending[i].first.Before(h.pending[j].first)
+	})
+	h.linkType = h.pending[0].lt
+
+	return h, nil
+}
+
+// LinkType returns the link type of the last packet read
+func (h *pcapFileHandle) LinkType() layers.LinkType {
+	return h.linkType
+}
+
+// SetBPFFilter sets the filter of the packets, it is compiled for each link type of the files
+func (h *pcapFileHandle) SetBPFFilter(filter string) error {
+	h.filter = filter
+	h.bpf = make(map[layers.LinkType]*pcap.BPF)
+	if filter == "" {
+		return nil
+	}
+	_, err := h.compile(h.linkType)
+	return err
+}
+
+func (h *pcapFileHandle) compile(linkType layers.LinkType) (*pcap.BPF, error) {
+	if bpf, ok := h.bpf[linkType]; ok {
+		return bpf, nil
+	}
+	bpf, err := pcap.NewBPF(linkType, pcapSnaplen, h.filter)
+	if err != nil {
+		return nil, err
+	}
+	h.bpf[linkType] = bpf
+	return bpf, nil
+}
+
+func (h *pcapFileHandle) matches(linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte) bool {
+	if h.filter == "" {
+		return true
+	}
+	bpf, err := h.compile(linkType)
+	if err != nil {
+		stats.Add("pcap_file_filter_error", 1)
+		return false
+	}
+	return bpf.Matches(ci, data)
+}
+
+// ReadPacketData returns the packet with the lowest timestamp among the files
+func (h *pcapFileHandle) ReadPacketData() (data []byte, ci gopacket.CaptureInfo, err error) {
+	for {
+		next := h.nextOpen()
+		for len(h.pending) > 0 && (next < 0 || !h.pending[0].first.After(h.open[next].ci.Timestamp)) {
+			s := h.pending[0]
+			h.pending = h.pending[1:]
+			if err = s.open(); err != nil {
+				stats.Add("pcap_file_error", 1)
+				continue
+			}
+			h.open = append(h.open, s)
+			next = h.nextOpen()
+		}
+		if next < 0 {
+			return nil, ci, io.EOF
+		}
+
+		s := h.open[next]
+		data, ci, linkType := s.data, s.ci, s.lt
+		if err = s.next(); err != nil {
+			if err != io.EOF {
+				stats.Add("pcap_file_error", 1)
+			}
+			s.close()
+			h.open = append(h.open[:next], h.open[next+1:]...)
+		}
+
+		if h.matches(linkType, ci, data) {
+			h.linkType = linkType
+			return data, ci, nil
+		}
+	}
+}
+
+// nextOpen returns the index of the open file with the earliest packet, or -1
+func (h *pcapFileHandle) nextOpen() int {
+	next := -1
+	for i, s := range h.open {
+		if next < 0 || s.ci.Timestamp.Before(h.open[next].ci.Timestamp) {
+			next = i
+		}
+	}
+	return next
+}
+
+// Close closes the files
+func (h *pcapFileHandle) Close() error {
+	for _, s := range h.open {
+		s.close()
+	}
+	h.open, h.pending = nil, nil
+	return nil
+}
@@ -0,0 +1,94 @@
+package capture
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+var pcapFileStart = time.Unix(1700000000, 0)
+
+func pcapFileCI(ms int, length int, ifi int) gopacket.CaptureInfo {
+	return gopacket.CaptureInfo{
+		Timestamp:      pcapFileStart.Add(time.Duration(ms) * time.Millisecond),
+		CaptureLength:  length,
+		Length:         length,
+		InterfaceIndex: ifi,
+	}
+}
+
+func TestPcapFileHandle(t *testing.T) {
+	dir := t.TempDir()
+
+	// pcapng with an ethernet and a linux cooked interface
+	f, err := os.Create(filepath.Join(dir, "a.pcapng"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ng, err := pcapgo.NewNgWriterInterface(f, pcapgo.NgInterface{LinkType: layers.LinkTypeEthernet, SnapLength: 65536}, pcapgo.DefaultNgWriterOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sll, _ := ng.AddInterface(pcapgo.NgInterface{LinkType: layers.LinkTypeLinuxSLL, SnapLength: 65536})
+	ng.WritePacket(pcapFileCI(10, 1, 0), []byte{1})
+	ng.WritePacket(pcapFileCI(30, 1, sll), []byte{3})
+	ng.Flush()
+	f.Close()
+
+	// gzipped pcap, interleaved with the first file
+	f, _ = os.Create(filepath.Join(dir, "b.pcap.gz"))
+	gz := gzip.NewWriter(f)
+	w := pcapgo.NewWriterNanos(gz)
+	w.WriteFileHeader(65536, layers.LinkTypeRaw)
+	w.WritePacket(pcapFileCI(20, 1, 0), []byte{2})
+	w.WritePacket(pcapFileCI(40, 1, 0), []byte{4})
+	gz.Close()
+	f.Close()
+
+	// starts after the others, and is not opened before
+	f, _ = os.Create(filepath.Join(dir, "0.pcap"))
+	w = pcapgo.NewWriterNanos(f)
+	w.WriteFileHeader(65536, layers.LinkTypeEthernet)
+	w.WritePacket(pcapFileCI(50, 1, 0), []byte{5})
+	f.Close()
+
+	// ignored, not a capture file
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644)
+
+	if !IsPcapFile(dir) || !IsPcapFile(filepath.Join(dir, "*.pcap*")) || !IsPcapFile("dump.pcapng.gz") || IsPcapFile("localhost") {
+		t.Error("wrong capture file detection")
+	}
+
+	h, err := newPcapFileHandle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	expected := []layers.LinkType{layers.LinkTypeEthernet, layers.LinkTypeRaw, layers.LinkTypeLinuxSLL, layers.LinkTypeRaw, layers.LinkTypeEthernet}
+	for i, linkType := range expected {
+		data, ci, err := h.ReadPacketData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != byte(i+1) || h.LinkType() != linkType {
+			t.Errorf("%d: wrong packet %v with link type %v", i, data, h.LinkType())
+		}
+		if !ci.Timestamp.Equal(pcapFileStart.Add(time.Duration(i+1) * 10 * time.Millisecond)) {
+			t.Errorf("%d: wrong timestamp %v", i, ci.Timestamp)
+		}
+		if i == 3 && len(h.pending) != 1 {
+			t.Errorf("the last file should not be opened yet, %d files pending", len(h.pending))
+		}
+	}
+	if _, _, err = h.ReadPacketData(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
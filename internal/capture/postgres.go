@@ -0,0 +1,169 @@
+package capture
+
+import (
+	"encoding/binary"
+
+	"github.com/buger/goreplay/internal/tcp"
+)
+
+// PostgreSQL startup packets have no message type, they are identified by their protocol code
+const (
+	pgProtocolVersion   = 196608 // 3.0
+	pgCancelRequestCode = 80877102
+	pgSSLRequestCode    = 80877103
+	pgGSSENCRequestCode = 80877104
+)
+
+// Message types which are only sent by one side, the others (like 'D', 'S' or 'E')
+// do not tell the direction of a packet.
+const (
+	pgFrontendTypes = "QPBFXpf"
+	pgBackendTypes  = "RKZTN123nstIAGWVv"
+)
+
+// pgState tracks the framing of a message across its packets, so that every End hint call
+// only walks the packets that were not walked yet.
+type pgState struct {
+	packets int    // number of packets walked
+	lastSeq uint32 // Seq of the last walked packet
+	startup bool   // the first message has no type
+	header  []byte // header of the current message, which may be split among packets
+	skip    int    // bytes left in the current message
+	typ     byte   // type of the last message, 0 for startup messages
+	auth    uint32 // authentication code of the last 'R' message
+}
+
+func pgStartup(payload []byte) bool {
+	if len(payload) < 8 || payload[0] != 0 {
+		return false
+	}
+	switch binary.BigEndian.Uint32(payload[4:8]) {
+	case pgProtocolVersion, pgCancelRequestCode, pgSSLRequestCode, pgGSSENCRequestCode:
+		return binary.BigEndian.Uint32(payload[0:4]) >= 8
+	}
+	return false
+}
+
+func pgStartHint(pckt *tcp.Packet) (isRequest, isResponse bool) {
+	if pgStartup(pckt.Payload) {
+		return true, false
+	}
+	if len(pckt.Payload) < 5 || binary.BigEndian.Uint32(pckt.Payload[1:5]) < 4 {
+		return false, false
+	}
+
+	for i := 0; i < len(pgFrontendTypes); i++ {
+		if pckt.Payload[0] == pgFrontendTypes[i] {
+			return true, false
+		}
+	}
+	for i := 0; i < len(pgBackendTypes); i++ {
+		if pckt.Payload[0] == pgBackendTypes[i] {
+			return false, true
+		}
+	}
+
+	// No request or response detected
+	return false, false
+}
+
+// pgEndHint checks that all the messages are complete, and that the last one waits for the other side:
+// a query, Sync or Flush for the client, ReadyForQuery or an authentication request for the server.
+func pgEndHint(m *tcp.Message) bool {
+	if m.MissingChunk() {
+		return false
+	}
+
+	packets := m.Packets()
+	dir := m.Direction
+	if dir == tcp.DirUnknown {
+		if req, res := pgStartHint(packets[0]); req {
+			dir = tcp.DirIncoming
+		} else if res {
+			dir = tcp.DirOutcoming
+		} else {
+			return false
+		}
+	}
+
+	// answer to SSLRequest or GSSENCRequest
+	if dir == tcp.DirOutcoming && m.Length == 1 && (packets[0].Payload[0] == 'S' || packets[0].Payload[0] == 'N') {
+		return true
+	}
+
+	state, _ := m.ProtocolState().(*pgState)
+	// packets inserted before the walked ones invalidate the state
+	if state == nil || state.packets > len(packets) || packets[state.packets-1].Seq != state.lastSeq {
+		state = &pgState{startup: dir == tcp.DirIncoming && pgStartup(packets[0].Payload)}
+		m.SetProtocolState(state)
+	}
+	for _, p := range packets[state.packets:] {
+		state.walk(p.Payload)
+	}
+	state.packets = len(packets)
+	state.lastSeq = packets[len(packets)-1].Seq
+
+	if state.skip > 0 || len(state.header) > 0 {
+		return false
+	}
+
+	if dir == tcp.DirIncoming {
+		switch state.typ {
+		case 0, 'Q', 'S', 'H', 'F', 'X', 'p', 'c', 'f':
+			return true
+		}
+		return false
+	}
+
+	switch state.typ {
+	case 'Z', 'G', 'W':
+		return true
+	case 'R':
+		// AuthenticationOk and SASLFinal are followed by more messages
+		return state.auth != 0 && state.auth != 12
+	}
+	return false
+}
+
+// walk goes through the message headers of data, skipping their bodies
+func (state *pgState) walk(data []byte) {
+	for len(data) > 0 {
+		if state.skip > 0 {
+			n := min(state.skip, len(data))
+			state.skip -= n
+			data = data[n:]
+			continue
+		}
+
+		need := 5
+		switch {
+		case state.startup:
+			need = 8
+		case len(state.header) > 0 && state.header[0] == 'R':
+			need = 9 // with the authentication code
+		}
+
+		n := min(need-len(state.header), len(data))
+		state.header = append(state.header, data[:n]...)
+		data = data[n:]
+		if len(state.header) < need || (need == 5 && state.header[0] == 'R') {
+			continue
+		}
+
+		if state.startup {
+			state.startup = false
+			state.typ = 0
+			state.skip = int(binary.BigEndian.Uint32(state.header[0:4])) - 8
+		} else {
+			state.typ = state.header[0]
+			state.skip = int(binary.BigEndian.Uint32(state.header[1:5])) - (need - 1)
+			if state.typ == 'R' {
+				state.auth = binary.BigEndian.Uint32(state.header[5:9])
+			}
+		}
+		if state.skip < 0 {
+			state.skip = 0
+		}
+		state.header = state.header[:0]
+	}
+}
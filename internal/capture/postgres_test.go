@@ -0,0 +1,66 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/buger/goreplay/internal/tcp"
+)
+
+func pgMessage(typ byte, body string) []byte {
+	b := []byte{typ, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], uint32(4+len(body)))
+	return append(b, body...)
+}
+
+func TestPostgresHints(t *testing.T) {
+	startup := make([]byte, 8, 32)
+	startup = append(startup, "user\x00app\x00\x00"...)
+	binary.BigEndian.PutUint32(startup, uint32(len(startup)))
+	binary.BigEndian.PutUint32(startup[4:], pgProtocolVersion)
+
+	auth := pgMessage('R', "\x00\x00\x00\x00")
+	auth = append(auth, pgMessage('S', "server_version\x0016\x00")...)
+	auth = append(auth, pgMessage('K', "\x00\x00\x00\x01\x00\x00\x00\x02")...)
+	auth = append(auth, pgMessage('Z', "I")...)
+
+	query := pgMessage('Q', "select 1\x00")
+	result := pgMessage('T', "\x00\x01?column?\x00\x00\x00\x00\x00\x00\x00\x00\x00\x17\x00\x04\xff\xff\xff\xff\x00\x00")
+	result = append(result, pgMessage('D', "\x00\x01\x00\x00\x00\x011")...)
+	result = append(result, pgMessage('C', "SELECT 1\x00")...)
+	result = append(result, pgMessage('Z', "I")...)
+
+	extended := pgMessage('P', "\x00select $1\x00\x00\x00")
+	extended = append(extended, pgMessage('B', "\x00\x00\x00\x00\x00\x01\x00\x00\x00\x011\x00\x00")...)
+	extended = append(extended, pgMessage('E', "\x00\x00\x00\x00\x00")...)
+	extended = append(extended, pgMessage('S', "")...)
+	complete := pgMessage('1', "")
+	complete = append(complete, pgMessage('2', "")...)
+	complete = append(complete, result...)
+
+	parser := tcp.NewMessageParser(nil, []uint16{8080}, nil, time.Second, false)
+	parser.Start = pgStartHint
+	parser.End = pgEndHint
+
+	cseq, sseq := uint32(1000), uint32(5000)
+	exchange := func(req, res []byte, split int) {
+		parser.PacketHandler(testPacket(true, cseq, sseq, req))
+		cseq += uint32(len(req))
+		// the response is split in the middle of a message header
+		parser.PacketHandler(testPacket(false, sseq, cseq, res[:split]))
+		parser.PacketHandler(testPacket(false, sseq+uint32(split), cseq, res[split:]))
+		sseq += uint32(len(res))
+	}
+	exchange(startup, auth, 2)
+	exchange(query, result, len(result)-3)
+	exchange(extended, complete, 7)
+
+	for _, payload := range [][]byte{startup, auth, query, result, extended, complete} {
+		m := parser.Read()
+		if !bytes.Equal(m.Data(), payload) {
+			t.Errorf("expected %q to equal %q", m.Data(), payload)
+		}
+	}
+}
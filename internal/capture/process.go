@@ -0,0 +1,150 @@
+package capture
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processRefresh is the interval between two lookups of the ports of the captured processes
+const processRefresh = 5 * time.Second
+
+// procRoot is the mount point of procfs
+var procRoot = "/proc"
+
+// socket states of /proc/net/tcp and /proc/net/udp
+const (
+	tcpListen   = "0A"
+	udpUnbound  = "07" // TCP_CLOSE, the state of the UDP sockets that are not connected
+	inodeColumn = 9
+)
+
+// processPIDs returns the pids of the processes with the given command name, as in /proc/<pid>/comm
+func processPIDs(name string) ([]int, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join(procRoot, entry.Name(), "comm"))
+		if err != nil {
+			// the process exited
+			continue
+		}
+		if strings.TrimSpace(string(comm)) == name {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// listeningPorts returns the ports the processes listen on: the ports of their TCP sockets in LISTEN state,
+// or of their unconnected UDP sockets. The sockets of a process are found by the inodes of its file descriptors.
+func listeningPorts(pids []int, transport string) ([]uint16, error) {
+	// the sockets are listed once per network namespace, with the inodes of all its processes
+	inodes := make(map[string]map[string]bool)
+	dirs := make(map[string]string)
+	for _, pid := range pids {
+		dir := filepath.Join(procRoot, strconv.Itoa(pid))
+		sockets, err := socketInodes(dir)
+		if err != nil {
+			if len(pids) == 1 {
+				return nil, err
+			}
+			// the process exited
+			continue
+		}
+
+		netns, _ := os.Readlink(filepath.Join(dir, "ns", "net"))
+		if inodes[netns] == nil {
+			inodes[netns] = make(map[string]bool)
+			dirs[netns] = dir
+		}
+		for inode := range sockets {
+			inodes[netns][inode] = true
+		}
+	}
+
+	ports := make(map[uint16]bool)
+	for netns, dir := range dirs {
+		for _, name := range []string{transport, transport + "6"} {
+			err := readSockets(filepath.Join(dir, "net", name), transport, inodes[netns], ports)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+
+	list := make([]uint16, 0, len(ports))
+	for port := range ports {
+		list = append(list, port)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list, nil
+}
+
+// socketInodes returns the inodes of the sockets of the process of a /proc directory
+func socketInodes(dir string) (map[string]bool, error) {
+	fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+	if err != nil {
+		return nil, err
+	}
+
+	inodes := make(map[string]bool)
+	for _, fd := range fds {
+		link, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+		if err != nil {
+			continue
+		}
+		// socket:[12345]
+		if strings.HasPrefix(link, "socket:[") && strings.HasSuffix(link, "]") {
+			inodes[link[8:len(link)-1]] = true
+		}
+	}
+	return inodes, nil
+}
+
+// readSockets adds the local ports of the listening sockets of a /proc/net/tcp or /proc/net/udp file whose inodes are known
+func readSockets(path, transport string, inodes map[string]bool, ports map[uint16]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	state := tcpListen
+	if transport == "udp" {
+		state = udpUnbound
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) <= inodeColumn || fields[3] != state || !inodes[fields[inodeColumn]] {
+			continue
+		}
+		i := strings.LastIndexByte(fields[1], ':')
+		if i < 0 {
+			continue
+		}
+		port, err := strconv.ParseUint(fields[1][i+1:], 16, 16)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		ports[uint16(port)] = true
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,121 @@
+package capture
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/gopacket/pcap"
+)
+
+const procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 111 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:2382 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 222 1 0000000000000000 100 0 0 10 0
+   2: 0100007F:1F90 0100007F:C350 01 00000000:00000000 00:00000000 00000000     0        0 333 1 0000000000000000 20 4 30 10 -1
+   3: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 444 1 0000000000000000 100 0 0 10 0
+`
+
+const procNetTCP6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:1F91 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 555 1 0000000000000000 100 0 0 10 0
+`
+
+// fakeProcess creates the /proc directory of a process with sockets
+func fakeProcess(t *testing.T, root string, pid, comm string, inodes ...string) {
+	dir := filepath.Join(root, pid)
+	for _, sub := range []string{"fd", "net", "ns"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "net", "tcp"), []byte(procNetTCP), 0644)
+	os.WriteFile(filepath.Join(dir, "net", "tcp6"), []byte(procNetTCP6), 0644)
+	os.Symlink("net:[4026531992]", filepath.Join(dir, "ns", "net"))
+	os.Symlink("/dev/null", filepath.Join(dir, "fd", "0"))
+	for i, inode := range inodes {
+		os.Symlink("socket:["+inode+"]", filepath.Join(dir, "fd", string(rune('3'+i))))
+	}
+}
+
+func TestProcessPorts(t *testing.T) {
+	root := t.TempDir()
+	original := procRoot
+	procRoot = root
+	defer func() { procRoot = original }()
+
+	// a master and a worker share the listening sockets, the worker has a connection
+	fakeProcess(t, root, "100", "nginx", "111", "555")
+	fakeProcess(t, root, "101", "nginx", "111", "222", "333")
+	fakeProcess(t, root, "200", "sshd", "444")
+	os.MkdirAll(filepath.Join(root, "sys"), 0755)
+
+	pids, err := processPIDs("nginx")
+	if err != nil || len(pids) != 2 {
+		t.Fatalf("wrong pids %v %v", pids, err)
+	}
+
+	ports, err := listeningPorts(pids, "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ports) != 3 || ports[0] != 8080 || ports[1] != 8081 || ports[2] != 9090 {
+		t.Errorf("wrong ports %v", ports)
+	}
+
+	if _, err = listeningPorts([]int{300}, "tcp"); err == nil {
+		t.Error("missing process should fail")
+	}
+}
+
+func TestProcessPortsOfSelf(t *testing.T) {
+	if _, err := os.Stat("/proc/self/net/tcp"); err != nil {
+		t.Skip("procfs is not available")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	ports, err := listeningPorts([]int{os.Getpid()}, "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := uint16(ln.Addr().(*net.TCPAddr).Port)
+	for _, p := range ports {
+		if p == port {
+			return
+		}
+	}
+	t.Errorf("port %d not found in %v", port, ports)
+}
+
+func TestProcessPortsFilterPerInterface(t *testing.T) {
+	eth0 := pcap.Interface{Name: "eth0", Addresses: []pcap.InterfaceAddress{{IP: net.IPv4(192, 168, 1, 2)}}}
+	lo := pcap.Interface{Name: "lo", Addresses: []pcap.InterfaceAddress{{IP: net.IPv4(127, 0, 0, 1)}}}
+	recorders := map[string]*filterRecorder{"eth0": {}, "lo": {}}
+	l := &Listener{
+		host:       "",
+		ports:      []uint16{8080},
+		Interfaces: []pcap.Interface{eth0, lo},
+		Handles: map[string]packetHandle{
+			"eth0": {handler: recorders["eth0"], ifi: eth0},
+			"lo":   {handler: recorders["lo"], ifi: lo},
+		},
+	}
+
+	// the process listens on a new port
+	l.ports = []uint16{8081}
+	l.setFilters()
+
+	for name, ifi := range map[string]pcap.Interface{"eth0": eth0, "lo": lo} {
+		if expected := l.Filter(ifi); recorders[name].filter != expected {
+			t.Errorf("%s: expected the filter of its own addresses %q, got %q", name, expected, recorders[name].filter)
+		}
+	}
+	if l.config.BPFFilter != "" {
+		t.Errorf("expected the filters of the interfaces not to be kept in the config, got %q", l.config.BPFFilter)
+	}
+}
@@ -0,0 +1,54 @@
+package capture
+
+import (
+	"github.com/buger/goreplay/internal/redis"
+	"github.com/buger/goreplay/internal/tcp"
+)
+
+// redisState is the protocol state of a single Redis connection
+type redisState struct {
+	commands uint32   // number of commands seen, used to pair commands and replies
+	pending  []uint32 // ids of the commands waiting for their reply
+}
+
+// redisStreamHandler splits pipelined RESP commands into one message per command, and pairs each of them with its reply
+func redisStreamHandler(s *tcp.Stream, dir tcp.Dir, data []byte) (consumed int) {
+	state, _ := s.ProtocolState().(*redisState)
+	if state == nil {
+		state = new(redisState)
+		s.SetProtocolState(state)
+	}
+
+	for consumed < len(data) {
+		n := redis.Len(data[consumed:])
+		if n == 0 {
+			return
+		}
+		if n < 0 {
+			// not RESP, skip what we have and hope to find the start of a value in the next packet
+			stats.Add("redis_invalid_count", 1)
+			return len(data)
+		}
+
+		value := data[consumed : consumed+n]
+		consumed += n
+
+		if dir == tcp.DirIncoming {
+			id := s.ISN(tcp.DirIncoming) + state.commands
+			state.commands++
+			state.pending = append(state.pending, id)
+			s.Emit(dir, id, append([]byte(nil), value...), s.Start(dir), s.Timestamp())
+			continue
+		}
+
+		// out of band pushes and replies to unknown commands have nothing to be paired with
+		if redis.IsPush(value) || len(state.pending) == 0 {
+			continue
+		}
+		id := state.pending[0]
+		state.pending = state.pending[1:]
+		s.Emit(dir, id, append([]byte(nil), value...), s.Start(dir), s.Timestamp())
+	}
+
+	return
+}
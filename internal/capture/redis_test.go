@@ -0,0 +1,47 @@
+package capture
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/buger/goreplay/internal/tcp"
+)
+
+func TestRedisStreamHandler(t *testing.T) {
+	set := []byte("*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n")
+	get := []byte("*2\r\n$3\r\nGET\r\n$1\r\nk\r\n")
+	ping := []byte("PING\r\n")
+	push := []byte(">2\r\n$10\r\ninvalidate\r\n*0\r\n")
+
+	parser := tcp.NewMessageParser(nil, []uint16{8080}, nil, time.Second, false)
+	parser.Stream = redisStreamHandler
+
+	// pipelined commands, the last one split among packets
+	pipeline := append(append(append([]byte(nil), set...), get...), ping...)
+	parser.PacketHandler(testPacket(true, 1000, 5000, pipeline[:len(set)+5]))
+	parser.PacketHandler(testPacket(true, 1000+uint32(len(set)+5), 5000, pipeline[len(set)+5:]))
+	replies := []byte("+OK\r\n" + string(push) + "$1\r\nv\r\n+PONG\r\n")
+	parser.PacketHandler(testPacket(false, 5000, 1000+uint32(len(pipeline)), replies))
+
+	expected := map[string]string{string(set): "+OK\r\n", string(get): "$1\r\nv\r\n", string(ping): "+PONG\r\n"}
+	requests := map[string][]byte{}
+	for i := 0; i < 6; i++ {
+		m := parser.Read()
+		if m.Direction == tcp.DirIncoming {
+			if _, ok := expected[string(m.Data())]; !ok {
+				t.Errorf("unexpected command %q", m.Data())
+			}
+			requests[string(m.UUID())] = m.Data()
+			continue
+		}
+
+		req, ok := requests[string(m.UUID())]
+		if !ok || expected[string(req)] != string(m.Data()) {
+			t.Errorf("reply %q is paired with %q", m.Data(), req)
+		}
+		if bytes.Equal(m.Data(), push) {
+			t.Error("pushes are not replies")
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// TunnelPacketSize is the largest encapsulated packet received by the tunnel engines
+const TunnelPacketSize = 1 << 16
+
+// GRE protocol types
+const (
+	greTransparentEthernet = 0x6558
+	greIPv4                = 0x0800
+	greIPv6                = 0x86dd
+	greERSPAN              = 0x88be // ERSPAN type I, or type II when the sequence number is present
+	greERSPAN3             = 0x22eb
+)
+
+// TZSP encapsulation and tags
+const (
+	tzspEthernet = 1
+	tzspPadding  = 0
+	tzspEnd      = 1
+)
+
+// decapsulator returns the inner ethernet frame of an encapsulated packet, with the id of
+// its tunnel: GRE key, ERSPAN session id or Geneve VNI
+type decapsulator func(data []byte) (frame []byte, id int, ok bool)
+
+// tunnelHandle receives mirrored traffic encapsulated in GRE, ERSPAN, Geneve or TZSP, like vxlanHandle does for VXLAN
+type tunnelHandle struct {
+	connection    net.PacketConn
+	packetChannel chan tunnelPacket
+	decapsulate   decapsulator
+	ids           []int
+}
+
+type tunnelPacket struct {
+	data []byte
+	ci   gopacket.CaptureInfo
+}
+
+func newTunnelHandler(connection net.PacketConn, decapsulate decapsulator, ids []int) *tunnelHandle {
+	t := &tunnelHandle{
+		connection:    connection,
+		packetChannel: make(chan tunnelPacket, 1000),
+		decapsulate:   decapsulate,
+		ids:           ids,
+	}
+	go t.reader()
+
+	return t
+}
+
+// newGREHandler receives GRE packets, erspan selects ERSPAN sessions instead of the other GRE payloads
+func newGREHandler(erspan bool, ids []int) (*tunnelHandle, error) {
+	con, err := net.ListenPacket("ip4:gre", "0.0.0.0")
+	if err != nil {
+		return nil, err
+	}
+	return newTunnelHandler(con, func(data []byte) ([]byte, int, bool) {
+		return decapGRE(data, erspan)
+	}, ids), nil
+}
+
+func newGeneveHandler(port int, vnis []int) (*tunnelHandle, error) {
+	if port == 0 {
+		port = 6081
+	}
+
+	con, err := net.ListenUDP("udp", &net.UDPAddr{Port: port, IP: net.ParseIP("0.0.0.0")})
+	if err != nil {
+		return nil, err
+	}
+	return newTunnelHandler(con, decapGeneve, vnis), nil
+}
+
+// newTZSPHandler receives packets sent by TZSP sniffers, like MikroTik routers. It does not need root access.
+func newTZSPHandler(port int) (*tunnelHandle, error) {
+	if port == 0 {
+		port = 37008
+	}
+
+	con, err := net.ListenUDP("udp", &net.UDPAddr{Port: port, IP: net.ParseIP("0.0.0.0")})
+	if err != nil {
+		return nil, err
+	}
+	return newTunnelHandler(con, decapTZSP, nil), nil
+}
+
+func (t *tunnelHandle) reader() {
+	for {
+		inputBytes := make([]byte, TunnelPacketSize)
+		length, _, err := t.connection.ReadFrom(inputBytes)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		frame, id, ok := t.decapsulate(inputBytes[:length])
+		if !ok {
+			stats.Add("tunnel_invalid_packet", 1)
+			continue
+		}
+		if len(t.ids) > 0 && !idIsAllowed(t.ids, id) {
+			continue
+		}
+
+		t.packetChannel <- tunnelPacket{
+			data: frame,
+			ci: gopacket.CaptureInfo{
+				Timestamp:     time.Now(),
+				CaptureLength: len(frame),
+				Length:        len(frame),
+			},
+		}
+	}
+}
+
+func (t *tunnelHandle) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	packet := <-t.packetChannel
+	return packet.data, packet.ci, nil
+}
+
+func (t *tunnelHandle) Close() error {
+	if t.connection != nil {
+		return t.connection.Close()
+	}
+	return nil
+}
+
+// idIsAllowed checks the id of a tunnel against the ids given in the options, negative ids are excluded
+func idIsAllowed(ids []int, id int) bool {
+	defaultState := false
+	for _, allowed := range ids {
+		if allowed > 0 && id == allowed {
+			return true
+		}
+
+		if allowed < 0 {
+			if id == -allowed {
+				return false
+			}
+			defaultState = true
+		}
+	}
+	return defaultState
+}
+
+// decapGRE strips the GRE header, and the ERSPAN header when erspan is set
+func decapGRE(data []byte, erspan bool) (frame []byte, id int, ok bool) {
+	if len(data) < 4 || data[1]&0x07 != 0 {
+		return nil, 0, false
+	}
+	flags := data[0]
+	protocol := binary.BigEndian.Uint16(data[2:4])
+
+	n := 4
+	if flags&0x80 != 0 {
+		// checksum and reserved
+		n += 4
+	}
+	if flags&0x20 != 0 {
+		if len(data) < n+4 {
+			return nil, 0, false
+		}
+		id = int(binary.BigEndian.Uint32(data[n:]))
+		n += 4
+	}
+	sequence := flags&0x10 != 0
+	if sequence {
+		n += 4
+	}
+	if len(data) < n {
+		return nil, 0, false
+	}
+	payload := data[n:]
+
+	switch protocol {
+	case greERSPAN:
+		if !erspan {
+			return nil, 0, false
+		}
+		if !sequence {
+			// type I has no header
+			return payload, 0, true
+		}
+		if len(payload) < 8 {
+			return nil, 0, false
+		}
+		return payload[8:], int(binary.BigEndian.Uint16(payload[2:4]) & 0x3ff), true
+	case greERSPAN3:
+		if !erspan || len(payload) < 12 {
+			return nil, 0, false
+		}
+		hdr := 12
+		if payload[11]&0x01 != 0 {
+			// platform specific subheader
+			hdr += 8
+		}
+		if len(payload) < hdr {
+			return nil, 0, false
+		}
+		return payload[hdr:], int(binary.BigEndian.Uint16(payload[2:4]) & 0x3ff), true
+	case greTransparentEthernet:
+		return payload, id, !erspan
+	case greIPv4, greIPv6:
+		return withEthernetHeader(protocol, payload), id, !erspan
+	}
+	return nil, 0, false
+}
+
+// decapGeneve strips the Geneve header and its options
+func decapGeneve(data []byte) (frame []byte, vni int, ok bool) {
+	if len(data) < 8 || data[0]>>6 != 0 {
+		return nil, 0, false
+	}
+	hdr := 8 + int(data[0]&0x3f)*4
+	if len(data) < hdr {
+		return nil, 0, false
+	}
+	vni = int(data[4])<<16 | int(data[5])<<8 | int(data[6])
+
+	switch protocol := binary.BigEndian.Uint16(data[2:4]); protocol {
+	case greTransparentEthernet:
+		return data[hdr:], vni, true
+	case greIPv4, greIPv6:
+		return withEthernetHeader(protocol, data[hdr:]), vni, true
+	}
+	return nil, 0, false
+}
+
+// withEthernetHeader prepends an ethernet header to an IP packet, the handles of the listener have a single link type
+func withEthernetHeader(etherType uint16, packet []byte) []byte {
+	frame := make([]byte, 14+len(packet))
+	binary.BigEndian.PutUint16(frame[12:14], etherType)
+	copy(frame[14:], packet)
+	return frame
+}
+
+// decapTZSP strips the TZSP header and its tagged fields, only ethernet frames are accepted
+func decapTZSP(data []byte) (frame []byte, id int, ok bool) {
+	// version, type (received or transmitted packet), encapsulated protocol
+	if len(data) < 4 || data[0] != 1 || data[1] > 1 || binary.BigEndian.Uint16(data[2:4]) != tzspEthernet {
+		return nil, 0, false
+	}
+
+	for n := 4; n < len(data); {
+		switch data[n] {
+		case tzspEnd:
+			return data[n+1:], 0, true
+		case tzspPadding:
+			n++
+		default:
+			if n+1 >= len(data) {
+				return nil, 0, false
+			}
+			n += 2 + int(data[n+1])
+		}
+	}
+	return nil, 0, false
+}
@@ -0,0 +1,119 @@
+package capture
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+var innerFrame = []byte("\x01\x02\x03\x04\x05\x06\x01\x02\x03\x04\x05\x07\x08\x00inner packet")
+
+func TestDecapGRE(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		erspan bool
+		frame  []byte
+		id     int
+		ok     bool
+	}{
+		{"transparent ethernet with key", append([]byte{0x20, 0, 0x65, 0x58, 0, 0, 0, 7}, innerFrame...), false, innerFrame, 7, true},
+		{"ipv4 with checksum", append([]byte{0x80, 0, 0x08, 0x00, 0, 0, 0, 0}, "ip packet"...), false, append(make([]byte, 12), "\x08\x00ip packet"...), 0, true},
+		{"erspan on the gre engine", append([]byte{0x10, 0, 0x88, 0xbe, 0, 0, 0, 1, 0x10, 0, 0x03, 0xff, 0, 0, 0, 0}, innerFrame...), false, nil, 0, false},
+		{"erspan type I", append([]byte{0, 0, 0x88, 0xbe}, innerFrame...), true, innerFrame, 0, true},
+		{"erspan type II", append([]byte{0x10, 0, 0x88, 0xbe, 0, 0, 0, 1, 0x10, 0, 0x0c, 0x2a, 0, 0, 0, 0}, innerFrame...), true, innerFrame, 42, true},
+		{"erspan type III", append([]byte{0x10, 0, 0x22, 0xeb, 0, 0, 0, 1, 0x20, 0, 0x00, 0x05, 0, 0, 0, 0, 0, 0, 0, 0}, innerFrame...), true, innerFrame, 5, true},
+		{"erspan type III with subheader", append([]byte{0x10, 0, 0x22, 0xeb, 0, 0, 0, 1, 0x20, 0, 0x00, 0x05, 0, 0, 0, 0, 0, 0, 0, 1, 1, 2, 3, 4, 5, 6, 7, 8}, innerFrame...), true, innerFrame, 5, true},
+		{"truncated key", []byte{0x20, 0, 0x65, 0x58, 0}, false, nil, 0, false},
+		{"gre version 1", append([]byte{0, 1, 0x65, 0x58}, innerFrame...), false, nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		frame, id, ok := decapGRE(tt.packet, tt.erspan)
+		if ok != tt.ok || id != tt.id || !bytes.Equal(frame, tt.frame) {
+			t.Errorf("%s: got %q %d %v", tt.name, frame, id, ok)
+		}
+	}
+}
+
+func genevePacket(vni int) []byte {
+	// one option of 4 bytes
+	return append([]byte{0x01, 0, 0x65, 0x58, byte(vni >> 16), byte(vni >> 8), byte(vni), 0, 0, 0, 0, 0}, innerFrame...)
+}
+
+func TestDecapGeneve(t *testing.T) {
+	frame, vni, ok := decapGeneve(genevePacket(0x010203))
+	if !ok || vni != 0x010203 || !bytes.Equal(frame, innerFrame) {
+		t.Errorf("got %q %d %v", frame, vni, ok)
+	}
+
+	if _, _, ok = decapGeneve(genevePacket(1)[:10]); ok {
+		t.Error("truncated options should be invalid")
+	}
+}
+
+func TestIDIsAllowed(t *testing.T) {
+	if !idIsAllowed([]int{1, 2}, 2) || idIsAllowed([]int{1, 2}, 3) {
+		t.Error("wrong allowed ids")
+	}
+	if idIsAllowed([]int{-1}, 1) || !idIsAllowed([]int{-1}, 3) {
+		t.Error("wrong ignored ids")
+	}
+}
+
+func TestTunnelHandler(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newTunnelHandler(conn, decapGeneve, []int{-1})
+	defer handler.Close()
+
+	sender, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	// the packets of VNI 1 are ignored
+	sender.Write(genevePacket(1))
+	sender.Write([]byte("invalid"))
+	sender.Write(genevePacket(2))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		data, ci, err := handler.ReadPacketData()
+		if err != nil || !bytes.Equal(data, innerFrame) || ci.CaptureLength != len(innerFrame) {
+			t.Errorf("wrong packet %q %v", data, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("packet not received")
+	}
+}
+
+func TestDecapTZSP(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		ok     bool
+	}{
+		{"no tags", append([]byte{1, 0, 0, 1, 1}, innerFrame...), true},
+		{"padding and signal tag", append([]byte{1, 0, 0, 1, 0, 0, 10, 1, 0xc4, 1}, innerFrame...), true},
+		{"transmitted packet", append([]byte{1, 1, 0, 1, 1}, innerFrame...), true},
+		{"keepalive", []byte{1, 4, 0, 0, 1}, false},
+		{"802.11 encapsulation", append([]byte{1, 0, 0, 18, 1}, innerFrame...), false},
+		{"missing end tag", []byte{1, 0, 0, 1, 10, 4, 0, 0}, false},
+	}
+
+	for _, tt := range tests {
+		frame, _, ok := decapTZSP(tt.packet)
+		if ok != tt.ok || (ok && !bytes.Equal(frame, innerFrame)) {
+			t.Errorf("%s: got %q %v", tt.name, frame, ok)
+		}
+	}
+}
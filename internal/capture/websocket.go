@@ -0,0 +1,44 @@
+package capture
+
+import (
+	"bytes"
+
+	"github.com/buger/goreplay/internal/tcp"
+	"github.com/buger/goreplay/internal/websocket"
+	"github.com/buger/goreplay/proto"
+)
+
+// websocketUpgradeHint switches the connections of the WebSocket handshakes to websocketStreamHandler,
+// once the server accepted them with a 101 Switching Protocols response
+func websocketUpgradeHint(m *tcp.Message) tcp.StreamHandler {
+	data := m.Packets()[0].Payload
+	if string(proto.Status(data)) != "101" {
+		return nil
+	}
+	if !bytes.EqualFold(proto.Header(m.Data(), []byte("Upgrade")), []byte("websocket")) {
+		return nil
+	}
+	return websocketStreamHandler
+}
+
+// websocketStreamHandler emits every frame of a WebSocket session as a message, unmasked.
+// The frames share the UUID of the handshake.
+func websocketStreamHandler(s *tcp.Stream, dir tcp.Dir, data []byte) (consumed int) {
+	for consumed < len(data) {
+		n := websocket.Len(data[consumed:])
+		if n == 0 {
+			return
+		}
+		if n < 0 {
+			// not a frame, skip what we have and hope to find the start of a frame in the next packet
+			stats.Add("websocket_invalid_count", 1)
+			return len(data)
+		}
+
+		frame := data[consumed : consumed+n]
+		consumed += n
+		s.Emit(dir, 0, websocket.Unmask(frame), s.Start(dir), s.Timestamp())
+	}
+
+	return
+}
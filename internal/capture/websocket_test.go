@@ -0,0 +1,60 @@
+package capture
+
+import (
+	"testing"
+	"time"
+
+	"github.com/buger/goreplay/internal/tcp"
+	"github.com/buger/goreplay/internal/websocket"
+)
+
+func TestWebSocketStreamHandler(t *testing.T) {
+	parser := tcp.NewMessageParser(nil, []uint16{8080}, nil, time.Second, false)
+	parser.Start = http1StartHint
+	parser.End = http1EndHint
+	parser.Split = http1SplitHint
+	parser.Upgrade = websocketUpgradeHint
+
+	handshake := []byte("GET /chat HTTP/1.1\r\nHost: a\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	accept := []byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n\r\n")
+	// the first frame of the server is sent with the response
+	welcome := []byte("\x81\x07welcome")
+	hello := websocket.Mask([]byte("\x81\x05hello"), [4]byte{1, 2, 3, 4})
+	closing := websocket.Mask([]byte("\x88\x00"), [4]byte{5, 6, 7, 8})
+
+	cseq, sseq := uint32(1000), uint32(5000)
+	parser.PacketHandler(testPacket(true, cseq, sseq, handshake))
+	cseq += uint32(len(handshake))
+	parser.PacketHandler(testPacket(false, sseq, cseq, append(append([]byte(nil), accept...), welcome...)))
+	sseq += uint32(len(accept) + len(welcome))
+	// a frame split among packets
+	parser.PacketHandler(testPacket(true, cseq, sseq, hello[:4]))
+	parser.PacketHandler(testPacket(true, cseq+4, sseq, append(hello[4:], closing...)))
+
+	req := parser.Read()
+	res := parser.Read()
+	if req.Direction != tcp.DirIncoming || string(req.Data()) != string(handshake) || string(res.UUID()) != string(req.UUID()) {
+		t.Fatalf("wrong handshake %q %q", req.Data(), res.Data())
+	}
+	if string(res.Data()) != string(accept) {
+		t.Errorf("wrong response %q", res.Data())
+	}
+
+	expected := []struct {
+		dir   tcp.Dir
+		frame string
+	}{
+		{tcp.DirOutcoming, "\x81\x07welcome"},
+		{tcp.DirIncoming, "\x81\x05hello"},
+		{tcp.DirIncoming, "\x88\x00"},
+	}
+	for _, e := range expected {
+		m := parser.Read()
+		if !m.Upgraded() || m.Direction != e.dir || string(m.Data()) != e.frame {
+			t.Errorf("expected frame %q, got %q (direction %v)", e.frame, m.Data(), m.Direction)
+		}
+		if string(m.UUID()) != string(req.UUID()) {
+			t.Errorf("the frames should have the ID of the handshake")
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+const (
+	nativePassword      = "mysql_native_password"
+	cachingSHA2Password = "caching_sha2_password"
+)
+
+// clientCapabilities are the capabilities requested by Conn, EOF packets are kept
+const clientCapabilities = ClientLongPassword | ClientLongFlag | ClientProtocol41 | ClientTransactions |
+	ClientSecureConnection | ClientMultiStatements | ClientMultiResults | ClientPSMultiResults | ClientPluginAuth
+
+// Conn is a client connection to a MySQL server
+type Conn struct {
+	net.Conn
+	r            *bufio.Reader
+	Capabilities uint32 // negotiated during the handshake
+}
+
+// NewConn wraps a network connection, Handshake must be called before sending commands
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{Conn: conn, r: bufio.NewReader(conn)}
+}
+
+// ReadPacket reads the next packet
+func (c *Conn) ReadPacket() (payload []byte, seq byte, err error) {
+	var header [4]byte
+	if _, err = io.ReadFull(c.r, header[:]); err != nil {
+		return
+	}
+	payload = make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	_, err = io.ReadFull(c.r, payload)
+	return payload, header[3], err
+}
+
+// WritePacket writes the payload as a single packet
+func (c *Conn) WritePacket(seq byte, payload []byte) error {
+	_, err := c.Write(AppendPacket(nil, seq, payload))
+	return err
+}
+
+// Handshake authenticates the connection, only mysql_native_password and caching_sha2_password are supported
+func (c *Conn) Handshake(user, password, database string) error {
+	greeting, seq, err := c.ReadPacket()
+	if err != nil {
+		return err
+	}
+	if len(greeting) > 0 && greeting[0] == 0xff {
+		return serverError(greeting)
+	}
+	if len(greeting) < 1 || greeting[0] != 10 {
+		return errors.New("unsupported mysql protocol version")
+	}
+
+	// server version, connection id, scramble part 1, filler, capabilities, charset, status, capabilities
+	pos := bytes.IndexByte(greeting[1:], 0) + 2
+	if pos < 2 || len(greeting) < pos+4+8+1+2+1+2+2+1+10 {
+		return errors.New("malformed mysql handshake")
+	}
+	scramble := append([]byte(nil), greeting[pos+4:pos+12]...)
+	pos += 13
+	server := uint32(binary.LittleEndian.Uint16(greeting[pos:]))
+	server |= uint32(binary.LittleEndian.Uint16(greeting[pos+5:])) << 16
+	pos += 18
+	plugin := nativePassword
+	if rest := greeting[pos:]; len(rest) >= 13 {
+		scramble = append(scramble, rest[:12]...)
+		if end := bytes.IndexByte(rest[13:], 0); end >= 0 {
+			plugin = string(rest[13 : 13+end])
+		}
+	}
+
+	c.Capabilities = clientCapabilities & server
+	if database != "" {
+		c.Capabilities |= ClientConnectWithDB & server
+	}
+
+	auth, err := scramblePassword(plugin, password, scramble)
+	if err != nil {
+		return err
+	}
+
+	resp := binary.LittleEndian.AppendUint32(nil, c.Capabilities)
+	resp = binary.LittleEndian.AppendUint32(resp, MaxPacketLen)
+	resp = append(resp, 45) // utf8mb4_general_ci
+	resp = append(resp, make([]byte, 23)...)
+	resp = append(append(resp, user...), 0)
+	resp = append(append(resp, byte(len(auth))), auth...)
+	if c.Capabilities&ClientConnectWithDB != 0 {
+		resp = append(append(resp, database...), 0)
+	}
+	resp = append(append(resp, plugin...), 0)
+
+	seq++
+	if err = c.WritePacket(seq, resp); err != nil {
+		return err
+	}
+
+	for {
+		payload, s, err := c.ReadPacket()
+		if err != nil {
+			return err
+		}
+		seq = s + 1
+		if len(payload) == 0 {
+			return errors.New("malformed mysql authentication packet")
+		}
+
+		switch payload[0] {
+		case 0x00:
+			return nil
+		case 0xff:
+			return serverError(payload)
+		case 0xfe:
+			// authentication switch: plugin name, then the new scramble
+			end := bytes.IndexByte(payload[1:], 0)
+			if end < 0 {
+				return errors.New("malformed mysql authentication switch")
+			}
+			plugin = string(payload[1 : 1+end])
+			scramble = bytes.TrimSuffix(payload[2+end:], []byte{0})
+			if auth, err = scramblePassword(plugin, password, scramble); err != nil {
+				return err
+			}
+			err = c.WritePacket(seq, auth)
+		case 0x01:
+			switch {
+			case plugin != cachingSHA2Password:
+				return fmt.Errorf("unexpected mysql authentication data for %s", plugin)
+			case len(payload) == 2 && payload[1] == 3:
+				// fast authentication succeeded, OK follows
+			case len(payload) == 2 && payload[1] == 4:
+				// full authentication, request the public key of the server
+				err = c.WritePacket(seq, []byte{2})
+			default:
+				var enc []byte
+				if enc, err = encryptPassword(payload[1:], password, scramble); err == nil {
+					err = c.WritePacket(seq, enc)
+				}
+			}
+		default:
+			return errors.New("unexpected mysql authentication packet")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func serverError(payload []byte) error {
+	msg := payload[1:]
+	if len(msg) >= 2 {
+		msg = msg[2:] // error code
+	}
+	if len(msg) > 0 && msg[0] == '#' && len(msg) >= 6 {
+		msg = msg[6:] // sql state
+	}
+	return fmt.Errorf("mysql error: %s", msg)
+}
+
+func scramblePassword(plugin, password string, scramble []byte) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+	if len(scramble) > 20 {
+		scramble = scramble[:20]
+	}
+
+	switch plugin {
+	case nativePassword:
+		// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+		h1 := sha1.Sum([]byte(password))
+		h2 := sha1.Sum(h1[:])
+		h3 := sha1.Sum(append(append([]byte(nil), scramble...), h2[:]...))
+		for i := range h1 {
+			h1[i] ^= h3[i]
+		}
+		return h1[:], nil
+	case cachingSHA2Password:
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+		h1 := sha256.Sum256([]byte(password))
+		h2 := sha256.Sum256(h1[:])
+		h3 := sha256.Sum256(append(h2[:], scramble...))
+		for i := range h1 {
+			h1[i] ^= h3[i]
+		}
+		return h1[:], nil
+	}
+	return nil, fmt.Errorf("unsupported mysql authentication plugin %q", plugin)
+}
+
+// encryptPassword encrypts the password with the public key sent by the server, for caching_sha2_password
+// full authentication over an unencrypted connection
+func encryptPassword(key []byte, password string, scramble []byte) ([]byte, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("malformed mysql server public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("mysql server public key is not an RSA key")
+	}
+
+	plain := append([]byte(password), 0)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaPub, plain, nil)
+}
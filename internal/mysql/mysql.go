@@ -0,0 +1,234 @@
+/*
+Package mysql implements the parts of the MySQL client/server protocol needed to capture
+and replay commands: packet framing, response tracking and the client handshake.
+*/
+package mysql
+
+import (
+	"encoding/binary"
+)
+
+// MaxPacketLen is the payload length of a packet which is continued by the next one
+const MaxPacketLen = 1<<24 - 1
+
+// Commands, see https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_command_phase.html
+const (
+	ComQuit             byte = 0x01
+	ComInitDB           byte = 0x02
+	ComQuery            byte = 0x03
+	ComFieldList        byte = 0x04
+	ComStatistics       byte = 0x09
+	ComPing             byte = 0x0e
+	ComStmtPrepare      byte = 0x16
+	ComStmtExecute      byte = 0x17
+	ComStmtSendLongData byte = 0x18
+	ComStmtClose        byte = 0x19
+	ComStmtReset        byte = 0x1a
+	ComStmtFetch        byte = 0x1c
+)
+
+// Capability flags
+const (
+	ClientLongPassword     uint32 = 0x00000001
+	ClientLongFlag         uint32 = 0x00000004
+	ClientConnectWithDB    uint32 = 0x00000008
+	ClientProtocol41       uint32 = 0x00000200
+	ClientSSL              uint32 = 0x00000800
+	ClientTransactions     uint32 = 0x00002000
+	ClientSecureConnection uint32 = 0x00008000
+	ClientMultiStatements  uint32 = 0x00010000
+	ClientMultiResults     uint32 = 0x00020000
+	ClientPSMultiResults   uint32 = 0x00040000
+	ClientPluginAuth       uint32 = 0x00080000
+	ClientPluginAuthLenenc uint32 = 0x00200000
+	ClientDeprecateEOF     uint32 = 0x01000000
+)
+
+const serverMoreResultsExists = 0x0008
+
+// Packet returns the payload, the sequence id and the total length of the first packet of data.
+// ok is false if the packet is not complete.
+func Packet(data []byte) (payload []byte, seq byte, n int, ok bool) {
+	if len(data) < 4 {
+		return nil, 0, 0, false
+	}
+	length := int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+	if len(data) < 4+length {
+		return nil, 0, 0, false
+	}
+	return data[4 : 4+length], data[3], 4 + length, true
+}
+
+// AppendPacket appends payload to buf as a single packet, the payload must be shorter than MaxPacketLen
+func AppendPacket(buf []byte, seq byte, payload []byte) []byte {
+	buf = append(buf, byte(len(payload)), byte(len(payload)>>8), byte(len(payload)>>16), seq)
+	return append(buf, payload...)
+}
+
+// HasResponse checks if the server answers to the command
+func HasResponse(command byte) bool {
+	switch command {
+	case ComQuit, ComStmtSendLongData, ComStmtClose:
+		return false
+	}
+	return true
+}
+
+// HasStatementID checks if the command refers to a prepared statement by its id
+func HasStatementID(command byte) bool {
+	switch command {
+	case ComStmtExecute, ComStmtSendLongData, ComStmtClose, ComStmtReset, ComStmtFetch:
+		return true
+	}
+	return false
+}
+
+// lenenc decodes a length encoded integer, and returns the number of bytes it takes
+func lenenc(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	switch b[0] {
+	case 0xfc:
+		if len(b) < 3 {
+			return 0, 0
+		}
+		return uint64(binary.LittleEndian.Uint16(b[1:])), 3
+	case 0xfd:
+		if len(b) < 4 {
+			return 0, 0
+		}
+		return uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16, 4
+	case 0xfe:
+		if len(b) < 9 {
+			return 0, 0
+		}
+		return binary.LittleEndian.Uint64(b[1:]), 9
+	}
+	return uint64(b[0]), 1
+}
+
+const (
+	respFirst = iota // OK, ERR or the start of a result set
+	respDefinitions
+	respEOF // EOF after column definitions
+	respRows
+)
+
+// Response follows the packets of the response to a command until it is complete
+type Response struct {
+	Command      byte
+	DeprecateEOF bool // CLIENT_DEPRECATE_EOF was negotiated
+
+	state     int
+	sections  []int // number of definitions in each section
+	rows      bool  // rows follow the definitions
+	continued bool  // the previous packet is continued by the next one
+}
+
+// NewResponse returns the response tracker for a command
+func NewResponse(command byte, deprecateEOF bool) *Response {
+	return &Response{Command: command, DeprecateEOF: deprecateEOF}
+}
+
+// Add passes the payload of the next response packet, and reports if the response is complete
+func (r *Response) Add(payload []byte) (done bool) {
+	continued := r.continued
+	r.continued = len(payload) == MaxPacketLen
+	if continued || len(payload) == 0 {
+		return false
+	}
+
+	switch r.state {
+	case respFirst:
+		switch {
+		case payload[0] == 0xff:
+			return true
+		case payload[0] == 0x00 && r.Command == ComStmtPrepare && len(payload) >= 12:
+			columns := int(binary.LittleEndian.Uint16(payload[5:7]))
+			params := int(binary.LittleEndian.Uint16(payload[7:9]))
+			r.sections = r.sections[:0]
+			for _, n := range []int{params, columns} {
+				if n > 0 {
+					r.sections = append(r.sections, n)
+				}
+			}
+			r.rows = false
+		case payload[0] == 0x00:
+			return !r.moreResults(payload)
+		case payload[0] == 0xfb, r.Command == ComStatistics:
+			// LOCAL INFILE requests are not supported
+			return true
+		case r.Command == ComFieldList:
+			r.state = respRows
+			return false
+		default:
+			n, _ := lenenc(payload)
+			r.sections = append(r.sections[:0], int(n))
+			r.rows = true
+		}
+		return r.nextSection()
+	case respDefinitions:
+		r.sections[0]--
+		if r.sections[0] > 0 {
+			return false
+		}
+		if !r.DeprecateEOF {
+			r.state = respEOF
+			return false
+		}
+		r.sections = r.sections[1:]
+		return r.nextSection()
+	case respEOF:
+		r.sections = r.sections[1:]
+		return r.nextSection()
+	case respRows:
+		if payload[0] == 0xff {
+			return true
+		}
+		// a row can start with 0xfe only if it is longer than a packet
+		if payload[0] == 0xfe && len(payload) < MaxPacketLen {
+			if r.moreResults(payload) {
+				r.state = respFirst
+				return false
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Response) nextSection() bool {
+	switch {
+	case len(r.sections) > 0:
+		r.state = respDefinitions
+		if r.sections[0] == 0 {
+			r.sections = r.sections[1:]
+			return r.nextSection()
+		}
+	case r.rows:
+		r.state = respRows
+	default:
+		return true
+	}
+	return false
+}
+
+// moreResults checks the status flags of an OK or EOF packet
+func (r *Response) moreResults(payload []byte) bool {
+	var status []byte
+	if payload[0] == 0xfe && len(payload) < 9 {
+		// EOF: header, warnings, status
+		if len(payload) >= 5 {
+			status = payload[3:5]
+		}
+	} else {
+		// OK: header, affected rows, last insert id, status
+		_, n := lenenc(payload[1:])
+		_, m := lenenc(payload[1+n:])
+		if n > 0 && m > 0 && len(payload) >= 3+n+m {
+			status = payload[1+n+m : 3+n+m]
+		}
+	}
+	return status != nil && binary.LittleEndian.Uint16(status)&serverMoreResultsExists != 0
+}
@@ -0,0 +1,66 @@
+package mysql
+
+import (
+	"bytes"
+	"testing"
+)
+
+var (
+	okPacket   = []byte{0x00, 0, 0, 0x02, 0, 0, 0}
+	moreOK     = []byte{0x00, 0, 0, 0x0a, 0, 0, 0} // SERVER_MORE_RESULTS_EXISTS
+	errPacket  = []byte{0xff, 0x48, 0x04, '#', '4', '2', '0', '0', '0', 'n', 'o'}
+	eofPacket  = []byte{0xfe, 0, 0, 0x02, 0}
+	moreEOF    = []byte{0xfe, 0, 0, 0x0a, 0}
+	okEOF      = []byte{0xfe, 0, 0, 0x02, 0, 0, 0}
+	columnDef  = []byte("\x03def\x00\x00\x00\x011\x00\x0c\x3f\x00\x01\x00\x00\x00\x08\x81\x00\x00\x00\x00")
+	row        = []byte{0x01, '1'}
+	prepareOK  = []byte{0x00, 7, 0, 0, 0, 1, 0, 2, 0, 0, 0, 0}
+	columnsOne = []byte{0x01}
+)
+
+func TestResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		command      byte
+		deprecateEOF bool
+		packets      [][]byte
+	}{
+		{"ok", ComQuery, false, [][]byte{okPacket}},
+		{"error", ComQuery, false, [][]byte{errPacket}},
+		{"result set", ComQuery, false, [][]byte{columnsOne, columnDef, eofPacket, row, row, eofPacket}},
+		{"deprecated eof", ComQuery, true, [][]byte{columnsOne, columnDef, row, okEOF}},
+		{"multi results", ComQuery, false, [][]byte{moreOK, columnsOne, columnDef, eofPacket, moreEOF, okPacket}},
+		{"prepare", ComStmtPrepare, false, [][]byte{prepareOK, columnDef, columnDef, eofPacket, columnDef, eofPacket}},
+		{"prepare without eof", ComStmtPrepare, true, [][]byte{prepareOK, columnDef, columnDef, columnDef}},
+		{"field list", ComFieldList, false, [][]byte{columnDef, columnDef, eofPacket}},
+		{"statistics", ComStatistics, false, [][]byte{[]byte("Uptime: 1")}},
+		{"long row", ComQuery, false, [][]byte{columnsOne, columnDef, eofPacket, bytes.Repeat([]byte{0xfe}, MaxPacketLen), {0xfe}, eofPacket}},
+	}
+
+	for _, tt := range tests {
+		r := NewResponse(tt.command, tt.deprecateEOF)
+		for i, p := range tt.packets {
+			done := r.Add(p)
+			if last := i == len(tt.packets)-1; done != last {
+				t.Errorf("%s: expected packet %d to complete the response: %v", tt.name, i, last)
+				break
+			}
+		}
+	}
+}
+
+func TestPacket(t *testing.T) {
+	data := AppendPacket(nil, 3, []byte("abc"))
+	data = AppendPacket(data, 4, nil)
+
+	payload, seq, n, ok := Packet(data)
+	if !ok || seq != 3 || n != 7 || string(payload) != "abc" {
+		t.Errorf("wrong packet %q %d %d %v", payload, seq, n, ok)
+	}
+	if _, _, _, ok = Packet(data[:6]); ok {
+		t.Error("expected an incomplete packet")
+	}
+	if payload, seq, n, ok = Packet(data[7:]); !ok || seq != 4 || n != 4 || len(payload) != 0 {
+		t.Errorf("wrong empty packet %q %d %d %v", payload, seq, n, ok)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Package redis implements the framing of the Redis serialization protocol (RESP2 and RESP3),
+used to capture and replay Redis commands.
+*/
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// ErrInvalid is returned for data which is not RESP
+var ErrInvalid = errors.New("invalid RESP data")
+
+// maxLen is the largest length accepted by ReadValue, the default proto-max-bulk-len of Redis
+const maxLen = 512 << 20
+
+// Len returns the length of the first RESP value of data, 0 if the value is not complete yet,
+// or -1 if data is not RESP. Inline commands (like "PING\r\n") are values too.
+func Len(data []byte) int {
+	pos := 0
+	for pending := 1; pending > 0; pending-- {
+		end := bytes.Index(data[pos:], []byte("\r\n"))
+		if end < 0 {
+			return 0
+		}
+		line := data[pos : pos+end]
+		next := pos + end + 2
+
+		if len(line) == 0 {
+			return -1
+		}
+
+		switch line[0] {
+		case '+', '-', ':', '_', '#', ',', '(':
+		case '$', '=', '!':
+			n, err := strconv.Atoi(string(line[1:]))
+			if err != nil || n < -1 {
+				return -1
+			}
+			if n >= 0 {
+				// compared to the rest of data before adding, so that n can't overflow
+				if n > len(data)-next-2 {
+					return 0
+				}
+				next += n + 2
+			}
+		case '*', '~', '>', '%', '|':
+			n, err := strconv.Atoi(string(line[1:]))
+			if err != nil || n < -1 {
+				return -1
+			}
+			// every element takes a few bytes, more elements than the rest of data are not complete yet
+			if n > len(data)-next {
+				return 0
+			}
+			if line[0] == '%' || line[0] == '|' {
+				n *= 2
+			}
+			if line[0] == '|' {
+				n++ // attributes are followed by the actual value
+			}
+			if n > 0 {
+				pending += n
+			}
+			if pending-1 > len(data)-next {
+				return 0
+			}
+		default:
+			// inline commands are only allowed at the top level
+			if pos != 0 {
+				return -1
+			}
+		}
+		pos = next
+	}
+	return pos
+}
+
+// IsPush checks if the value is an out of band RESP3 push, which is not the reply to a command
+func IsPush(value []byte) bool {
+	return len(value) > 0 && value[0] == '>'
+}
+
+// ReadValue reads a whole RESP value from r and appends it to buf
+func ReadValue(r *bufio.Reader, buf []byte) ([]byte, error) {
+	start := len(buf)
+	buf, err := readLine(r, buf)
+	if err != nil {
+		return buf, err
+	}
+	line := buf[start : len(buf)-2]
+	if len(line) == 0 {
+		return buf, ErrInvalid
+	}
+
+	var n int
+	switch line[0] {
+	case '$', '=', '!', '*', '~', '>', '%', '|':
+		if n, err = strconv.Atoi(string(line[1:])); err != nil || n < -1 || n > maxLen {
+			return buf, ErrInvalid
+		}
+	}
+
+	switch line[0] {
+	case '$', '=', '!':
+		if n >= 0 {
+			bulk := make([]byte, n+2)
+			if _, err = io.ReadFull(r, bulk); err != nil {
+				return buf, err
+			}
+			buf = append(buf, bulk...)
+		}
+		return buf, nil
+	case '%', '|':
+		n *= 2
+		if line[0] == '|' {
+			n++ // attributes are followed by the actual value
+		}
+	case '*', '~', '>':
+	default:
+		return buf, nil
+	}
+
+	for i := 0; i < n; i++ {
+		if buf, err = ReadValue(r, buf); err != nil {
+			return buf, err
+		}
+	}
+	return buf, nil
+}
+
+func readLine(r *bufio.Reader, buf []byte) ([]byte, error) {
+	for {
+		line, err := r.ReadSlice('\n')
+		buf = append(buf, line...)
+		if err != bufio.ErrBufferFull {
+			if err == nil && (len(buf) < 2 || buf[len(buf)-2] != '\r') {
+				return buf, ErrInvalid
+			}
+			return buf, err
+		}
+	}
+}
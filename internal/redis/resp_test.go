@@ -0,0 +1,65 @@
+package redis
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestLen(t *testing.T) {
+	tests := []struct {
+		data string
+		len  int
+	}{
+		{"+OK\r\n", 5},
+		{"+OK\r", 0},
+		{":1\r\n:2\r\n", 4},
+		{"$3\r\nfoo\r\n+OK\r\n", 9},
+		{"$3\r\nfo", 0},
+		{"$-1\r\n", 5},
+		{"$4\r\na\r\nb\r\n", 10},
+		{"*2\r\n$3\r\nGET\r\n$1\r\nk\r\n*1\r\n", 20},
+		{"*2\r\n$3\r\nGET\r\n", 0},
+		{"*-1\r\n", 5},
+		{"*0\r\n", 4},
+		{"%1\r\n+a\r\n:1\r\n", 12},
+		{"|1\r\n+ttl\r\n:3\r\n+OK\r\n", 19},
+		{">2\r\n+invalidate\r\n*0\r\n", 21},
+		{"PING\r\n", 6},
+		{"*1\r\nPING\r\n", -1},
+		{"$x\r\n", -1},
+		{"\r\n", -1},
+		{"$-2\r\n", -1},
+		{"*-2\r\n", -1},
+		{"*2\r\n$9223372036854775806\r\n+a\r\n", 0},
+		{"%9223372036854775807\r\n", 0},
+		{"*3\r\n*3\r\n*3\r\n", 0},
+	}
+
+	for _, tt := range tests {
+		if n := Len([]byte(tt.data)); n != tt.len {
+			t.Errorf("expected length of %q to be %d, got %d", tt.data, tt.len, n)
+		}
+	}
+}
+
+func TestReadValue(t *testing.T) {
+	data := "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$4\r\na\r\nb\r\n|1\r\n+ttl\r\n:3\r\n+OK\r\n$-1\r\n"
+	r := bufio.NewReader(strings.NewReader(data))
+
+	for _, expected := range []string{"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$4\r\na\r\nb\r\n", "|1\r\n+ttl\r\n:3\r\n+OK\r\n", "$-1\r\n"} {
+		value, err := ReadValue(r, nil)
+		if err != nil || string(value) != expected {
+			t.Errorf("expected %q, got %q %v", expected, value, err)
+		}
+	}
+	if _, err := ReadValue(r, nil); err == nil {
+		t.Error("expected an error at the end of the data")
+	}
+
+	for _, data := range []string{"$-2\r\n", "$9223372036854775806\r\n", "*9223372036854775807\r\n"} {
+		if _, err := ReadValue(bufio.NewReader(strings.NewReader(data)), nil); err != ErrInvalid {
+			t.Errorf("expected %q to be invalid, got %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"time"
+)
+
+// The PROXY protocol of HAProxy, load balancers send its header at the start of a connection
+// to tell the address of the client, see https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+var (
+	proxyV1Signature = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const (
+	proxyV1MaxLen    = 107
+	proxyV2HeaderLen = 16
+)
+
+// proxiedConn holds the client announced by the PROXY header of a connection,
+// it is announced once but it is the client of all the messages of the connection
+type proxiedConn struct {
+	addr     string
+	lastSeen time.Time
+}
+
+// StripProxyHeader removes the PROXY protocol v1 or v2 header from the start of the payload of a packet,
+// and keeps the source address it announces in Packet.ProxyAddr. It reports whether a header was removed.
+// It is meant to be called by the Start hint of the protocols running behind load balancers, like HTTP.
+func StripProxyHeader(pckt *Packet) bool {
+	n, addr := parseProxyHeader(pckt.Payload)
+	if n == 0 {
+		return false
+	}
+
+	pckt.Payload = pckt.Payload[n:]
+	pckt.Seq += uint32(n)
+	pckt.ProxyAddr = addr
+	stats.Add("proxy_header_count", 1)
+	return true
+}
+
+// parseProxyHeader returns the length of the PROXY header at the start of data and the source address it announces,
+// the length is 0 if there is no complete header. The address is empty for local connections, like health checks.
+func parseProxyHeader(data []byte) (n int, addr string) {
+	switch {
+	case bytes.HasPrefix(data, proxyV1Signature):
+		return parseProxyV1(data)
+	case bytes.HasPrefix(data, proxyV2Signature):
+		return parseProxyV2(data)
+	}
+	return 0, ""
+}
+
+// parseProxyV1 parses the text header, e.g "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+func parseProxyV1(data []byte) (n int, addr string) {
+	if len(data) > proxyV1MaxLen {
+		data = data[:proxyV1MaxLen]
+	}
+	end := bytes.Index(data, []byte("\r\n"))
+	if end < 0 {
+		return 0, ""
+	}
+
+	fields := strings.Fields(string(data[:end]))
+	switch {
+	case len(fields) == 6 && (fields[1] == "TCP4" || fields[1] == "TCP6"):
+		ip := net.ParseIP(fields[2])
+		if ip == nil {
+			return 0, ""
+		}
+		addr = ip.String()
+	case len(fields) >= 2 && fields[1] == "UNKNOWN":
+	default:
+		return 0, ""
+	}
+
+	return end + 2, addr
+}
+
+// parseProxyV2 parses the binary header, the signature is followed by the version and command,
+// the family and the length of the addresses
+func parseProxyV2(data []byte) (n int, addr string) {
+	if len(data) < proxyV2HeaderLen || data[12]>>4 != 2 {
+		return 0, ""
+	}
+	n = proxyV2HeaderLen + int(binary.BigEndian.Uint16(data[14:16]))
+	if len(data) < n {
+		return 0, ""
+	}
+	if data[12]&0xf == 0 {
+		// LOCAL command, the connection was opened by the proxy itself
+		return n, ""
+	}
+
+	addrs := data[proxyV2HeaderLen:n]
+	switch data[13] >> 4 {
+	case 1: // AF_INET
+		if len(addrs) >= 12 {
+			addr = net.IP(addrs[:4]).String()
+		}
+	case 2: // AF_INET6
+		if len(addrs) >= 36 {
+			addr = net.IP(addrs[:16]).String()
+		}
+	}
+
+	return n, addr
+}
+
+// proxyAddr gives a request the client announced by the PROXY header of its connection, pckt is its first packet.
+// It is resolved when the message starts, the connection may be closed before the message is emitted.
+func (parser *MessageParser) proxyAddr(m *Message, pckt *Packet) {
+	if m.Direction == DirOutcoming {
+		return
+	}
+
+	key := streamID(pckt)
+	if pckt.ProxyAddr != "" {
+		parser.proxied[key] = &proxiedConn{addr: pckt.ProxyAddr}
+	}
+	if c, ok := parser.proxied[key]; ok {
+		c.lastSeen = time.Now()
+		m.ProxyAddr = c.addr
+	}
+}
+
+// proxyHeaderOnly keeps the client announced by a packet that only held a PROXY header, there is no message to build
+func (parser *MessageParser) proxyHeaderOnly(pckt *Packet) bool {
+	if len(pckt.Payload) > 0 {
+		return false
+	}
+
+	if pckt.ProxyAddr != "" {
+		parser.proxied[streamID(pckt)] = &proxiedConn{addr: pckt.ProxyAddr, lastSeen: time.Now()}
+	}
+	return true
+}
+
+// closeProxied forgets the client of a connection once one of its sides sent a FIN or a RST
+func (parser *MessageParser) closeProxied(pckt *Packet) {
+	if pckt.FIN || pckt.RST {
+		delete(parser.proxied, streamID(pckt))
+	}
+}
+
+// expireProxied removes the connections which have not been seen for a while,
+// those whose FIN or RST was not captured
+func (parser *MessageParser) expireProxied(now time.Time) {
+	for key, c := range parser.proxied {
+		if now.Sub(c.lastSeen) > StreamExpire {
+			delete(parser.proxied, key)
+		}
+	}
+}
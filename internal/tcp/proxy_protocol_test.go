@@ -0,0 +1,127 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/buger/goreplay/proto"
+)
+
+func proxyV2Header(cmd, family byte, addrs []byte) []byte {
+	h := append([]byte{}, proxyV2Signature...)
+	h = append(h, 0x20|cmd, family)
+	h = binary.BigEndian.AppendUint16(h, uint16(len(addrs)))
+	return append(h, addrs...)
+}
+
+func TestParseProxyHeader(t *testing.T) {
+	v4 := append(append(net.ParseIP("10.1.2.3").To4(), net.ParseIP("10.0.0.1").To4()...), 0xdc, 0x04, 0, 80)
+	v6 := append(append(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")...), 0xdc, 0x04, 0, 80)
+
+	tests := []struct {
+		name string
+		data []byte
+		n    int
+		addr string
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nGET / HTTP/1.1\r\n"), 47, "192.168.0.1"},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"), 46, "2001:db8::1"},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\nGET / HTTP/1.1\r\n"), 15, ""},
+		{"v1 incomplete", []byte("PROXY TCP4 192.168.0.1 192.16"), 0, ""},
+		{"v1 malformed", []byte("PROXY TCP4 localhost 192.168.0.11 56324 443\r\n"), 0, ""},
+		{"v2 ipv4", append(proxyV2Header(1, 0x11, v4), "GET /"...), 28, "10.1.2.3"},
+		{"v2 ipv6", proxyV2Header(1, 0x21, v6), 52, "2001:db8::1"},
+		{"v2 local", proxyV2Header(0, 0, nil), 16, ""},
+		{"v2 incomplete", proxyV2Header(1, 0x11, v4)[:20], 0, ""},
+		{"http", []byte("GET / HTTP/1.1\r\n"), 0, ""},
+	}
+	for _, tt := range tests {
+		n, addr := parseProxyHeader(tt.data)
+		if n != tt.n || addr != tt.addr {
+			t.Errorf("%s: expected %d %q, got %d %q", tt.name, tt.n, tt.addr, n, addr)
+		}
+	}
+}
+
+func TestMessageParserProxyProtocol(t *testing.T) {
+	parser := NewMessageParser(nil, nil, nil, time.Second, false)
+	defer parser.Close()
+	start := func(pckt *Packet) (bool, bool) {
+		StripProxyHeader(pckt)
+		return proto.HasRequestTitle(pckt.Payload), proto.HasResponseTitle(pckt.Payload)
+	}
+	parser.Start = start
+	parser.End = func(m *Message) bool {
+		start(m.Packets()[0])
+		return proto.HasFullPayload(m, m.PacketData()...)
+	}
+
+	header := "PROXY TCP4 192.168.0.1 10.0.0.1 56324 80\r\n"
+	req := "GET / HTTP/1.1\r\nHost: a\r\n\r\n"
+	packets := []*Packet{
+		// the header is sent in a packet of its own
+		{SrcPort: 60000, DstPort: 80, Ack: 100, Seq: 1, Timestamp: time.Unix(1, 0), Payload: []byte(header)},
+		{SrcPort: 60000, DstPort: 80, Ack: 100, Seq: 1 + uint32(len(header)), Direction: DirIncoming, Timestamp: time.Unix(1, 0), Payload: []byte(req)},
+		{SrcPort: 60000, DstPort: 80, Ack: 200, Seq: 1 + uint32(len(header)+len(req)), Direction: DirIncoming, Timestamp: time.Unix(2, 0), Payload: []byte(req)},
+		// the header is sent with the first request
+		{SrcPort: 60001, DstPort: 80, Ack: 100, Seq: 1, Direction: DirIncoming, Timestamp: time.Unix(3, 0), Payload: []byte("PROXY TCP4 192.168.0.2 10.0.0.1 56324 80\r\n" + req[:20])},
+		{SrcPort: 60001, DstPort: 80, Ack: 100, Seq: 1 + uint32(len(header)+20), Direction: DirIncoming, Timestamp: time.Unix(3, 0), Payload: []byte(req[20:])},
+	}
+	for _, p := range packets {
+		parser.processPacket(p)
+	}
+
+	expected := []string{"192.168.0.1", "192.168.0.1", "192.168.0.2"}
+	for i, addr := range expected {
+		var m *Message
+		select {
+		case m = <-parser.messages:
+		case <-time.After(time.Second):
+			t.Fatalf("missing messages, received %d", i)
+		}
+		if string(m.Data()) != req {
+			t.Errorf("expected the request without the PROXY header, got %q", m.Data())
+		}
+		if m.ProxyAddr != addr {
+			t.Errorf("expected the client %s, got %q", addr, m.ProxyAddr)
+		}
+	}
+}
+
+func TestMessageParserProxyProtocolClose(t *testing.T) {
+	parser := NewMessageParser(nil, nil, nil, time.Second, false)
+	defer parser.Close()
+	parser.Start = func(pckt *Packet) (bool, bool) {
+		StripProxyHeader(pckt)
+		return proto.HasRequestTitle(pckt.Payload), proto.HasResponseTitle(pckt.Payload)
+	}
+	parser.End = func(m *Message) bool {
+		return proto.HasFullPayload(m, m.PacketData()...)
+	}
+
+	header := "PROXY TCP4 192.168.0.1 10.0.0.1 56324 80\r\n"
+	req := "GET / HTTP/1.1\r\nHost: a\r\n\r\n"
+	packets := []*Packet{
+		{SrcPort: 60000, DstPort: 80, Ack: 100, Seq: 1, Direction: DirIncoming, Timestamp: time.Unix(1, 0), Payload: []byte(header + req[:20])},
+		// the connection is closed before the end of the request
+		{SrcPort: 80, DstPort: 60000, Ack: 1, Seq: 100, Direction: DirOutcoming, Timestamp: time.Unix(1, 0), FIN: true, ACK: true},
+		{SrcPort: 60000, DstPort: 80, Ack: 100, Seq: 1 + uint32(len(header)+20), Direction: DirIncoming, Timestamp: time.Unix(1, 0), Payload: []byte(req[20:])},
+	}
+	for _, p := range packets {
+		parser.processPacket(p)
+	}
+
+	if len(parser.proxied) != 0 {
+		t.Errorf("expected the client of the closed connection to be forgotten, got %d", len(parser.proxied))
+	}
+	select {
+	case m := <-parser.messages:
+		if m.ProxyAddr != "192.168.0.1" {
+			t.Errorf("expected the client 192.168.0.1, got %q", m.ProxyAddr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("missing message")
+	}
+}
@@ -0,0 +1,120 @@
+package tcp
+
+import (
+	"time"
+)
+
+// ConnEvent is a change of state of a TCP connection, reported as a message without data when MessageParser.Lifecycle is set
+type ConnEvent byte
+
+const (
+	ConnNone  ConnEvent = iota // the message holds data
+	ConnOpen                   // the client sent a SYN
+	ConnClose                  // one of the sides sent a FIN
+	ConnReset                  // one of the sides sent a RST
+)
+
+func (e ConnEvent) String() string {
+	switch e {
+	case ConnOpen:
+		return "open"
+	case ConnClose:
+		return "close"
+	case ConnReset:
+		return "reset"
+	default:
+		return ""
+	}
+}
+
+// connection is the state of a connection whose events were reported
+type connection struct {
+	closed   bool
+	lastSeen time.Time
+}
+
+// connectionEvent reports the opening, closing and reset of the connection of a packet.
+// Retransmissions and the FIN of the other side are reported once.
+func (parser *MessageParser) connectionEvent(pckt *Packet) {
+	if pckt.Direction == DirUnknown || !pckt.SYN && !pckt.FIN && !pckt.RST {
+		return
+	}
+
+	id := streamID(pckt)
+	c, ok := parser.conns[id]
+	var event ConnEvent
+	switch {
+	case pckt.SYN && !pckt.ACK:
+		if ok && !c.closed {
+			return
+		}
+		event = ConnOpen
+		c = new(connection)
+		parser.conns[id] = c
+	case pckt.RST || pckt.FIN:
+		if ok && c.closed {
+			return
+		}
+		event = ConnClose
+		if pckt.RST {
+			event = ConnReset
+		}
+		if !ok {
+			// opened before the capture started
+			c = new(connection)
+			parser.conns[id] = c
+		}
+		c.closed = true
+	default:
+		return
+	}
+	c.lastSeen = time.Now()
+
+	m := &Message{packets: []*Packet{pckt}, parser: parser, Event: event}
+	m.Direction = pckt.Direction
+	m.SrcAddr = pckt.SrcIP.String()
+	m.DstAddr = pckt.DstIP.String()
+	m.Start = pckt.Timestamp
+	m.End = pckt.Timestamp
+	stats.Add("connection_"+event.String()+"_count", 1)
+	parser.messages <- m
+}
+
+// expireConnections removes the connections which have not been seen for a while,
+// the closed ones are kept until the other side may have closed them too
+func (parser *MessageParser) expireConnections(now time.Time) {
+	for id, c := range parser.conns {
+		if now.Sub(c.lastSeen) > StreamExpire || c.closed && now.Sub(c.lastSeen) > 2*parser.messageExpire {
+			delete(parser.conns, id)
+		}
+	}
+}
+
+// Client returns the address of the client of the connection of a message, and Server the address of the server
+func (m *Message) Client() string {
+	if m.Direction == DirOutcoming {
+		return m.packets[0].Dst()
+	}
+	return m.packets[0].Src()
+}
+
+// Server returns the address of the server of the connection of a message, see Client
+func (m *Message) Server() string {
+	if m.Direction == DirOutcoming {
+		return m.packets[0].Src()
+	}
+	return m.packets[0].Dst()
+}
+
+// ConnectionID returns the ID of the connection of a message, it is the start of the UUIDs of its requests and responses
+func (m *Message) ConnectionID() []byte {
+	return ConnectionID(m.UUID())
+}
+
+// ConnectionID returns the ID of the connection of a message from its UUID, the part made of the ports and the ip of the client
+func ConnectionID(uuid []byte) []byte {
+	if len(uuid) > 16 {
+		return uuid[:16]
+	}
+	return uuid
+}
@@ -0,0 +1,77 @@
+package tcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/buger/goreplay/proto"
+	"github.com/google/gopacket/layers"
+)
+
+func TestMessageParserLifecycle(t *testing.T) {
+	parser := NewMessageParser(nil, []uint16{80}, nil, time.Second, false)
+	defer parser.Close()
+	parser.Lifecycle = true
+	parser.End = func(m *Message) bool {
+		return proto.HasFullPayload(m, m.PacketData()...)
+	}
+
+	req := "GET / HTTP/1.1\r\nHost: a\r\n\r\n"
+	now := time.Now()
+	packets := []struct {
+		request bool
+		tcp     *layers.TCP
+		payload string
+	}{
+		{true, &layers.TCP{SrcPort: 60000, DstPort: 80, SYN: true}, ""},
+		{true, &layers.TCP{SrcPort: 60000, DstPort: 80, SYN: true}, ""}, // retransmission
+		{false, &layers.TCP{SrcPort: 80, DstPort: 60000, Ack: 1, SYN: true, ACK: true}, ""},
+		{true, &layers.TCP{SrcPort: 60000, DstPort: 80, Seq: 1, Ack: 1, PSH: true, ACK: true}, req},
+		{true, &layers.TCP{SrcPort: 60000, DstPort: 80, Seq: 1 + uint32(len(req)), Ack: 1, FIN: true, ACK: true}, ""},
+		{false, &layers.TCP{SrcPort: 80, DstPort: 60000, Seq: 1, Ack: 2 + uint32(len(req)), FIN: true, ACK: true}, ""},
+		{false, &layers.TCP{SrcPort: 80, DstPort: 60001, Seq: 1, Ack: 1, RST: true}, ""},
+	}
+	for _, p := range packets {
+		parser.PacketHandler(generatePacket(t, p.request, p.tcp, p.payload, now))
+	}
+
+	expected := []struct {
+		event  ConnEvent
+		client string
+	}{
+		{ConnOpen, "10.0.0.1:60000"},
+		{ConnNone, "10.0.0.1:60000"},
+		{ConnClose, "10.0.0.1:60000"},
+		{ConnReset, "10.0.0.1:60001"},
+	}
+	var connID string
+	for i, e := range expected {
+		var m *Message
+		select {
+		case m = <-parser.messages:
+		case <-time.After(time.Second):
+			t.Fatalf("missing messages, received %d", i)
+		}
+		if m.Event != e.event || m.Client() != e.client || m.Server() != "10.0.0.2:80" {
+			t.Errorf("%d: expected %q event of %s, got %q of %s to %s", i, e.event, e.client, m.Event, m.Client(), m.Server())
+		}
+		if m.Event == ConnNone && string(m.Data()) != req {
+			t.Errorf("expected the request, got %q", m.Data())
+		}
+		if i == 0 {
+			connID = string(m.ConnectionID())
+		}
+		if i < 3 && string(m.ConnectionID()) != connID {
+			t.Errorf("%d: expected the connection %s, got %s", i, connID, m.ConnectionID())
+		}
+		if i == 1 && string(m.UUID()[:16]) != connID {
+			t.Errorf("the UUID of the request should start with the connection ID %s, got %s", connID, m.UUID())
+		}
+	}
+
+	select {
+	case m := <-parser.messages:
+		t.Errorf("unexpected message %q %q", m.Event, m.Data())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
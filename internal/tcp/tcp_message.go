@@ -8,6 +8,7 @@ import (
 	"net"
 	"reflect"
 	"sort"
+	"sync/atomic"
 	"time"
 	"unsafe"
 )
@@ -20,6 +21,14 @@ const (
 	ProtocolHTTP TCPProtocol = iota
 	// ProtocolBinary ...
 	ProtocolBinary
+	// ProtocolHTTP2 ...
+	ProtocolHTTP2
+	// ProtocolPostgres ...
+	ProtocolPostgres
+	// ProtocolMySQL ...
+	ProtocolMySQL
+	// ProtocolRedis ...
+	ProtocolRedis
 )
 
 // Set is here so that TCPProtocol can implement flag.Var
@@ -29,6 +38,14 @@ func (protocol *TCPProtocol) Set(v string) error {
 		*protocol = ProtocolHTTP
 	case "binary":
 		*protocol = ProtocolBinary
+	case "http2":
+		*protocol = ProtocolHTTP2
+	case "postgres":
+		*protocol = ProtocolPostgres
+	case "mysql":
+		*protocol = ProtocolMySQL
+	case "redis":
+		*protocol = ProtocolRedis
 	default:
 		return fmt.Errorf("unsupported protocol %s", v)
 	}
@@ -41,6 +58,14 @@ func (protocol *TCPProtocol) String() string {
 		return "binary"
 	case ProtocolHTTP:
 		return "http"
+	case ProtocolHTTP2:
+		return "http2"
+	case ProtocolPostgres:
+		return "postgres"
+	case ProtocolMySQL:
+		return "mysql"
+	case ProtocolRedis:
+		return "redis"
 	default:
 		return ""
 	}
@@ -54,9 +79,9 @@ type Stats struct {
 	End       time.Time // last packet's timestamp
 	SrcAddr   string
 	DstAddr   string
+	ProxyAddr string // the client announced by the PROXY protocol header of the connection, see StripProxyHeader
 	Direction Dir
 	TimedOut  bool // timeout before getting the whole message
-	Truncated bool // last packet truncated due to max message size
 	IPversion byte
 }
 
@@ -66,11 +91,19 @@ type Message struct {
 	parser           *MessageParser
 	feedback         interface{}
 	continueAdjusted bool
+	pipelined        bool      // the message was split from the previous pipelined one, see MessageParser.Split
+	nextSeq          uint32    // where a pipelined message starts, the data before was emitted
+	upgradeID        []byte    // UUID of the message that switched the connection to the protocol of this one
+	Event            ConnEvent // set when the message reports a change of state of its connection instead of data
 	Stats
 }
 
 // UUID returns the UUID of a TCP request and its response.
 func (m *Message) UUID() []byte {
+	if m.upgradeID != nil {
+		return m.upgradeID
+	}
+
 	var streamID uint64
 	pckt := m.packets[0]
 
@@ -99,6 +132,11 @@ func (m *Message) UUID() []byte {
 }
 
 func (m *Message) add(packet *Packet) bool {
+	// Skip retransmissions of the previous pipelined message
+	if m.pipelined && int32(packet.Seq-m.nextSeq) < 0 {
+		return false
+	}
+
 	// Skip duplicates
 	for _, p := range m.packets {
 		if p.Seq == packet.Seq {
@@ -130,6 +168,12 @@ func (m *Message) add(packet *Packet) bool {
 	return true
 }
 
+// Upgraded reports whether the message was decoded by the handler of a connection switched to another protocol,
+// like a WebSocket frame, see MessageParser.Upgrade
+func (m *Message) Upgraded() bool {
+	return m.upgradeID != nil
+}
+
 // Packets returns packets of the message
 func (m *Message) Packets() []*Packet {
 	return m.packets
@@ -178,6 +222,34 @@ func (m *Message) Data() []byte {
 	return tmp
 }
 
+// SplitData returns the data of the message like Data when it is not longer than limit. The data of longer messages
+// is split: head holds its first limit bytes, and rest the payloads of the packets after them, so that they can be
+// written elsewhere without being copied in memory.
+func (m *Message) SplitData(limit int) (head []byte, rest [][]byte) {
+	if limit <= 0 || m.Length <= limit {
+		return m.Data(), nil
+	}
+
+	packetData := m.PacketData()
+	head = make([]byte, 0, limit)
+	for i, p := range packetData {
+		if len(head)+len(p) > limit {
+			n := limit - len(head)
+			head = append(head, p[:n]...)
+			rest = append([][]byte{p[n:]}, packetData[i+1:]...)
+			break
+		}
+		head = append(head, p...)
+	}
+
+	// Remove Expect header, since its replay not fully supported
+	if state, ok := m.feedback.(*proto.HTTPState); ok && state.Continue100 {
+		head = proto.DeleteHeader(head, []byte("Expect"))
+	}
+
+	return head, rest
+}
+
 // SetProtocolState set feedback/data that can be used later, e.g with End or Start hint
 func (m *Message) SetProtocolState(feedback interface{}) {
 	m.feedback = feedback
@@ -207,18 +279,32 @@ type HintStart func(*Packet) (IsRequest, IsOutgoing bool)
 // MessageParser holds data of all tcp messages in progress(still receiving/sending packets).
 // message is identified by its source port and dst port, and last 4bytes of src IP.
 type MessageParser struct {
-	m map[uint64]*Message
+	m          map[uint64]*Message
+	streams    map[uint64]*Stream
+	tlsStreams map[uint64]*Stream
+	udpFlows   map[uint64]*udpFlow
+	pipelines  map[uint64]*pipeline
+	upgraded   map[uint64]*Stream
+	proxied    map[uint64]*proxiedConn
+	conns      map[uint64]*connection
 
 	messageExpire  time.Duration // the maximum time to wait for the final packet, minimum is 100ms
 	allowIncompete bool
 	End            HintEnd
 	Start          HintStart
+	Split          HintSplit     // when set, messages holding several pipelined ones are split, and their responses paired
+	Upgrade        HintUpgrade   // when set, the connections switched to another protocol are passed to its handler
+	Stream         StreamHandler // when set, whole connections are reassembled and passed to it instead of End and Start
+	TLS            *KeyLog       // when set, TLS connections are decrypted with its keys before being parsed
+	UDP            bool          // when set, UDP datagrams are captured instead of TCP segments
+	Lifecycle      bool          // when set, the opening, closing and reset of connections are emitted as messages, see Message.Event
 	ticker         *time.Ticker
 	messages       chan *Message
 	packets        chan *PcapPacket
-	close          chan struct{} // to signal that we are able to close
-	ports          []uint16
-	ips            []net.IP
+	parsed         chan *Packet             // packets already parsed by a ShardedParser
+	close          chan struct{}            // to signal that we are able to close
+	ports          atomic.Pointer[[]uint16] // the captured ports, they can change while capturing, see SetPorts
+	ips            atomic.Pointer[[]net.IP] // the IPs of the captured hosts, they can change while capturing, see SetIPs
 }
 
 // NewMessageParser returns a new instance of message parser
@@ -233,6 +319,7 @@ func NewMessageParser(messages chan *Message, ports []uint16, ips []net.IP, mess
 	parser.allowIncompete = allowIncompete
 
 	parser.packets = make(chan *PcapPacket, 10000)
+	parser.parsed = make(chan *Packet, 10000)
 
 	if messages == nil {
 		messages = make(chan *Message, 1000)
@@ -240,16 +327,33 @@ func NewMessageParser(messages chan *Message, ports []uint16, ips []net.IP, mess
 	parser.messages = messages
 
 	parser.m = make(map[uint64]*Message)
+	parser.streams = make(map[uint64]*Stream)
+	parser.tlsStreams = make(map[uint64]*Stream)
+	parser.udpFlows = make(map[uint64]*udpFlow)
+	parser.pipelines = make(map[uint64]*pipeline)
+	parser.upgraded = make(map[uint64]*Stream)
+	parser.proxied = make(map[uint64]*proxiedConn)
+	parser.conns = make(map[uint64]*connection)
 	parser.ticker = time.NewTicker(time.Millisecond * 100)
 	parser.close = make(chan struct{}, 1)
 
-	parser.ports = ports
-	parser.ips = ips
+	parser.SetPorts(ports)
+	parser.SetIPs(ips)
 
 	go parser.wait()
 	return parser
 }
 
+// SetIPs replaces the IPs used to tell the incoming packets from the outgoing ones, it is safe to call while capturing
+func (parser *MessageParser) SetIPs(ips []net.IP) {
+	parser.ips.Store(&ips)
+}
+
+// SetPorts replaces the captured ports, it is safe to call while capturing
+func (parser *MessageParser) SetPorts(ports []uint16) {
+	parser.ports.Store(&ports)
+}
+
 var packetLen int
 
 // Packet returns packet handler
@@ -266,6 +370,8 @@ func (parser *MessageParser) wait() {
 		select {
 		case pckt := <-parser.packets:
 			parser.processPacket(parser.parsePacket(pckt))
+		case pckt := <-parser.parsed:
+			parser.processPacket(parser.classify(pckt))
 		case now = <-parser.ticker.C:
 			parser.timer(now)
 		case <-parser.close:
@@ -286,12 +392,21 @@ func (parser *MessageParser) parsePacket(pcapPkt *PcapPacket) *Packet {
 		}
 		return nil
 	}
+	return parser.classify(pckt)
+}
 
-	for _, p := range parser.ports {
-		if pckt.DstPort == p && containsOrEmpty(pckt.DstIP, parser.ips) {
+// classify tells the direction of a packet from the captured ports and IPs, it drops the packets of the other transport
+func (parser *MessageParser) classify(pckt *Packet) *Packet {
+	if pckt.UDP != parser.UDP {
+		return nil
+	}
+
+	ips := *parser.ips.Load()
+	for _, p := range *parser.ports.Load() {
+		if pckt.DstPort == p && containsOrEmpty(pckt.DstIP, ips) {
 			pckt.Direction = DirIncoming
 			break
-		} else if pckt.SrcPort == p && containsOrEmpty(pckt.SrcIP, parser.ips) {
+		} else if pckt.SrcPort == p && containsOrEmpty(pckt.SrcIP, ips) {
 			pckt.Direction = DirOutcoming
 			break
 		}
@@ -317,6 +432,40 @@ func (parser *MessageParser) processPacket(pckt *Packet) {
 		return
 	}
 
+	if pckt.UDP {
+		parser.processDatagram(pckt)
+		return
+	}
+
+	if parser.Lifecycle {
+		parser.connectionEvent(pckt)
+	}
+
+	if parser.TLS != nil {
+		parser.processStreamPacket(parser.tlsStreams, pckt, parser.tlsStreamHandler)
+		return
+	}
+
+	parser.processPlainPacket(pckt)
+	parser.closeProxied(pckt)
+}
+
+// processPlainPacket processes packets with an unencrypted payload
+func (parser *MessageParser) processPlainPacket(pckt *Packet) {
+	if parser.Stream != nil {
+		parser.processStreamPacket(parser.streams, pckt, parser.Stream)
+		return
+	}
+
+	if parser.processUpgradedPacket(pckt) {
+		return
+	}
+
+	// packets opening or closing the connection only matter to streams and connection events
+	if len(pckt.Payload) == 0 {
+		return
+	}
+
 	// Trying to build unique hash, but there is small chance of collision
 	// No matter if it is request or response, all packets in the same message have same
 	m, ok := parser.m[pckt.MessageID()]
@@ -333,8 +482,13 @@ func (parser *MessageParser) processPacket(pckt *Packet) {
 		}
 		parser.addPacket(m, pckt)
 		return
-	case pckt.Direction == DirUnknown && parser.Start != nil:
-		if in, out := parser.Start(pckt); in || out {
+	case parser.Start != nil:
+		n := len(pckt.Payload)
+		in, out := parser.Start(pckt)
+		if len(pckt.Payload) < n && parser.proxyHeaderOnly(pckt) {
+			return
+		}
+		if pckt.Direction == DirUnknown && (in || out) {
 			if in {
 				pckt.Direction = DirIncoming
 			} else {
@@ -352,6 +506,7 @@ func (parser *MessageParser) processPacket(pckt *Packet) {
 
 	m.Start = pckt.Timestamp
 	m.parser = parser
+	parser.proxyAddr(m, pckt)
 	parser.addPacket(m, pckt)
 }
 
@@ -368,6 +523,19 @@ func (parser *MessageParser) addPacket(m *Message, pckt *Packet) bool {
 			return true
 		}
 
+		if parser.Split != nil && !m.MissingChunk() {
+			for n := parser.Split(m); n > 0; n = parser.Split(m) {
+				parser.split(m, n)
+				if parser.upgradeRest(m) {
+					return true
+				}
+				if parser.End(m) {
+					parser.Emit(m)
+					return true
+				}
+			}
+		}
+
 		parser.Fix100Continue(m)
 	}
 
@@ -403,9 +571,23 @@ func (parser *MessageParser) Read() *Message {
 }
 
 func (parser *MessageParser) Emit(m *Message) {
+	delete(parser.m, m.packets[0].MessageID())
+
+	parser.emit(m)
+}
+
+// emit sends a message that is not in progress anymore
+func (parser *MessageParser) emit(m *Message) {
 	stats.Add("message_count", 1)
 
-	delete(parser.m, m.packets[0].MessageID())
+	if parser.Split != nil {
+		parser.pair(m)
+	}
+	if parser.Upgrade != nil {
+		if handler := parser.Upgrade(m); handler != nil {
+			parser.upgrade(m, handler)
+		}
+	}
 
 	parser.messages <- m
 }
@@ -419,7 +601,7 @@ var failMsg int
 func (parser *MessageParser) timer(now time.Time) {
 	packetLen = 0
 
-	packetQueueLen.Set(int64(len(parser.packets)))
+	packetQueueLen.Set(int64(len(parser.packets) + len(parser.parsed)))
 	messageQueueLen.Set(int64(len(parser.m)))
 
 	for _, m := range parser.m {
@@ -427,13 +609,27 @@ func (parser *MessageParser) timer(now time.Time) {
 			m.TimedOut = true
 			stats.Add("message_timeout_count", 1)
 			failMsg++
+			delete(parser.m, m.packets[0].MessageID())
+
 			if parser.End == nil || parser.allowIncompete {
 				parser.Emit(m)
 			}
+		}
+	}
 
-			delete(parser.m, m.packets[0].MessageID())
+	for _, streams := range []map[uint64]*Stream{parser.streams, parser.tlsStreams, parser.upgraded} {
+		for id, s := range streams {
+			if now.Sub(s.lastSeen) > StreamExpire {
+				stats.Add("stream_timeout_count", 1)
+				delete(streams, id)
+			}
 		}
 	}
+
+	parser.expireDatagrams(now)
+	parser.expirePipelines(now)
+	parser.expireProxied(now)
+	parser.expireConnections(now)
 }
 
 func (parser *MessageParser) Close() error {
@@ -64,11 +64,13 @@ type Packet struct {
 	SrcPort, DstPort   uint16
 	Ack, Seq           uint32
 	ACK, SYN, FIN, RST bool
+	UDP                bool // the packet is a UDP datagram, it has no TCP flags or sequence numbers
 	Lost               uint32
 	Retry              int
 	CaptureLength      int
 	Timestamp          time.Time
 	Payload            []byte
+	ProxyAddr          string // the client announced by a PROXY protocol header removed from the payload
 	buf                []byte
 
 	created time.Time
@@ -150,6 +152,9 @@ func (pckt *Packet) parse(data []byte, lType, lTypeLen int, cp *gopacket.Capture
 	} else {
 		return ErrHdrExpected("IPv4 or IPv6")
 	}
+	if proto == 17 {
+		return pckt.parseUDP(netLayer, ldata[len(netLayer):], cp, allowEmpty)
+	}
 	if proto != 6 {
 		return ErrHdrExpected("TCP")
 	}
@@ -178,21 +183,12 @@ func (pckt *Packet) parse(data []byte, lType, lTypeLen int, cp *gopacket.Capture
 		}
 	}
 
-	if !allowEmpty && empty {
+	// packets opening or closing the connection are kept, they matter to streams, see Stream, and to MessageParser.Lifecycle
+	if !allowEmpty && empty && ndata[13]&0x07 == 0 {
 		return EmptyPacket("")
 	}
 
-	if (netLayer[0] >> 4) == 4 {
-		// IPv4 header
-		pckt.Version = 4
-		pckt.SrcIP = netLayer[12:16]
-		pckt.DstIP = netLayer[16:20]
-	} else {
-		// IPv6 header
-		pckt.Version = 6
-		pckt.SrcIP = netLayer[8:24]
-		pckt.DstIP = netLayer[24:40]
-	}
+	pckt.setIPs(netLayer)
 
 	transLayer = ndata[:dOf]
 
@@ -208,10 +204,52 @@ func (pckt *Packet) parse(data []byte, lType, lTypeLen int, cp *gopacket.Capture
 	pckt.Lost = uint32(cp.Length - cp.CaptureLength)
 
 	pckt.Payload = ndata[dOf:]
+	if empty && !allowEmpty {
+		// a control packet, the payload is only padding
+		pckt.Payload = pckt.Payload[:0]
+	}
 
 	return nil
 }
 
+func (pckt *Packet) parseUDP(netLayer, ndata []byte, cp *gopacket.CaptureInfo, allowEmpty bool) error {
+	if len(ndata) < 8 {
+		return ErrHdrLength("UDP")
+	}
+	// the datagram may be followed by the padding of the link layer
+	end := int(binary.BigEndian.Uint16(ndata[4:6]))
+	if end < 8 || end > len(ndata) {
+		end = len(ndata)
+	}
+	if !allowEmpty && end == 8 {
+		return EmptyPacket("")
+	}
+
+	pckt.setIPs(netLayer)
+	pckt.UDP = true
+	pckt.CaptureLength = cp.CaptureLength
+	pckt.SrcPort = binary.BigEndian.Uint16(ndata[0:2])
+	pckt.DstPort = binary.BigEndian.Uint16(ndata[2:4])
+	pckt.Lost = uint32(cp.Length - cp.CaptureLength)
+	pckt.Payload = ndata[8:end]
+
+	return nil
+}
+
+func (pckt *Packet) setIPs(netLayer []byte) {
+	if (netLayer[0] >> 4) == 4 {
+		// IPv4 header
+		pckt.Version = 4
+		pckt.SrcIP = netLayer[12:16]
+		pckt.DstIP = netLayer[16:20]
+	} else {
+		// IPv6 header
+		pckt.Version = 6
+		pckt.SrcIP = netLayer[8:24]
+		pckt.DstIP = netLayer[24:40]
+	}
+}
+
 func (pckt *Packet) MessageID() uint64 {
 	if pckt.messageID == 0 {
 		// All packets in the same message will share the same ID
@@ -222,6 +260,20 @@ func (pckt *Packet) MessageID() uint64 {
 	return pckt.messageID
 }
 
+// flowID is the part of MessageID that is the same for all the packets of a connection, in both directions.
+// The Ack changes with every message, and the ports are swapped in responses.
+func (pckt *Packet) flowID() uint64 {
+	return (uint64(pckt.SrcPort)+uint64(pckt.DstPort))<<32 |
+		uint64(ip2int(pckt.SrcIP)+ip2int(pckt.DstIP))
+}
+
+// FlowHash returns the hash of the connection of a packet, the same in both directions.
+// It spreads the connections among the parsers of a ShardedParser.
+func (pckt *Packet) FlowHash() uint64 {
+	// Fibonacci hashing, the sums of flowID are not evenly spread
+	return (pckt.flowID() * 0x9E3779B97F4A7C15) >> 32
+}
+
 // Src returns the source socket of a packet
 func (pckt *Packet) Src() string {
 	return fmt.Sprintf("%s:%d", pckt.SrcIP, pckt.SrcPort)
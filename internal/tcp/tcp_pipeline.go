@@ -0,0 +1,148 @@
+package tcp
+
+import (
+	"time"
+)
+
+// HintSplit hints the parser to split a message holding several pipelined ones, see MessageParser.Split.
+// It returns the length of the first message once it is complete, or 0.
+type HintSplit func(*Message) int
+
+// maxPendingRequests is the number of pipelined requests of a connection waiting for their responses
+const maxPendingRequests = 128
+
+// pipeline pairs the requests and responses of a connection whose client sends requests
+// without waiting for the responses of the previous ones, as with HTTP pipelining.
+// The pipelined requests share the Ack of the first one, they are given ids of their own,
+// and the responses that do not answer the first request take them in order.
+type pipeline struct {
+	ack      uint32             // Ack of the last request
+	count    uint32             // number of requests pipelined after the first one with this Ack
+	pending  []pipelinedRequest // requests waiting for their response, oldest first
+	lastSeen time.Time
+}
+
+type pipelinedRequest struct {
+	id        uint32
+	pipelined bool // the id is not the Seq of the response
+}
+
+// split emits the first n bytes of a message as a message of its own, the message keeps the rest
+func (parser *MessageParser) split(m *Message, n int) {
+	first := new(Message)
+	*first = *m
+	first.packets = nil
+	first.Length = 0
+	first.LostData = 0
+	first.End = time.Time{}
+
+	var pos int
+	for len(m.packets) > 0 && pos < n {
+		p := m.packets[0]
+		if pos+len(p.Payload) > n {
+			// the packet holds the end of the first message and the start of the next one
+			head, tail := *p, *p
+			head.Payload = p.Payload[:n-pos]
+			tail.Payload = p.Payload[n-pos:]
+			tail.Seq += uint32(n - pos)
+			m.packets[0] = &tail
+			p = &head
+		} else {
+			m.packets = m.packets[1:]
+		}
+		first.add(p)
+		pos += len(p.Payload)
+	}
+
+	m.Length -= first.Length
+	m.LostData = 0
+	m.Start = m.packets[0].Timestamp
+	m.feedback = nil
+	m.continueAdjusted = false
+	m.pipelined = true
+	m.nextSeq = m.packets[0].Seq
+
+	parser.emit(first)
+}
+
+// upgradeRest passes the rest of a split message to the handler of its connection,
+// when the message that was split switched the connection to another protocol
+func (parser *MessageParser) upgradeRest(m *Message) bool {
+	s, ok := parser.upgraded[streamID(m.packets[0])]
+	if !ok {
+		return false
+	}
+
+	delete(parser.m, m.packets[0].MessageID())
+	for _, p := range m.packets {
+		s.add(p, s.handler)
+	}
+	return true
+}
+
+// pair gives the pipelined requests their own ids, and the ids of the requests to their responses
+func (parser *MessageParser) pair(m *Message) {
+	if m.Direction == DirUnknown {
+		return
+	}
+
+	pckt := m.packets[0]
+	key := streamID(pckt)
+	p, ok := parser.pipelines[key]
+	if !ok {
+		if m.Direction == DirOutcoming {
+			// a response without request, nothing to pair
+			return
+		}
+		p = new(pipeline)
+		parser.pipelines[key] = p
+	}
+	p.lastSeen = time.Now()
+
+	if m.Direction == DirIncoming {
+		req := pipelinedRequest{id: pckt.Ack}
+		if len(p.pending) > 0 && pckt.Ack == p.ack {
+			// no response was sent since the previous request
+			p.count++
+			req = pipelinedRequest{id: pckt.Ack + p.count, pipelined: true}
+			for _, pk := range m.packets {
+				pk.Ack = req.id
+				pk.messageID = 0
+			}
+			stats.Add("message_pipelined_count", 1)
+		} else {
+			p.ack, p.count = pckt.Ack, 0
+		}
+		if len(p.pending) == maxPendingRequests {
+			p.pending = p.pending[1:]
+		}
+		p.pending = append(p.pending, req)
+		return
+	}
+
+	for i, req := range p.pending {
+		if req.id == pckt.Seq && !req.pipelined {
+			p.pending = p.pending[i+1:]
+			return
+		}
+	}
+	if len(p.pending) == 0 || !p.pending[0].pipelined {
+		return
+	}
+
+	// the response of a pipelined request, its Seq follows the previous response
+	delta := p.pending[0].id - pckt.Seq
+	for _, pk := range m.packets {
+		pk.Seq += delta
+	}
+	p.pending = p.pending[1:]
+}
+
+// expirePipelines removes the connections which have not been seen for a while
+func (parser *MessageParser) expirePipelines(now time.Time) {
+	for key, p := range parser.pipelines {
+		if now.Sub(p.lastSeen) > StreamExpire || len(p.pending) == 0 && now.Sub(p.lastSeen) > 2*parser.messageExpire {
+			delete(parser.pipelines, key)
+		}
+	}
+}
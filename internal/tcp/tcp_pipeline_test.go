@@ -0,0 +1,66 @@
+package tcp
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/buger/goreplay/proto"
+)
+
+func TestMessageParserPipelining(t *testing.T) {
+	parser := NewMessageParser(nil, nil, nil, time.Second, false)
+	defer parser.Close()
+	parser.Start = func(pckt *Packet) (bool, bool) {
+		return proto.HasRequestTitle(pckt.Payload), proto.HasResponseTitle(pckt.Payload)
+	}
+	parser.End = func(m *Message) bool {
+		return proto.HasFullPayload(m, m.PacketData()...)
+	}
+	parser.Split = func(m *Message) int {
+		return proto.PipelinedLen(m, m.PacketData()...)
+	}
+
+	requests := "GET /1 HTTP/1.1\r\nHost: a\r\n\r\nGET /2 HTTP/1.1\r\nHost: a\r\n\r\nPOST /3 HTTP/1.1\r\nContent-Length: 5\r\n\r\nhel"
+	response := func(i int) string {
+		return fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: 1\r\n\r\n%d", i)
+	}
+	ack := uint32(1 + len(requests) + 2)
+	packets := []*Packet{
+		{SrcPort: 60000, DstPort: 80, Ack: 100, Seq: 1, Direction: DirIncoming, Timestamp: time.Unix(1, 0), Payload: []byte(requests)},
+		{SrcPort: 60000, DstPort: 80, Ack: 100, Seq: 1 + uint32(len(requests)), Direction: DirIncoming, Timestamp: time.Unix(2, 0), Payload: []byte("lo")},
+
+		{SrcPort: 80, DstPort: 60000, Ack: ack, Seq: 100, Direction: DirOutcoming, Timestamp: time.Unix(3, 0), Payload: []byte(response(1) + response(2))},
+		{SrcPort: 80, DstPort: 60000, Ack: ack, Seq: 100 + uint32(2*len(response(1))), Direction: DirOutcoming, Timestamp: time.Unix(4, 0), Payload: []byte(response(3))},
+	}
+	for _, p := range packets {
+		parser.processPacket(p)
+	}
+
+	paths := make(map[string]string)
+	for i := 0; i < 6; i++ {
+		var m *Message
+		select {
+		case m = <-parser.messages:
+		case <-time.After(time.Second):
+			t.Fatalf("missing messages, received %d", i)
+		}
+		data := m.Data()
+		if m.Direction == DirIncoming {
+			paths[string(m.UUID())] += string(proto.Path(data)) + " " + string(proto.Body(data))
+		} else {
+			paths[string(m.UUID())] += " => " + string(proto.Body(data))
+		}
+	}
+
+	expected := map[string]bool{"/1  => 1": true, "/2  => 2": true, "/3 hello => 3": true}
+	for _, pair := range paths {
+		if !expected[pair] {
+			t.Errorf("wrong pairs %q", paths)
+			break
+		}
+	}
+	if len(paths) != 3 {
+		t.Errorf("wrong pairs %q", paths)
+	}
+}
@@ -0,0 +1,90 @@
+package tcp
+
+import (
+	"net"
+	"time"
+)
+
+// ShardedParser spreads the packets among independent message parsers, so that they are reassembled on several cores.
+// Packets are hashed by connection: a parser receives both directions of the connections it handles, which the
+// stream, TLS and UDP modes need, and Fix100Continue finds the next part of a message in the same parser.
+// All the parsers emit to the same channel of messages.
+type ShardedParser struct {
+	shards []*MessageParser
+}
+
+// NewShardedParser returns n message parsers behind a single packet handler, see NewMessageParser
+func NewShardedParser(n int, messages chan *Message, ports []uint16, ips []net.IP, messageExpire time.Duration, allowIncompete bool) *ShardedParser {
+	if n < 1 {
+		n = 1
+	}
+	if messages == nil {
+		messages = make(chan *Message, 1000)
+	}
+
+	s := &ShardedParser{shards: make([]*MessageParser, n)}
+	for i := range s.shards {
+		s.shards[i] = NewMessageParser(messages, ports, ips, messageExpire, allowIncompete)
+	}
+	return s
+}
+
+// Shards returns the parsers, to set their hints before handling packets
+func (s *ShardedParser) Shards() []*MessageParser {
+	return s.shards
+}
+
+// SetIPs replaces the IPs of all the parsers, see MessageParser.SetIPs
+func (s *ShardedParser) SetIPs(ips []net.IP) {
+	for _, shard := range s.shards {
+		shard.SetIPs(ips)
+	}
+}
+
+// SetPorts replaces the captured ports of all the parsers, see MessageParser.SetPorts
+func (s *ShardedParser) SetPorts(ports []uint16) {
+	for _, shard := range s.shards {
+		shard.SetPorts(ports)
+	}
+}
+
+// PacketHandler parses the headers of a packet to pass it to the parser of its connection.
+// With a single parser, the packet is parsed by the parser itself.
+func (s *ShardedParser) PacketHandler(packet *PcapPacket) {
+	if len(s.shards) == 1 {
+		s.shards[0].PacketHandler(packet)
+		return
+	}
+
+	pckt, err := ParsePacket(packet.Data, packet.LType, packet.LTypeLen, packet.Ci, false)
+	if err != nil {
+		if _, empty := err.(EmptyPacket); !empty {
+			stats.Add("packet_error", 1)
+		}
+		return
+	}
+	s.shard(pckt).parsed <- pckt
+}
+
+// ParsedPacketHandler passes a packet whose headers were parsed by ParsePacket to the parser of its connection
+func (s *ShardedParser) ParsedPacketHandler(pckt *Packet) {
+	s.shard(pckt).parsed <- pckt
+}
+
+// shard returns the parser of the connection of a packet
+func (s *ShardedParser) shard(pckt *Packet) *MessageParser {
+	return s.shards[pckt.FlowHash()%uint64(len(s.shards))]
+}
+
+// Read returns the next message of any parser
+func (s *ShardedParser) Read() *Message {
+	return s.shards[0].Read()
+}
+
+// Close stops all the parsers
+func (s *ShardedParser) Close() error {
+	for _, shard := range s.shards {
+		shard.Close()
+	}
+	return nil
+}
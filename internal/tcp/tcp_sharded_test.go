@@ -0,0 +1,71 @@
+package tcp
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/buger/goreplay/proto"
+	"github.com/google/gopacket/layers"
+)
+
+func TestShardedParser(t *testing.T) {
+	p := NewShardedParser(4, nil, []uint16{80}, nil, time.Second, false)
+	defer p.Close()
+	for _, shard := range p.Shards() {
+		shard.Start = func(pckt *Packet) (bool, bool) {
+			return proto.HasRequestTitle(pckt.Payload), proto.HasResponseTitle(pckt.Payload)
+		}
+		shard.End = func(m *Message) bool {
+			return proto.HasFullPayload(m, m.PacketData()...)
+		}
+	}
+
+	used := make(map[*MessageParser]bool)
+	const connections = 32
+	for i := 0; i < connections; i++ {
+		client := uint16(40000 + i)
+		req := fmt.Sprintf("POST /%d HTTP/1.1\r\nContent-Length: 7\r\n\r\n", i)
+		res := "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"
+		reqPacket := generatePacket(t, true, &layers.TCP{SrcPort: layers.TCPPort(client), DstPort: 80, Seq: 1000, Ack: 5000, PSH: true, ACK: true}, req, time.Now())
+		resPacket := generatePacket(t, false, &layers.TCP{SrcPort: 80, DstPort: layers.TCPPort(client), Seq: 5000, Ack: 1000 + uint32(len(req)) + 7, PSH: true, ACK: true}, res, time.Now())
+
+		// both directions of a connection are handled by the same parser
+		a, _ := ParsePacket(reqPacket.Data, reqPacket.LType, reqPacket.LTypeLen, reqPacket.Ci, false)
+		b, _ := ParsePacket(resPacket.Data, resPacket.LType, resPacket.LTypeLen, resPacket.Ci, false)
+		if p.shard(a) != p.shard(b) {
+			t.Fatalf("connection %d is split among parsers", i)
+		}
+		used[p.shard(a)] = true
+
+		p.PacketHandler(reqPacket)
+		p.PacketHandler(generatePacket(t, true, &layers.TCP{SrcPort: layers.TCPPort(client), DstPort: 80, Seq: 1000 + uint32(len(req)), Ack: 5000, PSH: true, ACK: true}, "Network", time.Now()))
+		p.PacketHandler(resPacket)
+	}
+	if len(used) < 2 {
+		t.Errorf("connections are not spread among parsers: %d", len(used))
+	}
+
+	requests := make(map[string]bool)
+	responses := make(map[string]bool)
+	for i := 0; i < 2*connections; i++ {
+		select {
+		case m := <-p.Shards()[0].messages:
+			if m.Direction == DirIncoming {
+				requests[string(m.UUID())] = true
+			} else {
+				responses[string(m.UUID())] = true
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("missing messages, received %d", i)
+		}
+	}
+	if len(requests) != connections || len(responses) != connections {
+		t.Fatalf("wrong messages: %d requests, %d responses", len(requests), len(responses))
+	}
+	for id := range requests {
+		if !responses[id] {
+			t.Errorf("request %s has no response", id)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"net"
+	"sort"
+	"time"
+)
+
+// StreamHandler decodes the reassembled payload of a tcp connection, see MessageParser.Stream.
+// It is called with all the bytes of one direction that are in order and were not consumed yet,
+// and returns how many of them it has consumed; the rest is passed again together with the next payload.
+// data is only valid during the call, the stream reuses it, handlers copy what they pass to Emit.
+type StreamHandler func(s *Stream, dir Dir, data []byte) (consumed int)
+
+// HintUpgrade tells if an HTTP message switches its connection to another protocol, like the response
+// of a WebSocket handshake, see MessageParser.Upgrade. The rest of the connection is reassembled and passed
+// to the returned handler, and the messages it emits share the UUID of the upgrading message.
+type HintUpgrade func(*Message) StreamHandler
+
+// maxPendingPackets is the number of out of order packets a stream holds before it gives up
+// on the missing segment and skips it.
+const maxPendingPackets = 128
+
+// StreamExpire is the time after which an idle stream is forgotten
+var StreamExpire = 5 * time.Minute
+
+// MaxStreamBuffer is the number of bytes a direction of a stream holds while its handler does not consume them,
+// they are skipped above it, like a missing segment.
+var MaxStreamBuffer = 64 << 20
+
+// Stream is the representation of a tcp connection reassembled in both directions.
+// Src is always the client side of the connection and Dst the server side.
+type Stream struct {
+	SrcIP, DstIP     net.IP
+	SrcPort, DstPort uint16
+	Version          uint8
+
+	parser    *MessageParser
+	halves    [2]streamHalf
+	direction Dir // Direction of the packet being processed
+	feedback  interface{}
+	lastSeen  time.Time // wall clock, packets from pcap files carry old timestamps
+	now       time.Time // timestamp of the packet currently processed
+	closed    bool
+	handler   StreamHandler // handler of a connection switched to another protocol, see MessageParser.Upgrade
+	upgradeID []byte        // UUID of the message that switched the protocol
+}
+
+type streamHalf struct {
+	started bool
+	fin     bool
+	ack     uint32 // next sequence number expected from the other side
+	isn     uint32
+	nextSeq uint32
+	pending []*Packet
+	buf     []byte
+	start   time.Time // timestamp of the first unconsumed byte
+	lost    int
+}
+
+func streamID(pckt *Packet) uint64 {
+	a := make([]byte, 0, 36)
+	b := make([]byte, 0, 18)
+	a = append(a, pckt.SrcIP...)
+	a = binary.BigEndian.AppendUint16(a, pckt.SrcPort)
+	b = append(b, pckt.DstIP...)
+	b = binary.BigEndian.AppendUint16(b, pckt.DstPort)
+
+	// same ID regardless of the direction of the packet
+	if string(a) > string(b) {
+		a, b = b, a
+	}
+
+	h := fnv.New64a()
+	h.Write(a)
+	h.Write(b)
+	return h.Sum64()
+}
+
+func newStream(parser *MessageParser, pckt *Packet) *Stream {
+	s := &Stream{parser: parser, Version: pckt.Version}
+
+	client := true
+	switch {
+	case pckt.Direction == DirOutcoming:
+		client = false
+	case pckt.Direction == DirUnknown && pckt.SYN && pckt.ACK:
+		client = false
+	}
+
+	if client {
+		s.SrcIP, s.SrcPort, s.DstIP, s.DstPort = pckt.SrcIP, pckt.SrcPort, pckt.DstIP, pckt.DstPort
+	} else {
+		s.SrcIP, s.SrcPort, s.DstIP, s.DstPort = pckt.DstIP, pckt.DstPort, pckt.SrcIP, pckt.SrcPort
+	}
+
+	return s
+}
+
+// Dir returns the direction of the packet relative to this stream
+func (s *Stream) Dir(pckt *Packet) Dir {
+	if pckt.SrcPort == s.SrcPort && pckt.SrcIP.Equal(s.SrcIP) {
+		return DirIncoming
+	}
+	return DirOutcoming
+}
+
+// SetProtocolState set feedback/data that can be used later by the stream handler
+func (s *Stream) SetProtocolState(feedback interface{}) {
+	s.feedback = feedback
+}
+
+// ProtocolState returns feedback associated to this stream
+func (s *Stream) ProtocolState() interface{} {
+	return s.feedback
+}
+
+// Timestamp returns the timestamp of the packet being processed
+func (s *Stream) Timestamp() time.Time {
+	return s.now
+}
+
+// Start returns the timestamp of the first byte that was not consumed yet in the given direction
+func (s *Stream) Start(dir Dir) time.Time {
+	return s.half(dir).start
+}
+
+// ISN returns the sequence number that started the reassembly of the given direction,
+// it can be used by handlers to generate IDs that are unique across connections.
+func (s *Stream) ISN(dir Dir) uint32 {
+	return s.half(dir).isn
+}
+
+func (s *Stream) half(dir Dir) *streamHalf {
+	if dir == DirIncoming {
+		return &s.halves[0]
+	}
+	return &s.halves[1]
+}
+
+// Emit builds a new message out of a decoded payload and sends it to the parser's messages.
+// Requests and responses emitted with same id share the same UUID.
+func (s *Stream) Emit(dir Dir, id uint32, data []byte, start, end time.Time) {
+	pckt := &Packet{
+		Direction: dir,
+		Version:   s.Version,
+		Timestamp: start,
+		Payload:   data,
+	}
+
+	if dir == DirIncoming {
+		pckt.SrcIP, pckt.SrcPort, pckt.DstIP, pckt.DstPort = s.SrcIP, s.SrcPort, s.DstIP, s.DstPort
+		pckt.Ack = id
+	} else {
+		pckt.SrcIP, pckt.SrcPort, pckt.DstIP, pckt.DstPort = s.DstIP, s.DstPort, s.SrcIP, s.SrcPort
+		pckt.Seq = id
+	}
+
+	m := new(Message)
+	m.packets = []*Packet{pckt}
+	m.parser = s.parser
+	m.Direction = dir
+	m.SrcAddr = pckt.SrcIP.String()
+	m.DstAddr = pckt.DstIP.String()
+	m.IPversion = s.Version
+	m.Length = len(data)
+	m.LostData = s.half(dir).lost
+	m.Start = start
+	m.End = end
+	m.upgradeID = s.upgradeID
+	s.half(dir).lost = 0
+
+	stats.Add("message_count", 1)
+	s.parser.messages <- m
+}
+
+// add reassembles the packet and passes the in-order data to the handler
+func (s *Stream) add(pckt *Packet, handler StreamHandler) {
+	s.lastSeen = time.Now()
+
+	dir := s.Dir(pckt)
+	h := s.half(dir)
+
+	h.fin = h.fin || pckt.FIN
+	if pckt.ACK {
+		h.ack = pckt.Ack
+	}
+	s.closed = pckt.RST || (s.halves[0].fin && s.halves[1].fin)
+	if len(pckt.Payload) == 0 {
+		return
+	}
+
+	if !h.started {
+		h.started = true
+		h.isn = pckt.Seq
+		// the other side tells us where this direction starts if the first packet came out of order
+		if other := s.half(DirIncoming + DirOutcoming - dir); other.ack != 0 && int32(pckt.Seq-other.ack) > 0 &&
+			pckt.Seq-other.ack < 1<<16 {
+			h.isn = other.ack
+		}
+		h.nextSeq = h.isn
+	}
+
+	if diff := int32(pckt.Seq - h.nextSeq); diff > 0 {
+		// a segment is missing, wait for it
+		h.pending = append(h.pending, pckt)
+		sort.SliceStable(h.pending, func(i, j int) bool {
+			return int32(h.pending[i].Seq-h.pending[j].Seq) < 0
+		})
+		if len(h.pending) <= maxPendingPackets {
+			return
+		}
+
+		stats.Add("stream_gap_count", 1)
+		h.lost += int(h.pending[0].Seq - h.nextSeq)
+		h.nextSeq = h.pending[0].Seq
+	} else {
+		h.pending = append([]*Packet{pckt}, h.pending...)
+	}
+
+	for len(h.pending) > 0 {
+		p := h.pending[0]
+		diff := int32(p.Seq - h.nextSeq)
+		if diff > 0 {
+			break
+		}
+		h.pending = h.pending[1:]
+
+		// retransmission, skip what we have already seen
+		if -diff >= int32(len(p.Payload)) {
+			continue
+		}
+		if len(h.buf) == 0 {
+			h.start = p.Timestamp
+		}
+		h.buf = append(h.buf, p.Payload[-diff:]...)
+		h.nextSeq = p.Seq + uint32(len(p.Payload))
+		h.lost += int(p.Lost)
+	}
+
+	s.now = pckt.Timestamp
+	s.direction = pckt.Direction
+	n := handler(s, dir, h.buf)
+	switch {
+	case n >= len(h.buf):
+		h.buf = h.buf[:0]
+	case len(h.buf)-n > MaxStreamBuffer:
+		stats.Add("stream_overflow_count", 1)
+		h.lost += len(h.buf) - n
+		h.buf = nil
+	case n > 0:
+		h.buf = append(h.buf[:0], h.buf[n:]...)
+		h.start = pckt.Timestamp
+	}
+}
+
+func (parser *MessageParser) processStreamPacket(streams map[uint64]*Stream, pckt *Packet, handler StreamHandler) {
+	id := streamID(pckt)
+	s, ok := streams[id]
+	if !ok {
+		s = newStream(parser, pckt)
+		streams[id] = s
+	}
+
+	s.add(pckt, handler)
+
+	if s.closed {
+		delete(streams, id)
+	}
+}
+
+// upgrade passes the rest of the connection of a message to the handler of another protocol
+func (parser *MessageParser) upgrade(m *Message, handler StreamHandler) {
+	first := *m.packets[0]
+	first.Direction = m.Direction
+	s := newStream(parser, &first)
+	s.handler = handler
+	s.upgradeID = m.UUID()
+	s.lastSeen = time.Now()
+	parser.upgraded[streamID(m.packets[0])] = s
+	stats.Add("stream_upgrade_count", 1)
+}
+
+// processUpgradedPacket passes a packet to the handler of its connection, if the connection was switched to another protocol
+func (parser *MessageParser) processUpgradedPacket(pckt *Packet) bool {
+	if len(parser.upgraded) == 0 {
+		return false
+	}
+	id := streamID(pckt)
+	s, ok := parser.upgraded[id]
+	if !ok {
+		return false
+	}
+
+	s.add(pckt, s.handler)
+
+	if s.closed {
+		delete(parser.upgraded, id)
+	}
+	return true
+}
@@ -3,6 +3,8 @@ package tcp
 import (
 	"bytes"
 	"encoding/binary"
+	"net"
+
 	"github.com/buger/goreplay/proto"
 
 	// "runtime"
@@ -15,6 +17,38 @@ import (
 	"github.com/google/gopacket/layers"
 )
 
+// generatePacket serializes an Ethernet frame of transport between 10.0.0.1, the client, and 10.0.0.2,
+// the ports are the ones of transport
+func generatePacket(t *testing.T, request bool, transport gopacket.SerializableLayer, payload string, ts time.Time) *PcapPacket {
+	ip := &layers.IPv4{Version: 4, TTL: 64, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	if !request {
+		ip.SrcIP, ip.DstIP = ip.DstIP, ip.SrcIP
+	}
+	switch l := transport.(type) {
+	case *layers.TCP:
+		ip.Protocol = layers.IPProtocolTCP
+		l.SetNetworkLayerForChecksum(ip)
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		l.SetNetworkLayerForChecksum(ip)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		&layers.Ethernet{EthernetType: layers.EthernetTypeIPv4, SrcMAC: net.HardwareAddr{1, 2, 3, 4, 5, 6}, DstMAC: net.HardwareAddr{1, 2, 3, 4, 5, 7}},
+		ip, transport, gopacket.Payload(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	return &PcapPacket{
+		Data:     data,
+		LType:    int(layers.LinkTypeEthernet),
+		LTypeLen: 14,
+		Ci:       &gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(data), Length: len(data)},
+	}
+}
+
 func generateHeader(request bool, seq uint32, length uint16) []byte {
 	hdr := make([]byte, 4+24+24)
 	binary.BigEndian.PutUint32(hdr, uint32(layers.ProtocolFamilyIPv4))
@@ -231,6 +265,85 @@ func TestMessageTimeoutReached(t *testing.T) {
 	}
 }
 
+func TestMessageSplitData(t *testing.T) {
+	m := new(Message)
+	m.add(&Packet{Seq: 1, Payload: []byte("0123")})
+	m.add(&Packet{Seq: 5, Payload: []byte("4567")})
+	m.add(&Packet{Seq: 9, Payload: []byte("89")})
+
+	if head, rest := m.SplitData(10); string(head) != "0123456789" || rest != nil {
+		t.Errorf("expected the whole data, got %q %q", head, rest)
+	}
+	head, rest := m.SplitData(6)
+	if string(head) != "012345" || len(rest) != 2 || string(rest[0]) != "67" || string(rest[1]) != "89" {
+		t.Errorf("expected the data split after 6 bytes, got %q %q", head, rest)
+	}
+}
+
+func TestStreamReassembly(t *testing.T) {
+	var got [2][]byte
+	p := NewMessageParser(nil, nil, nil, time.Second, false)
+	p.Stream = func(s *Stream, dir Dir, data []byte) int {
+		// consume only whole lines
+		n := bytes.LastIndexByte(data, '\n') + 1
+		got[dir-DirIncoming] = append(got[dir-DirIncoming], data[:n]...)
+		if n > 0 {
+			s.Emit(dir, s.ISN(DirIncoming), append([]byte(nil), data[:n]...), s.Start(dir), s.Timestamp())
+		}
+		return n
+	}
+
+	packets := []*Packet{
+		{SrcPort: 60000, DstPort: 80, Seq: 100, Ack: 500, ACK: true, Direction: DirIncoming, Payload: []byte("PING")},
+		// out of order, the first response packet is known from the request's Ack
+		{SrcPort: 80, DstPort: 60000, Seq: 505, Ack: 108, ACK: true, Direction: DirOutcoming, Payload: []byte("\n")},
+		{SrcPort: 60000, DstPort: 80, Seq: 104, Ack: 500, ACK: true, Direction: DirIncoming, Payload: []byte(" 1\n")},
+		// retransmission
+		{SrcPort: 60000, DstPort: 80, Seq: 104, Ack: 500, ACK: true, Direction: DirIncoming, Payload: []byte(" 1\n")},
+		{SrcPort: 80, DstPort: 60000, Seq: 500, Ack: 107, ACK: true, Direction: DirOutcoming, Payload: []byte("PONG ")},
+	}
+	for _, pckt := range packets {
+		p.processPacket(pckt)
+	}
+
+	req, res := p.Read(), p.Read()
+	assert.Equal(t, "PING 1\n", string(got[0]))
+	assert.Equal(t, "PONG \n", string(got[1]))
+	assert.Equal(t, "PING 1\n", string(req.Data()))
+	assert.Equal(t, "PONG \n", string(res.Data()))
+	assert.Equal(t, req.UUID(), res.UUID())
+}
+
+func TestStreamBufferLimit(t *testing.T) {
+	defer func(limit int) { MaxStreamBuffer = limit }(MaxStreamBuffer)
+	MaxStreamBuffer = 8
+
+	var got []byte
+	p := NewMessageParser(nil, nil, nil, time.Second, false)
+	p.Stream = func(s *Stream, dir Dir, data []byte) int {
+		// consume only whole lines
+		n := bytes.LastIndexByte(data, '\n') + 1
+		got = append(got, data[:n]...)
+		return n
+	}
+
+	packets := []*Packet{
+		{SrcPort: 60000, DstPort: 80, Seq: 100, Ack: 500, ACK: true, Direction: DirIncoming, Payload: []byte("PING")},
+		// the line is never ended, it is skipped once it is above the limit
+		{SrcPort: 60000, DstPort: 80, Seq: 104, Ack: 500, ACK: true, Direction: DirIncoming, Payload: []byte(" 12345")},
+		{SrcPort: 60000, DstPort: 80, Seq: 110, Ack: 500, ACK: true, Direction: DirIncoming, Payload: []byte("PONG\n")},
+	}
+	for _, pckt := range packets {
+		p.processPacket(pckt)
+	}
+
+	assert.Equal(t, "PONG\n", string(got))
+	s := p.streams[streamID(packets[0])]
+	if s == nil || s.halves[0].lost != 10 {
+		t.Errorf("expected the skipped bytes to be counted as lost, got %+v", s)
+	}
+}
+
 func BenchmarkMessageUUID(b *testing.B) {
 	packets := GetPackets(true, 1, 5, nil)
 
@@ -0,0 +1,460 @@
+package tcp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	_ "crypto/sha256" // hashes of the supported cipher suites
+	_ "crypto/sha512"
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// TLS record content types
+const (
+	tlsChangeCipherSpec = 20
+	tlsAlert            = 21
+	tlsHandshake        = 22
+	tlsApplicationData  = 23
+)
+
+// TLS handshake message types
+const (
+	tlsClientHello = 1
+	tlsServerHello = 2
+	tlsFinished    = 20
+	tlsKeyUpdate   = 24
+)
+
+const (
+	tlsRecordHeaderLen = 5
+	tlsVersion13       = 0x0304
+	// maxTLSPending is the amount of data held while waiting for the keys to appear in the key log
+	maxTLSPending = 1 << 20
+)
+
+// helloRetryRequest is the random of a TLS 1.3 ServerHello asking for another ClientHello
+var helloRetryRequest = []byte{
+	0xcf, 0x21, 0xad, 0x74, 0xe5, 0x9a, 0x61, 0x11, 0xbe, 0x1d, 0x8c, 0x02, 0x1e, 0x65, 0xb8, 0x91,
+	0xc2, 0xa2, 0x11, 0x16, 0x7a, 0xbb, 0x8c, 0x5e, 0x07, 0x9e, 0x09, 0xe2, 0xc8, 0xa8, 0x33, 0x9c,
+}
+
+var errTLSMissingKeys = errors.New("missing TLS keys")
+
+// tlsSuite describes an AEAD cipher suite, CBC suites can not be decrypted
+type tlsSuite struct {
+	hash   crypto.Hash
+	keyLen int
+	ivLen  int // fixed part of the nonce in TLS 1.2
+	aead   func(key []byte) (cipher.AEAD, error)
+}
+
+func aesGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+var tlsSuites = map[uint16]tlsSuite{
+	// TLS 1.3
+	0x1301: {crypto.SHA256, 16, 12, aesGCM},
+	0x1302: {crypto.SHA384, 32, 12, aesGCM},
+	0x1303: {crypto.SHA256, 32, 12, chacha20poly1305.New},
+	// TLS 1.2
+	0x009c: {crypto.SHA256, 16, 4, aesGCM},
+	0x009d: {crypto.SHA384, 32, 4, aesGCM},
+	0x009e: {crypto.SHA256, 16, 4, aesGCM},
+	0x009f: {crypto.SHA384, 32, 4, aesGCM},
+	0xc02b: {crypto.SHA256, 16, 4, aesGCM},
+	0xc02c: {crypto.SHA384, 32, 4, aesGCM},
+	0xc02f: {crypto.SHA256, 16, 4, aesGCM},
+	0xc030: {crypto.SHA384, 32, 4, aesGCM},
+	0xcca8: {crypto.SHA256, 32, 12, chacha20poly1305.New},
+	0xcca9: {crypto.SHA256, 32, 12, chacha20poly1305.New},
+	0xccaa: {crypto.SHA256, 32, 12, chacha20poly1305.New},
+}
+
+// tlsState is the state of the decryption of a single connection
+type tlsState struct {
+	keys         *KeyLog
+	plaintext    bool // not a TLS connection, the data is passed as is
+	failed       bool // the connection can not be decrypted
+	clientRandom []byte
+	serverRandom []byte
+	version      uint16
+	suite        tlsSuite
+	halves       [2]tlsHalf
+
+	// the sequence numbers of the decrypted data
+	plainSeq [2]uint32
+	started  [2]bool
+}
+
+// tlsHalf holds the keys of one direction
+type tlsHalf struct {
+	encrypted bool   // the records of this direction are encrypted
+	label     string // key log label of the current secret (TLS 1.3), or CLIENT_RANDOM
+	secret    []byte // current traffic secret (TLS 1.3)
+	aead      cipher.AEAD
+	iv        []byte
+	seq       uint64
+	handshake []byte // handshake messages may span records
+}
+
+func tlsIndex(dir Dir) int {
+	if dir == DirIncoming {
+		return 0
+	}
+	return 1
+}
+
+// tlsStreamHandler decrypts the TLS records of a connection, the decrypted data is passed to
+// the parser as if it was captured in packets.
+func (parser *MessageParser) tlsStreamHandler(s *Stream, dir Dir, data []byte) (consumed int) {
+	state, _ := s.ProtocolState().(*tlsState)
+	if state == nil {
+		if len(data) < 3 {
+			return 0
+		}
+		state = &tlsState{keys: parser.TLS}
+		switch {
+		case !isTLSRecord(data):
+			state.plaintext = true
+		case data[0] != tlsHandshake:
+			// picked up after the handshake, only connections starting with a handshake record can be decrypted
+			stats.Add("tls_midstream", 1)
+			state.failed = true
+		}
+		s.SetProtocolState(state)
+	}
+
+	if state.plaintext {
+		state.inject(s, dir, append([]byte(nil), data...))
+		return len(data)
+	}
+
+	for !state.failed {
+		if len(data)-consumed < tlsRecordHeaderLen {
+			return
+		}
+		header := data[consumed : consumed+tlsRecordHeaderLen]
+		length := int(binary.BigEndian.Uint16(header[3:5]))
+		if header[0] < tlsChangeCipherSpec || header[0] > tlsApplicationData+1 || header[1] != 3 {
+			stats.Add("tls_invalid_record", 1)
+			state.failed = true
+			break
+		}
+		if len(data)-consumed < tlsRecordHeaderLen+length {
+			return
+		}
+
+		record := data[consumed : consumed+tlsRecordHeaderLen+length]
+		if err := state.record(s, dir, record); err == errTLSMissingKeys {
+			// the application may not have written the keys yet
+			if len(data) < maxTLSPending {
+				return
+			}
+			stats.Add("tls_missing_keys", 1)
+			state.failed = true
+			break
+		}
+		consumed += len(record)
+	}
+
+	return len(data)
+}
+
+// isTLSRecord checks if data starts with the header of a TLS record, a content type followed by a 3.x version
+func isTLSRecord(data []byte) bool {
+	return data[0] >= tlsChangeCipherSpec && data[0] <= tlsApplicationData && data[1] == 3 && data[2] <= 0x0f
+}
+
+// record processes a single record
+func (state *tlsState) record(s *Stream, dir Dir, record []byte) error {
+	h := &state.halves[tlsIndex(dir)]
+	typ := record[0]
+	fragment := record[tlsRecordHeaderLen:]
+
+	if typ == tlsChangeCipherSpec {
+		if state.version != tlsVersion13 {
+			h.encrypted = true
+			h.label = keyLogClientRandom
+			h.aead = nil
+			h.seq = 0
+		}
+		return nil
+	}
+
+	if h.encrypted {
+		if h.aead == nil {
+			if err := state.installKeys(dir); err != nil {
+				return err
+			}
+		}
+		plain, err := state.decrypt(h, record)
+		if err != nil {
+			stats.Add("tls_decrypt_error", 1)
+			return nil
+		}
+		fragment = plain
+		if state.version == tlsVersion13 {
+			// the actual content type follows the content, before the padding
+			fragment = bytes.TrimRight(fragment, "\x00")
+			if len(fragment) == 0 {
+				return nil
+			}
+			typ = fragment[len(fragment)-1]
+			fragment = fragment[:len(fragment)-1]
+		}
+	}
+
+	switch typ {
+	case tlsHandshake:
+		state.handshake(dir, h, fragment)
+	case tlsApplicationData:
+		if len(fragment) > 0 {
+			state.inject(s, dir, fragment)
+		}
+	}
+	return nil
+}
+
+// handshake processes the handshake messages, which are only needed to find the keys
+func (state *tlsState) handshake(dir Dir, h *tlsHalf, fragment []byte) {
+	h.handshake = append(h.handshake, fragment...)
+	for len(h.handshake) >= 4 {
+		length := int(h.handshake[1])<<16 | int(h.handshake[2])<<8 | int(h.handshake[3])
+		if len(h.handshake) < 4+length {
+			return
+		}
+		typ, body := h.handshake[0], h.handshake[4:4+length]
+		h.handshake = h.handshake[4+length:]
+
+		switch typ {
+		case tlsClientHello:
+			if len(body) >= 34 {
+				state.clientRandom = append([]byte(nil), body[2:34]...)
+			}
+		case tlsServerHello:
+			state.serverHello(body)
+		case tlsFinished:
+			// TLS 1.3 application secrets are used after the Finished message
+			if state.version == tlsVersion13 {
+				h.label = keyLogClientTrafficSecret
+				if dir == DirOutcoming {
+					h.label = keyLogServerTrafficSecret
+				}
+				h.secret, h.aead, h.seq = nil, nil, 0
+			}
+		case tlsKeyUpdate:
+			if state.version == tlsVersion13 && h.secret != nil {
+				h.secret = hkdfExpandLabel(state.suite.hash, h.secret, "traffic upd", state.suite.hash.Size())
+				state.setTrafficKeys(h)
+			}
+		}
+	}
+}
+
+func (state *tlsState) serverHello(body []byte) {
+	// version, random, session id, cipher suite, compression, extensions
+	if len(body) < 35 {
+		return
+	}
+	if bytes.Equal(body[2:34], helloRetryRequest) {
+		return
+	}
+	state.version = binary.BigEndian.Uint16(body[0:2])
+	state.serverRandom = append([]byte(nil), body[2:34]...)
+
+	pos := 35 + int(body[34])
+	if len(body) < pos+3 {
+		return
+	}
+	suite, ok := tlsSuites[binary.BigEndian.Uint16(body[pos:])]
+	if !ok {
+		stats.Add("tls_unsupported_cipher", 1)
+		state.failed = true
+		return
+	}
+	state.suite = suite
+
+	pos += 3
+	if len(body) >= pos+2 {
+		ext := body[pos+2:]
+		for len(ext) >= 4 {
+			extType := binary.BigEndian.Uint16(ext[0:2])
+			extLen := int(binary.BigEndian.Uint16(ext[2:4]))
+			if len(ext) < 4+extLen {
+				break
+			}
+			// supported_versions
+			if extType == 43 && extLen == 2 {
+				state.version = binary.BigEndian.Uint16(ext[4:6])
+			}
+			ext = ext[4+extLen:]
+		}
+	}
+
+	if state.version == tlsVersion13 {
+		// everything after the ServerHello is encrypted with the handshake secrets
+		state.halves[0].encrypted, state.halves[0].label = true, keyLogClientHandshakeSecret
+		state.halves[1].encrypted, state.halves[1].label = true, keyLogServerHandshakeSecret
+	}
+}
+
+// installKeys finds the secret of the half in the key log and derives its keys
+func (state *tlsState) installKeys(dir Dir) error {
+	h := &state.halves[tlsIndex(dir)]
+	if state.clientRandom == nil || state.suite.aead == nil {
+		state.failed = true
+		return nil
+	}
+
+	if state.version == tlsVersion13 {
+		if h.secret == nil {
+			h.secret = state.keys.Secret(h.label, state.clientRandom)
+			if h.secret == nil {
+				return errTLSMissingKeys
+			}
+		}
+		return state.setTrafficKeys(h)
+	}
+
+	master := state.keys.Secret(keyLogClientRandom, state.clientRandom)
+	if master == nil || state.serverRandom == nil {
+		return errTLSMissingKeys
+	}
+	// client key, server key, client IV, server IV
+	seed := append(append([]byte(nil), state.serverRandom...), state.clientRandom...)
+	block := tlsPRF(state.suite.hash, master, "key expansion", seed, 2*state.suite.keyLen+2*state.suite.ivLen)
+	key := block[tlsIndex(dir)*state.suite.keyLen:][:state.suite.keyLen]
+	iv := block[2*state.suite.keyLen+tlsIndex(dir)*state.suite.ivLen:][:state.suite.ivLen]
+
+	aead, err := state.suite.aead(key)
+	if err != nil {
+		state.failed = true
+		return nil
+	}
+	h.aead, h.iv = aead, iv
+	return nil
+}
+
+func (state *tlsState) setTrafficKeys(h *tlsHalf) error {
+	key := hkdfExpandLabel(state.suite.hash, h.secret, "key", state.suite.keyLen)
+	aead, err := state.suite.aead(key)
+	if err != nil {
+		state.failed = true
+		return nil
+	}
+	h.aead = aead
+	h.iv = hkdfExpandLabel(state.suite.hash, h.secret, "iv", 12)
+	h.seq = 0
+	return nil
+}
+
+// decrypt decrypts a record, and increments the sequence number of the half
+func (state *tlsState) decrypt(h *tlsHalf, record []byte) ([]byte, error) {
+	header, payload := record[:tlsRecordHeaderLen], record[tlsRecordHeaderLen:]
+	seq := h.seq
+	h.seq++
+
+	nonce := make([]byte, h.aead.NonceSize())
+	var additional []byte
+	if len(h.iv) == 4 {
+		// TLS 1.2 AES-GCM: fixed IV and the explicit nonce sent with the record
+		if len(payload) < 8+h.aead.Overhead() {
+			return nil, errors.New("short record")
+		}
+		copy(nonce, h.iv)
+		copy(nonce[4:], payload[:8])
+		payload = payload[8:]
+	} else {
+		copy(nonce, h.iv)
+		for i := 0; i < 8; i++ {
+			nonce[len(nonce)-1-i] ^= byte(seq >> (8 * i))
+		}
+	}
+
+	if state.version == tlsVersion13 {
+		additional = header
+	} else {
+		if len(payload) < h.aead.Overhead() {
+			return nil, errors.New("short record")
+		}
+		additional = binary.BigEndian.AppendUint64(nil, seq)
+		additional = append(additional, header[:3]...)
+		additional = binary.BigEndian.AppendUint16(additional, uint16(len(payload)-h.aead.Overhead()))
+	}
+
+	return h.aead.Open(nil, nonce, payload, additional)
+}
+
+// inject passes decrypted data to the parser as a packet. The sequence numbers count the decrypted bytes,
+// so that requests and responses are paired like unencrypted ones.
+func (state *tlsState) inject(s *Stream, dir Dir, data []byte) {
+	for i, d := range []Dir{DirIncoming, DirOutcoming} {
+		if !state.started[i] {
+			state.started[i] = true
+			state.plainSeq[i] = s.ISN(d)
+		}
+	}
+
+	i := tlsIndex(dir)
+	pckt := &Packet{
+		Direction: s.direction,
+		Version:   s.Version,
+		Timestamp: s.now,
+		ACK:       true,
+		Seq:       state.plainSeq[i],
+		Ack:       state.plainSeq[1-i],
+		Payload:   data,
+	}
+	if dir == DirIncoming {
+		pckt.SrcIP, pckt.SrcPort, pckt.DstIP, pckt.DstPort = s.SrcIP, s.SrcPort, s.DstIP, s.DstPort
+	} else {
+		pckt.SrcIP, pckt.SrcPort, pckt.DstIP, pckt.DstPort = s.DstIP, s.DstPort, s.SrcIP, s.SrcPort
+	}
+	state.plainSeq[i] += uint32(len(data))
+
+	stats.Add("tls_decrypted_bytes", int64(len(data)))
+	s.parser.processPlainPacket(pckt)
+}
+
+// hkdfExpandLabel is HKDF-Expand-Label of TLS 1.3 with an empty context
+func hkdfExpandLabel(hash crypto.Hash, secret []byte, label string, length int) []byte {
+	label = "tls13 " + label
+	info := []byte{byte(length >> 8), byte(length), byte(len(label))}
+	info = append(info, label...)
+	info = append(info, 0)
+
+	out := make([]byte, length)
+	hkdf.Expand(hash.New, secret, info).Read(out)
+	return out
+}
+
+// tlsPRF is the TLS 1.2 pseudorandom function
+func tlsPRF(hash crypto.Hash, secret []byte, label string, seed []byte, length int) []byte {
+	seed = append([]byte(label), seed...)
+	mac := hmac.New(hash.New, secret)
+
+	out := make([]byte, 0, length)
+	a := seed
+	for len(out) < length {
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(seed)
+		out = mac.Sum(out)
+	}
+	return out[:length]
+}
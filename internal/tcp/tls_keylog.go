@@ -0,0 +1,97 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// NSS key log labels, see https://firefox-source-docs.mozilla.org/security/nss/legacy/key_log_format/index.html
+const (
+	keyLogClientRandom          = "CLIENT_RANDOM" // TLS 1.2 master secret
+	keyLogClientHandshakeSecret = "CLIENT_HANDSHAKE_TRAFFIC_SECRET"
+	keyLogServerHandshakeSecret = "SERVER_HANDSHAKE_TRAFFIC_SECRET"
+	keyLogClientTrafficSecret   = "CLIENT_TRAFFIC_SECRET_0"
+	keyLogServerTrafficSecret   = "SERVER_TRAFFIC_SECRET_0"
+)
+
+// keyLogReload is the minimum time between two reads of the key log file
+var keyLogReload = 100 * time.Millisecond
+
+// KeyLog holds the TLS secrets of a NSS key log file, as written by SSLKEYLOGFILE or tls.Config.KeyLogWriter.
+// The file is read again when a secret is missing, applications keep appending to it.
+type KeyLog struct {
+	path string
+
+	mu       sync.Mutex
+	secrets  map[string][]byte // label and client random
+	offset   int64             // end of the last complete line read
+	lastRead time.Time
+}
+
+// NewKeyLog reads the key log file at path
+func NewKeyLog(path string) (*KeyLog, error) {
+	k := &KeyLog{path: path, secrets: make(map[string][]byte)}
+	if err := k.read(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Secret returns the secret of the given label for the connection identified by its client random
+func (k *KeyLog) Secret(label string, clientRandom []byte) []byte {
+	key := label + " " + hex.EncodeToString(clientRandom)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if secret, ok := k.secrets[key]; ok {
+		return secret
+	}
+	if time.Since(k.lastRead) < keyLogReload {
+		return nil
+	}
+	if err := k.read(); err != nil {
+		stats.Add("tls_keylog_error", 1)
+	}
+	return k.secrets[key]
+}
+
+// read parses the lines appended since the last read
+func (k *KeyLog) read() error {
+	k.lastRead = time.Now()
+
+	f, err := os.Open(k.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = f.Seek(k.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			// partial lines are read again once they are complete
+			return nil
+		}
+		k.offset += int64(len(line))
+
+		fields := bytes.Fields(line)
+		if len(fields) != 3 || bytes.HasPrefix(fields[0], []byte("#")) {
+			continue
+		}
+		secret := make([]byte, hex.DecodedLen(len(fields[2])))
+		if _, err = hex.Decode(secret, fields[2]); err != nil {
+			continue
+		}
+		k.secrets[string(fields[0])+" "+string(bytes.ToLower(fields[1]))] = secret
+	}
+}
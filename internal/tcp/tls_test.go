@@ -0,0 +1,196 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordedConn keeps everything written on a connection, in the order of the writes of both sides
+type recordedConn struct {
+	net.Conn
+	dir     Dir
+	mu      *sync.Mutex
+	packets *[]*Packet
+	seq     *[2]uint32
+}
+
+func (c *recordedConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	i := tlsIndex(c.dir)
+	pckt := &Packet{Direction: c.dir, ACK: true, Seq: c.seq[i], Ack: c.seq[1-i], Payload: append([]byte(nil), b...)}
+	if c.dir == DirIncoming {
+		pckt.SrcPort, pckt.DstPort = 60000, 443
+	} else {
+		pckt.SrcPort, pckt.DstPort = 443, 60000
+	}
+	c.seq[i] += uint32(len(b))
+	*c.packets = append(*c.packets, pckt)
+	c.mu.Unlock()
+	return c.Conn.Write(b)
+}
+
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "goreplay"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// recordTLS runs a request and a response over TLS, and returns the captured packets
+func recordTLS(t *testing.T, client *tls.Config, cert tls.Certificate) []*Packet {
+	var mu sync.Mutex
+	var packets []*Packet
+	seq := [2]uint32{1000, 5000}
+
+	c, s := net.Pipe()
+	clientConn := tls.Client(&recordedConn{c, DirIncoming, &mu, &packets, &seq}, client)
+	serverConn := tls.Server(&recordedConn{s, DirOutcoming, &mu, &packets, &seq}, &tls.Config{Certificates: []tls.Certificate{cert}})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		line, err := bufio.NewReader(serverConn).ReadString('\n')
+		if err != nil || line != "PING\n" {
+			t.Errorf("wrong request %q: %v", line, err)
+			return
+		}
+		serverConn.Write([]byte("PONG\n"))
+	}()
+
+	clientConn.Write([]byte("PING\n"))
+	line, err := bufio.NewReader(clientConn).ReadString('\n')
+	if err != nil || line != "PONG\n" {
+		t.Fatalf("wrong response %q: %v", line, err)
+	}
+	<-done
+	c.Close()
+	s.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	return packets
+}
+
+func TestTLSDecryption(t *testing.T) {
+	defer func(reload time.Duration) { keyLogReload = reload }(keyLogReload)
+	keyLogReload = 0
+
+	cert := testCertificate(t)
+	tests := []struct {
+		name    string
+		version uint16
+		suite   uint16
+	}{
+		{"TLS 1.3", tls.VersionTLS13, 0},
+		{"TLS 1.2 AES-128-GCM", tls.VersionTLS12, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		{"TLS 1.2 AES-256-GCM", tls.VersionTLS12, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+		{"TLS 1.2 ChaCha20-Poly1305", tls.VersionTLS12, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.log")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			// the keys are written after the key log is opened, like with a running application
+			keys, err := NewKeyLog(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config := &tls.Config{InsecureSkipVerify: true, KeyLogWriter: f, MinVersion: tt.version, MaxVersion: tt.version}
+			if tt.suite != 0 {
+				config.CipherSuites = []uint16{tt.suite}
+			}
+			packets := recordTLS(t, config, cert)
+
+			var got [2][]byte
+			p := NewMessageParser(nil, nil, nil, time.Second, false)
+			p.TLS = keys
+			p.Stream = func(s *Stream, dir Dir, data []byte) int {
+				n := bytes.LastIndexByte(data, '\n') + 1
+				got[tlsIndex(dir)] = append(got[tlsIndex(dir)], data[:n]...)
+				if n > 0 {
+					s.Emit(dir, s.ISN(DirIncoming), append([]byte(nil), data[:n]...), s.Start(dir), s.Timestamp())
+				}
+				return n
+			}
+			for _, pckt := range packets {
+				p.processPacket(pckt)
+			}
+
+			assert.Equal(t, "PING\n", string(got[0]))
+			assert.Equal(t, "PONG\n", string(got[1]))
+			req, res := p.Read(), p.Read()
+			assert.Equal(t, "PING\n", string(req.Data()))
+			assert.Equal(t, "PONG\n", string(res.Data()))
+			assert.Equal(t, req.UUID(), res.UUID())
+		})
+	}
+}
+
+func TestTLSPlaintext(t *testing.T) {
+	keys := &KeyLog{secrets: make(map[string][]byte)}
+	p := NewMessageParser(nil, nil, nil, time.Second, false)
+	p.TLS = keys
+	p.Start = func(pckt *Packet) (bool, bool) {
+		return bytes.HasPrefix(pckt.Payload, []byte("GET")), false
+	}
+	p.End = func(m *Message) bool {
+		return bytes.HasSuffix(m.Data(), []byte("\r\n\r\n"))
+	}
+
+	p.processPacket(&Packet{SrcPort: 60000, DstPort: 80, Seq: 100, Ack: 500, ACK: true, Direction: DirIncoming, Payload: []byte("GET / HTTP/1.1\r\n\r\n")})
+
+	m := p.Read()
+	assert.Equal(t, "GET / HTTP/1.1\r\n\r\n", string(m.Data()))
+}
+
+func TestTLSMidstream(t *testing.T) {
+	keys := &KeyLog{secrets: make(map[string][]byte)}
+	p := NewMessageParser(nil, nil, nil, time.Second, false)
+	p.TLS = keys
+	var got []byte
+	p.Stream = func(s *Stream, dir Dir, data []byte) int {
+		got = append(got, data...)
+		return len(data)
+	}
+
+	// an application data record of a connection whose handshake was not captured
+	record := []byte{tlsApplicationData, 3, 3, 0, 5, 'G', 'E', 'T', ' ', '/'}
+	p.processPacket(&Packet{SrcPort: 60000, DstPort: 443, Seq: 100, Ack: 500, ACK: true, Direction: DirIncoming, Payload: record})
+	p.processPacket(&Packet{SrcPort: 60000, DstPort: 443, Seq: 110, Ack: 500, ACK: true, Direction: DirIncoming, Payload: []byte("GET / HTTP/1.1\r\n\r\n")})
+
+	if len(got) != 0 {
+		t.Errorf("expected the connection to be skipped, got %q", got)
+	}
+}
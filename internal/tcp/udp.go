@@ -0,0 +1,79 @@
+package tcp
+
+import (
+	"time"
+)
+
+// udpFlow pairs the datagrams exchanged between a client and a server.
+// Every request datagram is a message, and the next datagram sent back by the server
+// before the message expiration is its response.
+type udpFlow struct {
+	next     uint32       // id of the next message
+	pending  []udpRequest // requests waiting for a response, oldest first
+	lastSeen time.Time
+}
+
+type udpRequest struct {
+	id        uint32
+	timestamp time.Time
+}
+
+// processDatagram turns a datagram into a message
+func (parser *MessageParser) processDatagram(pckt *Packet) {
+	if pckt.Direction == DirUnknown {
+		stats.Add("udp_unknown_direction", 1)
+		return
+	}
+
+	key := streamID(pckt)
+	flow, ok := parser.udpFlows[key]
+	if !ok {
+		// like TCP sequence numbers, ids of a flow seen again later must not be the same
+		flow = &udpFlow{next: uint32(pckt.Timestamp.UnixNano())}
+		parser.udpFlows[key] = flow
+	}
+	flow.lastSeen = time.Now()
+
+	if pckt.Direction == DirIncoming {
+		pckt.Ack = flow.next
+		flow.pending = append(flow.pending, udpRequest{flow.next, pckt.Timestamp})
+		flow.next++
+	} else {
+		for len(flow.pending) > 0 && pckt.Timestamp.Sub(flow.pending[0].timestamp) > parser.messageExpire {
+			flow.pending = flow.pending[1:]
+			stats.Add("udp_unanswered_count", 1)
+		}
+		if len(flow.pending) > 0 {
+			pckt.Seq = flow.pending[0].id
+			flow.pending = flow.pending[1:]
+		} else {
+			// not a response, or its request was not captured
+			pckt.Seq = flow.next
+			flow.next++
+		}
+	}
+
+	m := new(Message)
+	m.packets = []*Packet{pckt}
+	m.parser = parser
+	m.Direction = pckt.Direction
+	m.SrcAddr = pckt.SrcIP.String()
+	m.DstAddr = pckt.DstIP.String()
+	m.IPversion = pckt.Version
+	m.Length = len(pckt.Payload)
+	m.LostData = int(pckt.Lost)
+	m.Start = pckt.Timestamp
+	m.End = pckt.Timestamp
+
+	stats.Add("message_count", 1)
+	parser.messages <- m
+}
+
+// expireDatagrams removes the flows which have not been seen for a while
+func (parser *MessageParser) expireDatagrams(now time.Time) {
+	for key, flow := range parser.udpFlows {
+		if now.Sub(flow.lastSeen) > StreamExpire {
+			delete(parser.udpFlows, key)
+		}
+	}
+}
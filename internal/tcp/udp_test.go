@@ -0,0 +1,53 @@
+package tcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPMessages(t *testing.T) {
+	p := NewMessageParser(nil, []uint16{53}, nil, time.Second, false)
+	p.UDP = true
+	defer p.Close()
+
+	query, answer := &layers.UDP{SrcPort: 40000, DstPort: 53}, &layers.UDP{SrcPort: 53, DstPort: 40000}
+	now := time.Now()
+	// two queries in flight on the same flow, then their responses
+	p.PacketHandler(generatePacket(t, true, query, "query 1", now))
+	p.PacketHandler(generatePacket(t, true, query, "query 2", now))
+	p.PacketHandler(generatePacket(t, false, answer, "answer 1", now.Add(time.Millisecond)))
+	p.PacketHandler(generatePacket(t, false, answer, "answer 2", now.Add(time.Millisecond)))
+	// the query expired before the answer
+	p.PacketHandler(generatePacket(t, true, query, "query 3", now))
+	p.PacketHandler(generatePacket(t, false, answer, "late answer", now.Add(2*time.Second)))
+
+	var messages []*Message
+	for i := 0; i < 6; i++ {
+		select {
+		case m := <-p.messages:
+			messages = append(messages, m)
+		case <-time.After(time.Second):
+			t.Fatalf("expected 6 messages, got %d", len(messages))
+		}
+	}
+
+	for i, expected := range []string{"query 1", "query 2", "answer 1", "answer 2", "query 3", "late answer"} {
+		assert.Equal(t, expected, string(messages[i].Data()))
+	}
+	assert.Equal(t, Dir(DirIncoming), messages[0].Direction)
+	assert.Equal(t, Dir(DirOutcoming), messages[2].Direction)
+	assert.Equal(t, messages[0].UUID(), messages[2].UUID())
+	assert.Equal(t, messages[1].UUID(), messages[3].UUID())
+	assert.NotEqual(t, messages[0].UUID(), messages[1].UUID())
+	assert.NotEqual(t, messages[4].UUID(), messages[5].UUID())
+}
+
+func TestUDPIgnoredWithTCP(t *testing.T) {
+	p := NewMessageParser(nil, []uint16{53}, nil, time.Second, false)
+	defer p.Close()
+
+	assert.Nil(t, p.parsePacket(generatePacket(t, true, &layers.UDP{SrcPort: 40000, DstPort: 53}, "query", time.Now())))
+}
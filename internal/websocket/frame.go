@@ -0,0 +1,162 @@
+/*
+Package websocket implements the framing of the WebSocket protocol (RFC 6455),
+used to capture and replay the frames of WebSocket sessions.
+*/
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Opcodes of the frames
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+const (
+	finBit  = 0x80
+	maskBit = 0x80
+
+	// maxFrameSize is the largest payload accepted, larger lengths are taken as invalid frames instead of being buffered
+	maxFrameSize = 1 << 31
+)
+
+// ErrInvalid is returned for data which is not a WebSocket frame
+var ErrInvalid = errors.New("invalid WebSocket frame")
+
+// header returns the length of the header of a frame, including the masking key, and the length of its payload.
+// The header length is 0 if the header is not complete yet.
+func header(data []byte) (hdr int, length uint64) {
+	if len(data) < 2 {
+		return 0, 0
+	}
+	hdr = 2
+	length = uint64(data[1] &^ maskBit)
+	switch length {
+	case 126:
+		hdr += 2
+		if len(data) < hdr {
+			return 0, 0
+		}
+		length = uint64(binary.BigEndian.Uint16(data[2:]))
+	case 127:
+		hdr += 8
+		if len(data) < hdr {
+			return 0, 0
+		}
+		length = binary.BigEndian.Uint64(data[2:])
+	}
+	if data[1]&maskBit != 0 {
+		hdr += 4
+		if len(data) < hdr {
+			return 0, 0
+		}
+	}
+	return hdr, length
+}
+
+// validOpcode reports whether the opcode is defined by RFC 6455
+func validOpcode(op byte) bool {
+	return op <= OpBinary || op >= OpClose && op <= OpPong
+}
+
+// Len returns the length of the first frame of data, 0 if the frame is not complete yet,
+// or -1 if data is not a frame or its payload is larger than 2GB.
+func Len(data []byte) int {
+	if len(data) > 0 && !validOpcode(Opcode(data)) {
+		return -1
+	}
+	hdr, length := header(data)
+	if hdr == 0 {
+		return 0
+	}
+	if length > maxFrameSize {
+		return -1
+	}
+	if uint64(len(data)-hdr) < length {
+		return 0
+	}
+	return hdr + int(length)
+}
+
+// Opcode returns the opcode of a frame
+func Opcode(frame []byte) byte {
+	return frame[0] & 0x0F
+}
+
+// IsMasked reports whether the payload of a frame is masked, as in the frames sent by clients
+func IsMasked(frame []byte) bool {
+	return len(frame) > 1 && frame[1]&maskBit != 0
+}
+
+// Unmask returns a copy of a whole frame without masking key, with the payload in clear.
+// Frames with an incomplete header are copied as they are.
+func Unmask(frame []byte) []byte {
+	hdr, _ := header(frame)
+	if hdr == 0 || !IsMasked(frame) {
+		return append([]byte(nil), frame...)
+	}
+	out := make([]byte, 0, len(frame)-4)
+	out = append(out, frame[:hdr-4]...)
+	out[1] &^= maskBit
+	key := frame[hdr-4 : hdr]
+	for i, b := range frame[hdr:] {
+		out = append(out, b^key[i%4])
+	}
+	return out
+}
+
+// Mask returns a copy of a whole unmasked frame with its payload masked with the key, as clients must send them.
+// Frames with an incomplete header are copied as they are.
+func Mask(frame []byte, key [4]byte) []byte {
+	if IsMasked(frame) {
+		frame = Unmask(frame)
+	}
+	hdr, _ := header(frame)
+	if hdr == 0 {
+		return append([]byte(nil), frame...)
+	}
+	out := make([]byte, 0, len(frame)+4)
+	out = append(out, frame[:hdr]...)
+	out[1] |= maskBit
+	out = append(out, key[:]...)
+	for i, b := range frame[hdr:] {
+		out = append(out, b^key[i%4])
+	}
+	return out
+}
+
+// IsFinal reports whether the frame is the last fragment of a message
+func IsFinal(frame []byte) bool {
+	return frame[0]&finBit != 0
+}
+
+// ReadFrame reads a whole frame from r and appends it to buf
+func ReadFrame(r *bufio.Reader, buf []byte) ([]byte, error) {
+	start := len(buf)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return buf, err
+		}
+		buf = append(buf, b)
+		if hdr, length := header(buf[start:]); hdr != 0 {
+			if !validOpcode(Opcode(buf[start:])) || length > maxFrameSize {
+				return buf, ErrInvalid
+			}
+			payload := make([]byte, length)
+			if _, err = io.ReadFull(r, payload); err != nil {
+				return buf, err
+			}
+			return append(buf, payload...), nil
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLen(t *testing.T) {
+	long := append([]byte{0x82, 126, 0x01, 0x00}, make([]byte, 256)...)
+	tests := []struct {
+		data string
+		len  int
+	}{
+		{"\x81\x05hello", 7},
+		{"\x81\x05hel", 0},
+		{"\x81", 0},
+		{"\x81\x85\x01\x02\x03\x04hello\x88\x00", 11},
+		{"\x81\x85\x01\x02", 0},
+		{"\x88\x00", 2},
+		{string(long), len(long)},
+		{string(long[:100]), 0},
+		{"\x83\x00", -1},
+		{"\x82\x7f\x00\x00\x00\x01\x00\x00\x00\x00", -1},
+		{"GET / HTTP/1.1\r\n", -1},
+	}
+
+	for _, tt := range tests {
+		if n := Len([]byte(tt.data)); n != tt.len {
+			t.Errorf("expected length of %q to be %d, got %d", tt.data, tt.len, n)
+		}
+	}
+}
+
+func TestMask(t *testing.T) {
+	frame := []byte("\x81\x05hello")
+	masked := Mask(frame, [4]byte{1, 2, 3, 4})
+	if !IsMasked(masked) || len(masked) != len(frame)+4 || bytes.Contains(masked, []byte("hello")) {
+		t.Errorf("wrong masked frame %q", masked)
+	}
+	if unmasked := Unmask(masked); !bytes.Equal(unmasked, frame) {
+		t.Errorf("expected %q, got %q", frame, unmasked)
+	}
+	if Opcode(masked) != OpText || !IsFinal(masked) {
+		t.Errorf("wrong header %q", masked)
+	}
+
+	for _, frame := range [][]byte{{}, {0x81}, {0x81, 0xFE, 0x01}, {0x81, 0x85, 1, 2}} {
+		if masked := Mask(frame, [4]byte{1, 2, 3, 4}); !bytes.Equal(masked, frame) {
+			t.Errorf("expected the incomplete frame %q to be copied, got %q", frame, masked)
+		}
+		if unmasked := Unmask(frame); !bytes.Equal(unmasked, frame) {
+			t.Errorf("expected the incomplete frame %q to be copied, got %q", frame, unmasked)
+		}
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("\x81\x05hello\x89\x80\x01\x02\x03\x04\x83\x00"))
+	frame, err := ReadFrame(r, nil)
+	if err != nil || string(frame) != "\x81\x05hello" {
+		t.Errorf("wrong frame %q %v", frame, err)
+	}
+	frame, err = ReadFrame(r, nil)
+	if err != nil || Opcode(frame) != OpPing || !IsMasked(frame) {
+		t.Errorf("wrong frame %q %v", frame, err)
+	}
+	if _, err = ReadFrame(r, nil); err != ErrInvalid {
+		t.Errorf("expected an invalid frame, got %v", err)
+	}
+}
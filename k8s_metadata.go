@@ -0,0 +1,138 @@
+package goreplay
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/buger/goreplay/internal/capture"
+	"github.com/buger/goreplay/proto"
+)
+
+// setPodHeaders injects the metadata of the pods of a request, with headers named after the prefix:
+//
+//	X-K8s-Src-Pod: default/web-7848d4b86f-5nxz8
+//	X-K8s-Src-Workload: Deployment/web
+//	X-K8s-Src-Labels: app=web,pod-template-hash=7848d4b86f
+func setPodHeaders(data []byte, prefix string, src, dst *capture.PodInfo) []byte {
+	for _, p := range []struct {
+		name string
+		pod  *capture.PodInfo
+	}{{"-Src-", src}, {"-Dst-", dst}} {
+		if p.pod == nil {
+			continue
+		}
+		data = proto.SetHeader(data, []byte(prefix+p.name+"Pod"), []byte(p.pod.Namespace+"/"+p.pod.Name))
+		if p.pod.Workload != "" {
+			data = proto.SetHeader(data, []byte(prefix+p.name+"Workload"), []byte(p.pod.Workload))
+		}
+		if len(p.pod.Labels) > 0 {
+			data = proto.SetHeader(data, []byte(prefix+p.name+"Labels"), []byte(podLabels(p.pod.Labels)))
+		}
+	}
+	return data
+}
+
+func podLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Handling of --k8s-allow, --k8s-disallow options
+type k8sFilter struct {
+	src    bool   // the pod of the client, else the pod of the server
+	field  string // pod, namespace, workload or label
+	label  string
+	regexp *regexp.Regexp
+}
+
+// K8sFilters holds list of pod metadata fields and their regexps
+type K8sFilters []k8sFilter
+
+func (f *K8sFilters) String() string {
+	return fmt.Sprint(*f)
+}
+
+// Set method to implement flags.Value
+func (f *K8sFilters) Set(value string) error {
+	valArr := strings.SplitN(value, ":", 2)
+	if len(valArr) < 2 {
+		return errors.New("need both field and value, colon-delimited (ex. src-namespace:^prod$)")
+	}
+
+	var filter k8sFilter
+	field := valArr[0]
+	switch {
+	case strings.HasPrefix(field, "src-"):
+		filter.src = true
+	case strings.HasPrefix(field, "dst-"):
+	default:
+		return fmt.Errorf("unknown k8s field %q, expected src- or dst- prefix", field)
+	}
+	filter.field = field[4:]
+	if strings.HasPrefix(filter.field, "label.") {
+		filter.field, filter.label = "label", filter.field[6:]
+	}
+	switch filter.field {
+	case "pod", "namespace", "workload", "label":
+	default:
+		return fmt.Errorf("unknown k8s field %q, expected pod, namespace, workload or label.<name>", field)
+	}
+
+	r, err := regexp.Compile(strings.TrimSpace(valArr[1]))
+	if err != nil {
+		return err
+	}
+	filter.regexp = r
+
+	*f = append(*f, filter)
+	return nil
+}
+
+// match tells if the pods of a request match the filter, the filters never match requests without pod
+func (f *k8sFilter) match(src, dst *capture.PodInfo) bool {
+	pod := dst
+	if f.src {
+		pod = src
+	}
+	if pod == nil {
+		return false
+	}
+
+	var value string
+	switch f.field {
+	case "pod":
+		value = pod.Name
+	case "namespace":
+		value = pod.Namespace
+	case "workload":
+		value = pod.Workload
+	case "label":
+		var ok bool
+		if value, ok = pod.Labels[f.label]; !ok {
+			return false
+		}
+	}
+	return f.regexp.MatchString(value)
+}
+
+// podsAllowed tells if a request passes the --k8s-allow and --k8s-disallow filters
+func podsAllowed(msg *Message, allow, disallow K8sFilters) bool {
+	for i := range allow {
+		if !allow[i].match(msg.SrcPod, msg.DstPod) {
+			return false
+		}
+	}
+	for i := range disallow {
+		if disallow[i].match(msg.SrcPod, msg.DstPod) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package goreplay
+
+import (
+	"testing"
+
+	"github.com/buger/goreplay/internal/capture"
+	"github.com/buger/goreplay/proto"
+)
+
+func TestSetPodHeaders(t *testing.T) {
+	src := &capture.PodInfo{Name: "web-1", Namespace: "default", Workload: "Deployment/web", Labels: map[string]string{"tier": "front", "app": "web"}}
+	data := setPodHeaders([]byte("GET / HTTP/1.1\r\nHost: api\r\n\r\n"), "X-K8s", src, nil)
+
+	for name, value := range map[string]string{
+		"X-K8s-Src-Pod":      "default/web-1",
+		"X-K8s-Src-Workload": "Deployment/web",
+		"X-K8s-Src-Labels":   "app=web,tier=front",
+		"X-K8s-Dst-Pod":      "",
+	} {
+		if v := string(proto.Header(data, []byte(name))); v != value {
+			t.Errorf("%s: expected %q, got %q", name, value, v)
+		}
+	}
+}
+
+func TestK8sFilters(t *testing.T) {
+	var allow, disallow K8sFilters
+	for _, value := range []string{"src-namespace:^frontend$", "dst-label.app:api"} {
+		if err := allow.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := disallow.Set("src-workload:^DaemonSet/"); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"namespace:x", "src-ip:x", "src-pod"} {
+		if err := allow.Set(value); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+
+	api := &capture.PodInfo{Name: "api-1", Namespace: "backend", Labels: map[string]string{"app": "api"}}
+	tests := []struct {
+		name     string
+		src, dst *capture.PodInfo
+		allowed  bool
+	}{
+		{"allowed", &capture.PodInfo{Namespace: "frontend", Workload: "Deployment/web"}, api, true},
+		{"other namespace", &capture.PodInfo{Namespace: "batch"}, api, false},
+		{"disallowed workload", &capture.PodInfo{Namespace: "frontend", Workload: "DaemonSet/agent"}, api, false},
+		{"missing label", &capture.PodInfo{Namespace: "frontend"}, &capture.PodInfo{Name: "db"}, false},
+		{"no pod", nil, api, false},
+	}
+	for _, tt := range tests {
+		if allowed := podsAllowed(&Message{SrcPod: tt.src, DstPod: tt.dst}, allow, disallow); allowed != tt.allowed {
+			t.Errorf("%s: expected %v", tt.name, tt.allowed)
+		}
+	}
+}
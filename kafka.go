@@ -32,6 +32,7 @@ type InputKafkaConfig struct {
 	Topic      string `json:"input-kafka-topic"`
 	UseJSON    bool   `json:"input-kafka-json-format"`
 	Offset     string  `json:"input-kafka-offset"`
+	Checkpoint string `json:"input-kafka-checkpoint"`
 	SASLConfig SASLKafkaConfig
 }
 
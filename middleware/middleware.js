@@ -37,6 +37,9 @@ function init() {
                 case "1": chanPrefix = "request"; break;
                 case "2": chanPrefix = "response"; break;
                 case "3": chanPrefix = "replay"; break;
+                case "5": chanPrefix = "open"; break;
+                case "6": chanPrefix = "close"; break;
+                case "7": chanPrefix = "reset"; break;
             }
 
             let resp = msg;
@@ -55,6 +55,7 @@ type FileOutputConfig struct {
 	QueueLimit        int           `json:"output-file-queue-limit"`
 	Append            bool          `json:"output-file-append"`
 	BufferPath        string        `json:"output-file-buffer"`
+	Format            string        `json:"output-file-format"`
 	onClose           func(string)
 }
 
@@ -66,6 +67,7 @@ type FileOutput struct {
 	file            *os.File
 	QueueLength     int
 	writer          io.Writer
+	records         *recordWriter // writes the binary format, the text format is written when nil
 	requestPerFile  bool
 	currentID       []byte
 	payloadType     []byte
@@ -240,14 +242,20 @@ func (o *FileOutput) PluginWrite(msg *Message) (n int, err error) {
 		}
 
 		o.QueueLength = 0
+
+		if o.config.Format != FileFormatText {
+			var nn int
+			o.records, nn, err = newRecordWriter(o.writer)
+			o.totalFileSize += size.Size(nn)
+			o.currentFileSize += nn
+		}
 	}
 
-	var nn int
-	n, err = o.writer.Write(msg.Meta)
-	nn, err = o.writer.Write(msg.Data)
-	n += nn
-	nn, err = o.writer.Write(payloadSeparatorAsBytes)
-	n += nn
+	if o.records != nil {
+		n, err = o.records.write(msg)
+	} else {
+		n, err = writeTextRecord(o.writer, msg)
+	}
 
 	o.totalFileSize += size.Size(n)
 	o.currentFileSize += n
@@ -292,6 +300,12 @@ func (o *FileOutput) String() string {
 
 func (o *FileOutput) closeLocked() error {
 	if o.file != nil {
+		if o.records != nil {
+			if _, err := o.records.close(); err != nil {
+				Debug(0, "[OUTPUT-FILE] error writing the index of the recording", err)
+			}
+			o.records = nil
+		}
 		if strings.HasSuffix(o.currentName, ".gz") {
 			o.writer.(*gzip.Writer).Close()
 		} else {
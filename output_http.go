@@ -3,17 +3,23 @@ package goreplay
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"log"
 	"math"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/buger/goreplay/internal/size"
+
+	"golang.org/x/net/http2"
 )
 
 const (
@@ -47,6 +53,8 @@ type HTTPOutputConfig struct {
 	CompatibilityMode bool          `json:"output-http-compatibility-mode"`
 	RequestGroup      string        `json:"output-http-request-group"`
 	Debug             bool          `json:"output-http-debug"`
+	GRPC              bool          `json:"output-http-grpc"`
+	WebSocket         bool          `json:"output-http-websocket"`
 	rawURL            string
 	url               *url.URL
 }
@@ -69,6 +77,8 @@ func (hoc *HTTPOutputConfig) Copy() *HTTPOutputConfig {
 		CompatibilityMode: hoc.CompatibilityMode,
 		RequestGroup:      hoc.RequestGroup,
 		Debug:             hoc.Debug,
+		GRPC:              hoc.GRPC,
+		WebSocket:         hoc.WebSocket,
 	}
 }
 
@@ -86,6 +96,7 @@ type HTTPOutput struct {
 	responses      chan *response
 	stop           chan bool // Channel used only to indicate goroutine should shutdown
 	workerSessions map[string]*httpWorker
+	websocket      *websocketReplay
 }
 
 type httpWorker struct {
@@ -180,6 +191,9 @@ func NewHTTPOutput(address string, config *HTTPOutputConfig) PluginReadWriter {
 		o.elasticSearch.Init(o.config.ElasticSearch)
 	}
 	o.client = NewHTTPClient(o.config)
+	if o.config.WebSocket {
+		o.websocket = newWebSocketReplay(o)
+	}
 
 	if Settings.RecognizeTCPSessions {
 		o.workerSessions = make(map[string]*httpWorker, 100)
@@ -267,12 +281,18 @@ func (o *HTTPOutput) startWorker() {
 
 // PluginWrite writes message to this plugin
 func (o *HTTPOutput) PluginWrite(msg *Message) (n int, err error) {
+	if o.websocket != nil && o.websocket.handles(msg) {
+		return o.websocket.write(msg)
+	}
 	if !isRequestPayload(msg.Meta) {
 		return len(msg.Data), nil
 	}
 
+	// the body is streamed by the workers
+	msg.Spill.Retain()
 	select {
 	case <-o.stop:
+		msg.Spill.Release()
 		return 0, ErrorStopped
 	case o.queue <- msg:
 	}
@@ -322,13 +342,16 @@ func (o *HTTPOutput) PluginRead() (*Message, error) {
 }
 
 func (o *HTTPOutput) sendRequest(client *HTTPClient, msg *Message) {
+	// retained by PluginWrite
+	defer msg.Spill.Release()
+
 	if !isRequestPayload(msg.Meta) {
 		return
 	}
 
 	uuid := payloadID(msg.Meta)
 	start := time.Now()
-	resp, err := client.Send(msg.Data)
+	resp, err := client.send(msg.Reader())
 	stop := time.Now()
 
 	if err != nil {
@@ -363,6 +386,8 @@ func (o *HTTPOutput) Close() error {
 type HTTPClient struct {
 	config *HTTPOutputConfig
 	Client *http.Client
+	// HTTP2Client is used for gRPC requests, over h2c for http urls
+	HTTP2Client *http.Client
 }
 
 // NewHTTPClient returns new http client with check redirects policy
@@ -390,16 +415,49 @@ func NewHTTPClient(config *HTTPOutputConfig) *HTTPClient {
 		client.Client.Transport = transport
 	}
 
+	h2 := &http2.Transport{AllowHTTP: true}
+	if config.url == nil || config.url.Scheme != "https" {
+		// prior knowledge h2c, gRPC servers do not support the HTTP/1 upgrade
+		h2.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+	if config.SkipVerify {
+		h2.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client.HTTP2Client = &http.Client{
+		Timeout:       client.config.Timeout,
+		Transport:     h2,
+		CheckRedirect: client.Client.CheckRedirect,
+	}
+
 	return client
 }
 
+// isGRPC checks if the request is a gRPC call, "application/grpc" optionally followed by "+proto" or parameters.
+// gRPC-Web calls, "application/grpc-web", are HTTP/1.1 requests.
+func isGRPC(req *http.Request) bool {
+	ct := req.Header.Get("Content-Type")
+	if !strings.HasPrefix(ct, "application/grpc") {
+		return false
+	}
+	rest := ct[len("application/grpc"):]
+	return rest == "" || rest[0] == '+' || rest[0] == ';'
+}
+
 // Send sends an http request using client created by NewHTTPClient
 func (c *HTTPClient) Send(data []byte) ([]byte, error) {
+	return c.send(bytes.NewReader(data))
+}
+
+// send replays the request read from r, the body is streamed from r
+func (c *HTTPClient) send(r io.Reader) ([]byte, error) {
 	var req *http.Request
 	var resp *http.Response
 	var err error
 
-	req, err = http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	req, err = http.ReadRequest(bufio.NewReader(r))
 	if err != nil {
 		return nil, err
 	}
@@ -425,6 +483,10 @@ func (c *HTTPClient) Send(data []byte) ([]byte, error) {
 	// it's an error if this is not equal to empty string
 	req.RequestURI = ""
 
+	if c.config.GRPC || isGRPC(req) {
+		return c.sendGRPC(req)
+	}
+
 	resp, err = c.Client.Do(req)
 	if err != nil {
 		return nil, err
@@ -435,3 +497,31 @@ func (c *HTTPClient) Send(data []byte) ([]byte, error) {
 	_ = resp.Body.Close()
 	return nil, nil
 }
+
+// sendGRPC replays the request over HTTP/2, the trailers (grpc-status, grpc-message)
+// of the response are kept by dumping it with chunked encoding.
+func (c *HTTPClient) sendGRPC(req *http.Request) ([]byte, error) {
+	resp, err := c.HTTP2Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// trailers are only known once the body is read
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !c.config.TrackResponses {
+		return nil, nil
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if len(resp.Trailer) > 0 {
+		resp.ContentLength = -1
+		resp.TransferEncoding = []string{"chunked"}
+	} else {
+		resp.ContentLength = int64(len(body))
+	}
+	return httputil.DumpResponse(resp, true)
+}
@@ -1,12 +1,18 @@
 package goreplay
 
 import (
+	"bytes"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	_ "net/http/httputil"
+	"net/url"
 	"sync"
 	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func TestHTTPOutput(t *testing.T) {
@@ -179,6 +185,61 @@ func TestHTTPOutputSessions(t *testing.T) {
 	Settings.SplitOutput = false
 }
 
+func TestHTTPClientGRPC(t *testing.T) {
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if req.ProtoMajor != 2 || req.URL.Path != "/pkg.Service/Method" || !bytes.Equal(body, []byte{0, 0, 0, 0, 2, 8, 1}) {
+			t.Errorf("wrong gRPC request %s %s %q", req.Proto, req.URL.Path, body)
+		}
+		if req.Trailer.Get("Grpc-Timeout") != "1S" {
+			t.Errorf("expected request trailers to be replayed, got %v", req.Trailer)
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte{0, 0, 0, 0, 2, 8, 2})
+		w.Header().Set("Grpc-Status", "0")
+	}), &http2.Server{}))
+	defer server.Close()
+
+	config := &HTTPOutputConfig{TrackResponses: true, Timeout: time.Second}
+	config.url, _ = url.Parse(server.URL)
+	client := NewHTTPClient(config)
+
+	// request as captured by --input-raw-protocol http2
+	payload := []byte("POST /pkg.Service/Method HTTP/2.0\r\nHost: example.com\r\nContent-Type: application/grpc\r\nTe: trailers\r\n" +
+		"Transfer-Encoding: chunked\r\nTrailer: grpc-timeout\r\n\r\n7\r\n\x00\x00\x00\x00\x02\x08\x01\r\n0\r\ngrpc-timeout: 1S\r\n\r\n")
+	resp, err := client.Send(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(resp, []byte("HTTP/2.0 200 OK\r\n")) {
+		t.Errorf("wrong response %q", resp)
+	}
+	if !bytes.HasSuffix(resp, []byte("\x00\x00\x00\x00\x02\x08\x02\r\n0\r\nGrpc-Status: 0\r\n\r\n")) {
+		t.Errorf("expected response trailers to be kept %q", resp)
+	}
+}
+
+func TestIsGRPC(t *testing.T) {
+	tests := map[string]bool{
+		"application/grpc":                true,
+		"application/grpc+proto":          true,
+		"application/grpc; charset=utf-8": true,
+		"application/grpc-web":            false,
+		"application/grpc-web-text+proto": false,
+		"application/json":                false,
+		"":                                false,
+	}
+	for ct, expected := range tests {
+		req := &http.Request{Header: http.Header{"Content-Type": {ct}}}
+		if isGRPC(req) != expected {
+			t.Errorf("%q: expected %v", ct, expected)
+		}
+	}
+}
+
 func BenchmarkHTTPOutput(b *testing.B) {
 	wg := new(sync.WaitGroup)
 
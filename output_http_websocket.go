@@ -0,0 +1,245 @@
+package goreplay
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"time"
+
+	"github.com/buger/goreplay/internal/websocket"
+	"github.com/buger/goreplay/proto"
+)
+
+// websocketReplay replays the WebSocket sessions captured by --input-raw, see --output-http-websocket.
+// Every session is replayed over its own connection: the handshake is sent first, then the frames the client sent,
+// with the same delays from the handshake as in the captured session. The frames of the server are discarded.
+type websocketReplay struct {
+	output   *HTTPOutput
+	queue    chan *Message
+	sessions map[string]*websocketSession
+}
+
+type websocketSession struct {
+	replay       *websocketReplay
+	conn         net.Conn
+	queue        chan *Message
+	start        time.Time // when the handshake was replayed
+	origin       int64     // timestamp of the captured handshake
+	lastActivity time.Time
+}
+
+func newWebSocketReplay(output *HTTPOutput) *websocketReplay {
+	r := &websocketReplay{
+		output:   output,
+		queue:    make(chan *Message, output.config.QueueLen),
+		sessions: make(map[string]*websocketSession),
+	}
+	go r.sessionMaster()
+	return r
+}
+
+// isWebSocketHandshake checks if the request opens a WebSocket session
+func isWebSocketHandshake(data []byte) bool {
+	return bytes.EqualFold(proto.Header(data, []byte("Upgrade")), []byte("websocket"))
+}
+
+// handles tells if the message belongs to a WebSocket session
+func (r *websocketReplay) handles(msg *Message) bool {
+	return isFramePayload(msg.Meta) || isRequestPayload(msg.Meta) && isWebSocketHandshake(msg.Data)
+}
+
+// write queues the handshakes and the frames of the clients
+func (r *websocketReplay) write(msg *Message) (n int, err error) {
+	if isFramePayload(msg.Meta) && !isClientFrame(msg.Meta) {
+		return len(msg.Data), nil
+	}
+
+	select {
+	case <-r.output.stop:
+		return 0, ErrorStopped
+	case r.queue <- msg:
+	}
+	return len(msg.Data) + len(msg.Meta), nil
+}
+
+// sessionMaster dispatches the frames to a worker per session
+func (r *websocketReplay) sessionMaster() {
+	gc := time.NewTicker(time.Second)
+	defer gc.Stop()
+
+	for {
+		select {
+		case <-r.output.stop:
+			for _, s := range r.sessions {
+				close(s.queue)
+			}
+			return
+		case msg := <-r.queue:
+			id := string(payloadID(msg.Meta))
+			s, ok := r.sessions[id]
+			if !ok {
+				if !isRequestPayload(msg.Meta) {
+					Debug(2, "[HTTP-OUTPUT] WebSocket frame without handshake:", id)
+					continue
+				}
+				s = r.newSession()
+				r.sessions[id] = s
+			}
+
+			s.queue <- msg
+			s.lastActivity = time.Now()
+		case now := <-gc.C:
+			for id, s := range r.sessions {
+				if now.Sub(s.lastActivity) >= 120*time.Second {
+					close(s.queue)
+					delete(r.sessions, id)
+				}
+			}
+		}
+	}
+}
+
+func (r *websocketReplay) newSession() *websocketSession {
+	s := &websocketSession{replay: r, queue: make(chan *Message, 1000)}
+
+	go func() {
+		for msg := range s.queue {
+			if isRequestPayload(msg.Meta) {
+				if err := s.handshake(msg); err != nil {
+					Debug(1, fmt.Sprintf("[HTTP-OUTPUT] WebSocket handshake error: %q", err))
+				}
+				continue
+			}
+			if s.conn != nil {
+				s.send(msg)
+			}
+		}
+		if s.conn != nil {
+			s.conn.Close()
+		}
+	}()
+
+	return s
+}
+
+func (s *websocketSession) dial() (net.Conn, error) {
+	config := s.replay.output.config
+	host := config.url.Host
+	if config.url.Port() == "" {
+		if config.url.Scheme == "https" {
+			host = net.JoinHostPort(host, "443")
+		} else {
+			host = net.JoinHostPort(host, "80")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	if config.url.Scheme == "https" {
+		return tls.DialWithDialer(dialer, "tcp", host, &tls.Config{
+			ServerName:         config.url.Hostname(),
+			InsecureSkipVerify: config.SkipVerify,
+		})
+	}
+	return dialer.Dial("tcp", host)
+}
+
+// handshake replays the handshake of the session, the session starts once the server switched the protocol
+func (s *websocketSession) handshake(msg *Message) error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	config := s.replay.output.config
+
+	data := msg.Data
+	if !config.OriginalHost {
+		data = proto.SetHeader(data, []byte("Host"), []byte(config.url.Host))
+	}
+
+	conn, err := s.dial()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	conn.SetDeadline(start.Add(config.Timeout))
+	if _, err = conn.Write(data); err != nil {
+		conn.Close()
+		return err
+	}
+	// the first frames of the server may be read along with the response, the same reader reads the frames
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	stop := time.Now()
+	conn.SetDeadline(time.Time{})
+
+	if config.TrackResponses {
+		if dump, err := httputil.DumpResponse(resp, false); err == nil {
+			s.replay.output.responses <- &response{dump, payloadID(msg.Meta), start.UnixNano(), stop.UnixNano() - start.UnixNano()}
+		}
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return fmt.Errorf("the server refused the session: %s", resp.Status)
+	}
+
+	// the frames of the server are not replayed, they are read until the connection is closed
+	go func() {
+		var frame []byte
+		for err == nil {
+			frame, err = websocket.ReadFrame(r, frame[:0])
+		}
+	}()
+
+	s.conn = conn
+	s.start = stop
+	s.origin = payloadTimestamp(msg.Meta)
+	return nil
+}
+
+// send replays a frame of the client, with the delay it had after the captured handshake
+func (s *websocketSession) send(msg *Message) {
+	// frames from files or the middleware can be cut or corrupted
+	if websocket.Len(msg.Data) <= 0 {
+		Debug(1, "[HTTP-OUTPUT] skipping an invalid WebSocket frame")
+		return
+	}
+	if ts := payloadTimestamp(msg.Meta); ts > s.origin {
+		time.Sleep(time.Until(s.start.Add(time.Duration(ts - s.origin))))
+	}
+
+	var key [4]byte
+	rand.Read(key[:])
+	s.conn.SetWriteDeadline(time.Now().Add(s.replay.output.config.Timeout))
+	if _, err := s.conn.Write(websocket.Mask(msg.Data, key)); err != nil {
+		Debug(1, fmt.Sprintf("[HTTP-OUTPUT] WebSocket error when sending: %q", err))
+		s.conn.Close()
+		s.conn = nil
+		return
+	}
+
+	if websocket.Opcode(msg.Data) == websocket.OpClose {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// payloadTimestamp returns the capture time of a payload, 0 if its meta is malformed
+func payloadTimestamp(meta []byte) int64 {
+	fields := payloadMeta(meta)
+	if len(fields) < 3 {
+		return 0
+	}
+	ts, _ := strconv.ParseInt(string(fields[2]), 10, 64)
+	return ts
+}
@@ -0,0 +1,90 @@
+package goreplay
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/buger/goreplay/internal/websocket"
+)
+
+func TestHTTPOutputWebSocket(t *testing.T) {
+	frames := make(chan []byte, 10)
+	handshakes := make(chan *http.Request, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handshakes <- req
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Write([]byte{0x81, 2, 'h', 'i'})
+		rw.Flush()
+
+		r := bufio.NewReader(rw)
+		for {
+			frame, err := websocket.ReadFrame(r, nil)
+			if err != nil {
+				close(frames)
+				return
+			}
+			if !websocket.IsMasked(frame) {
+				t.Error("client frames should be masked")
+			}
+			frames <- websocket.Unmask(frame)
+		}
+	}))
+	defer server.Close()
+
+	output := NewHTTPOutput(server.URL, &HTTPOutputConfig{WebSocket: true, TrackResponses: true, Timeout: time.Second})
+	defer output.(*HTTPOutput).Close()
+
+	uuid := randByte(20)
+	ts := time.Now().UnixNano()
+	handshake := "GET /chat HTTP/1.1\r\nHost: www.example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+
+	output.PluginWrite(&Message{Meta: payloadHeader(RequestPayload, uuid, ts, -1), Data: []byte(handshake)})
+	output.PluginWrite(&Message{Meta: framePayloadHeader(uuid, ts+int64(50*time.Millisecond), -1, false, websocket.OpText), Data: []byte{0x81, 2, 'h', 'i'}})
+	output.PluginWrite(&Message{Meta: framePayloadHeader(uuid, ts+int64(100*time.Millisecond), -1, true, websocket.OpText), Data: []byte{0x81, 3, 'o', 'n', 'e'}})
+	output.PluginWrite(&Message{Meta: framePayloadHeader(uuid, ts+int64(100*time.Millisecond), -1, true, websocket.OpBinary), Data: []byte{0x82, 3, 't', 'w', 'o'}})
+	output.PluginWrite(&Message{Meta: framePayloadHeader(uuid, ts+int64(200*time.Millisecond), -1, true, websocket.OpClose), Data: []byte{0x88, 0}})
+	// frames without a handshake are dropped
+	output.PluginWrite(&Message{Meta: framePayloadHeader(randByte(20), ts, -1, true, websocket.OpText), Data: []byte{0x81, 1, 'x'}})
+
+	select {
+	case req := <-handshakes:
+		if req.Host != server.Listener.Addr().String() {
+			t.Errorf("expected the host of the output, got %q", req.Host)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the handshake was not replayed")
+	}
+
+	resp, err := output.PluginRead()
+	if err != nil || resp.Meta[0] != ReplayedResponsePayload || string(payloadID(resp.Meta)) != string(uuid) {
+		t.Errorf("expected the response to the handshake, got %v %v", resp, err)
+	}
+
+	start := time.Now()
+	var got []string
+	for frame := range frames {
+		got = append(got, string(frame))
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("the frames should keep their timing, replayed in %s", elapsed)
+	}
+	expected := []string{"\x81\x03one", "\x82\x03two", "\x88\x00"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], got[i])
+		}
+	}
+}
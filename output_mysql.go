@@ -0,0 +1,219 @@
+package goreplay
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/buger/goreplay/internal/mysql"
+)
+
+// MySQLOutputConfig struct for holding mysql output configuration
+type MySQLOutputConfig struct {
+	User           string        `json:"output-mysql-user"`
+	Password       string        `json:"output-mysql-password"`
+	Database       string        `json:"output-mysql-database"`
+	Timeout        time.Duration `json:"output-mysql-timeout"`
+	TrackResponses bool          `json:"output-mysql-track-response"`
+}
+
+// MySQLOutput replays commands captured with `--input-raw-protocol mysql`.
+// Every captured session is replayed over its own connection, so that transactions, session variables
+// and prepared statements behave like in the original session.
+type MySQLOutput struct {
+	address    string
+	config     *MySQLOutputConfig
+	responses  chan *response
+	dispatcher *sessionDispatcher
+}
+
+type mysqlSession struct {
+	output *MySQLOutput
+	conn   *mysql.Conn
+
+	// captured statement ids mapped to the replayed ones, learned from the original responses
+	statements map[uint32]uint32
+	prepared   map[string]uint32 // request id to replayed statement id, until its original response is seen
+}
+
+// NewMySQLOutput constructor for MySQLOutput
+func NewMySQLOutput(address string, config *MySQLOutputConfig) PluginReadWriter {
+	o := new(MySQLOutput)
+	o.address = address
+	o.config = config
+	if o.config.Timeout <= 0 {
+		o.config.Timeout = 5 * time.Second
+	}
+
+	if o.config.TrackResponses {
+		o.responses = make(chan *response, 1000)
+	}
+	o.dispatcher = newSessionDispatcher(o.newSession)
+
+	return o
+}
+
+func (o *MySQLOutput) newSession() replaySession {
+	return &mysqlSession{
+		output:     o,
+		statements: make(map[uint32]uint32),
+		prepared:   make(map[string]uint32),
+	}
+}
+
+func (s *mysqlSession) handle(msg *Message) {
+	if isRequestPayload(msg.Meta) {
+		s.send(msg)
+	} else {
+		s.learnStatement(msg)
+	}
+}
+
+func (s *mysqlSession) close() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func (s *mysqlSession) connect() error {
+	conn, err := net.DialTimeout("tcp", s.output.address, s.output.config.Timeout)
+	if err != nil {
+		return err
+	}
+	s.conn = mysql.NewConn(conn)
+	s.conn.SetDeadline(time.Now().Add(s.output.config.Timeout))
+	if err = s.conn.Handshake(s.output.config.User, s.output.config.Password, s.output.config.Database); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	// replayed statement ids are only valid on their connection
+	s.statements = make(map[uint32]uint32)
+	return nil
+}
+
+func (s *mysqlSession) send(msg *Message) {
+	if len(msg.Data) < 5 {
+		return
+	}
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			Debug(1, fmt.Sprintf("[MYSQL-OUTPUT] connection error: %q", err))
+			return
+		}
+	}
+
+	data := msg.Data
+	command := data[4]
+	if mysql.HasStatementID(command) && len(data) >= 9 {
+		if id, ok := s.statements[binary.LittleEndian.Uint32(data[5:9])]; ok {
+			data = append([]byte(nil), data...)
+			binary.LittleEndian.PutUint32(data[5:9], id)
+		}
+	}
+
+	start := time.Now()
+	s.conn.SetDeadline(start.Add(s.output.config.Timeout))
+	resp, err := s.roundTrip(data, command)
+	stop := time.Now()
+	if err != nil {
+		Debug(1, fmt.Sprintf("[MYSQL-OUTPUT] error when sending: %q", err))
+		s.conn.Close()
+		s.conn = nil
+		return
+	}
+
+	if command == mysql.ComQuit {
+		s.conn.Close()
+		s.conn = nil
+		return
+	}
+
+	uuid := payloadID(msg.Meta)
+	if command == mysql.ComStmtPrepare {
+		if payload, _, _, ok := mysql.Packet(resp); ok && len(payload) >= 5 && payload[0] == 0x00 {
+			s.prepared[string(uuid)] = binary.LittleEndian.Uint32(payload[1:5])
+		}
+	}
+
+	if s.output.config.TrackResponses && mysql.HasResponse(command) {
+		s.output.responses <- &response{resp, uuid, start.UnixNano(), stop.UnixNano() - start.UnixNano()}
+	}
+}
+
+// roundTrip writes the command packets as they were captured, and reads the whole response
+func (s *mysqlSession) roundTrip(data []byte, command byte) ([]byte, error) {
+	if _, err := s.conn.Write(data); err != nil {
+		return nil, err
+	}
+	if !mysql.HasResponse(command) {
+		return nil, nil
+	}
+
+	var resp []byte
+	tracker := mysql.NewResponse(command, s.conn.Capabilities&mysql.ClientDeprecateEOF != 0)
+	for {
+		payload, seq, err := s.conn.ReadPacket()
+		if err != nil {
+			return nil, err
+		}
+		resp = mysql.AppendPacket(resp, seq, payload)
+		if tracker.Add(payload) {
+			return resp, nil
+		}
+	}
+}
+
+// learnStatement maps the statement id of an original COM_STMT_PREPARE response to the replayed one
+func (s *mysqlSession) learnStatement(msg *Message) {
+	uuid := string(payloadID(msg.Meta))
+	id, ok := s.prepared[uuid]
+	if !ok {
+		return
+	}
+	delete(s.prepared, uuid)
+
+	if payload, _, _, ok := mysql.Packet(msg.Data); ok && len(payload) >= 5 && payload[0] == 0x00 {
+		s.statements[binary.LittleEndian.Uint32(payload[1:5])] = id
+	}
+}
+
+// PluginWrite writes message to this plugin
+func (o *MySQLOutput) PluginWrite(msg *Message) (n int, err error) {
+	// original responses are needed to replay prepared statements
+	if !isOriginPayload(msg.Meta) {
+		return len(msg.Data), nil
+	}
+
+	return o.dispatcher.dispatch(msg)
+}
+
+// PluginRead reads message from this plugin
+func (o *MySQLOutput) PluginRead() (*Message, error) {
+	if !o.config.TrackResponses {
+		return nil, ErrorStopped
+	}
+	var resp *response
+	var msg Message
+	select {
+	case <-o.dispatcher.stop:
+		return nil, ErrorStopped
+	case resp = <-o.responses:
+		msg.Data = resp.payload
+	}
+
+	msg.Meta = payloadHeader(ReplayedResponsePayload, resp.uuid, resp.startedAt, resp.roundTripTime)
+
+	return &msg, nil
+}
+
+func (o *MySQLOutput) String() string {
+	return "MySQL output: " + o.address
+}
+
+// Close closes the data channel so that data
+func (o *MySQLOutput) Close() error {
+	o.dispatcher.close()
+	return nil
+}
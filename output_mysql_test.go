@@ -0,0 +1,88 @@
+package goreplay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/buger/goreplay/internal/mysql"
+)
+
+func TestMySQLOutput(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	executed := make(chan uint32, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn := mysql.NewConn(c)
+		defer conn.Close()
+
+		conn.WritePacket(0, []byte("\x0a8.0.36\x00\x01\x00\x00\x00abcdefgh\x00\xff\xff\x2d\x02\x00\xff\xdf\x15\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00ijklmnopqrst\x00mysql_native_password\x00"))
+		login, _, _ := conn.ReadPacket()
+		if !bytes.Contains(login, []byte("replay\x00")) {
+			t.Errorf("wrong login %q", login)
+		}
+		conn.WritePacket(2, []byte{0, 0, 0, 2, 0, 0, 0})
+
+		for {
+			payload, _, err := conn.ReadPacket()
+			if err != nil {
+				return
+			}
+			switch payload[0] {
+			case mysql.ComStmtPrepare:
+				conn.WritePacket(1, []byte{0, 7, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+			case mysql.ComStmtExecute:
+				executed <- binary.LittleEndian.Uint32(payload[1:5])
+				conn.WritePacket(1, []byte{0, 0, 0, 2, 0, 0, 0})
+			}
+		}
+	}()
+
+	output := NewMySQLOutput(ln.Addr().String(), &MySQLOutputConfig{User: "replay", TrackResponses: true})
+	defer output.(*MySQLOutput).Close()
+
+	// same session, different commands
+	prepareID, executeID := []byte("0102030405060708aaaaaaaa"), []byte("0102030405060708bbbbbbbb")
+	output.PluginWrite(&Message{
+		Meta: payloadHeader(RequestPayload, prepareID, 1, -1),
+		Data: mysql.AppendPacket(nil, 0, []byte("\x16select 1")),
+	})
+	// original response, the statement had another id in the captured session
+	output.PluginWrite(&Message{
+		Meta: payloadHeader(ResponsePayload, prepareID, 2, 1),
+		Data: mysql.AppendPacket(nil, 1, []byte{0, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}),
+	})
+	output.PluginWrite(&Message{
+		Meta: payloadHeader(RequestPayload, executeID, 3, -1),
+		Data: mysql.AppendPacket(nil, 0, []byte{mysql.ComStmtExecute, 3, 0, 0, 0, 0, 1, 0, 0, 0}),
+	})
+
+	select {
+	case id := <-executed:
+		if id != 7 {
+			t.Errorf("expected the replayed statement id, got %d", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("statement was not executed")
+	}
+
+	for _, id := range [][]byte{prepareID, executeID} {
+		msg, err := output.PluginRead()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(payloadID(msg.Meta), id) || msg.Meta[0] != ReplayedResponsePayload {
+			t.Errorf("wrong replayed response %q", msg.Meta)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package goreplay
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buger/goreplay/internal/capture"
+	"github.com/buger/goreplay/internal/size"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// pcapSnaplen is the snapshot length written in the file headers, it is the maximum of tcpdump
+const pcapSnaplen = 262144
+
+// PcapOutputConfig ...
+type PcapOutputConfig struct {
+	SizeLimit      size.Size     `json:"output-pcap-size-limit"`
+	RotateInterval time.Duration `json:"output-pcap-rotate-interval"`
+	FlushInterval  time.Duration `json:"output-pcap-flush-interval"`
+}
+
+// PcapOutput writes the raw packets captured by `--input-raw` into pcap files, which can be opened with Wireshark.
+// Unlike other outputs it does not receive messages, the listeners pass it every packet they read.
+type PcapOutput struct {
+	sync.Mutex
+	pathTemplate string
+	config       *PcapOutputConfig
+	files        map[layers.LinkType]*pcapFile
+	closed       bool
+}
+
+// pcapFile is the current file of a link type, a pcap file can hold a single link type
+type pcapFile struct {
+	path   string // path of the file, without the index
+	index  int
+	file   *os.File
+	writer io.Writer
+	pcap   *capture.Writer
+	size   int
+	opened time.Time
+}
+
+// NewPcapOutput constructor for PcapOutput, accepts path.
+// The date placeholders of the path are evaluated when a file is opened and every second, %NS is not supported.
+func NewPcapOutput(pathTemplate string, config *PcapOutputConfig) *PcapOutput {
+	if strings.Contains(pathTemplate, "%NS") {
+		log.Fatal("[OUTPUT-PCAP] %NS is not supported by --output-pcap, the file name changes at most every second")
+	}
+
+	o := new(PcapOutput)
+	o.pathTemplate = pathTemplate
+	o.config = config
+	o.files = make(map[layers.LinkType]*pcapFile)
+
+	if config.FlushInterval == 0 {
+		config.FlushInterval = time.Second
+	}
+
+	go func() {
+		flush := time.NewTicker(config.FlushInterval)
+		defer flush.Stop()
+		names := time.NewTicker(time.Second)
+		defer names.Stop()
+
+		for {
+			select {
+			case <-flush.C:
+				if o.IsClosed() {
+					return
+				}
+				o.flush()
+			case <-names.C:
+				o.checkNames()
+			}
+		}
+	}()
+
+	return o
+}
+
+// filename returns the path of the files of the link type, without the index
+func (o *PcapOutput) filename(linkType layers.LinkType) string {
+	path := o.pathTemplate
+
+	if strings.Contains(path, "%") {
+		for name, fn := range dateFileNameFuncs {
+			path = strings.Replace(path, name, fn(&FileOutput{}), -1)
+		}
+	}
+
+	if linkType != layers.LinkTypeEthernet {
+		gz := strings.HasSuffix(path, ".gz")
+		path = strings.TrimSuffix(path, ".gz")
+		ext := filepath.Ext(path)
+		path = strings.TrimSuffix(path, ext) + "-" + strings.ToLower(strings.ReplaceAll(linkType.String(), " ", "")) + ext
+		if gz {
+			path += ".gz"
+		}
+	}
+
+	return filepath.Clean(path)
+}
+
+// indexedName inserts the index of the file before the extension, like FileOutput does
+func indexedName(path string, index int) string {
+	if strings.HasSuffix(path, ".gz") {
+		return setFileIndex(strings.TrimSuffix(path, ".gz"), index) + ".gz"
+	}
+	return setFileIndex(path, index)
+}
+
+// nextIndex returns the index following the files already written with this path
+func nextIndex(path string) int {
+	gz := ""
+	if strings.HasSuffix(path, ".gz") {
+		gz = ".gz"
+		path = strings.TrimSuffix(path, gz)
+	}
+	ext := filepath.Ext(path)
+
+	matches, err := filepath.Glob(strings.TrimSuffix(path, ext) + "_*" + ext + gz)
+	if err != nil || len(matches) == 0 {
+		return 0
+	}
+	for i := range matches {
+		matches[i] = strings.TrimSuffix(matches[i], gz)
+	}
+	sort.Sort(sortByFileIndex(matches))
+
+	return getFileIndex(matches[len(matches)-1]) + 1
+}
+
+// WritePacket writes a packet into the file of its link type
+func (o *PcapOutput) WritePacket(linkType layers.LinkType, ci gopacket.CaptureInfo, data []byte) error {
+	o.Lock()
+	defer o.Unlock()
+
+	if o.closed {
+		return ErrorStopped
+	}
+
+	f := o.files[linkType]
+	if f == nil || o.rotate(f) {
+		path := o.filename(linkType)
+		var index int
+		if f != nil && f.path == path {
+			index = f.index + 1
+		} else {
+			index = nextIndex(path)
+		}
+		if f != nil {
+			f.close()
+		}
+
+		var err error
+		if f, err = openPcapFile(path, index, linkType); err != nil {
+			delete(o.files, linkType)
+			Debug(0, "[OUTPUT-PCAP] error opening file", err)
+			return err
+		}
+		o.files[linkType] = f
+	}
+
+	if ci.CaptureLength > len(data) || ci.CaptureLength == 0 {
+		ci.CaptureLength = len(data)
+	}
+	if ci.Length < ci.CaptureLength {
+		ci.Length = ci.CaptureLength
+	}
+	if err := f.pcap.WritePacket(ci, data[:ci.CaptureLength]); err != nil {
+		return err
+	}
+	f.size += 16 + ci.CaptureLength
+
+	return nil
+}
+
+// rotate checks if the file reached its size or time limit
+func (o *PcapOutput) rotate(f *pcapFile) bool {
+	return (o.config.SizeLimit > 0 && f.size >= int(o.config.SizeLimit)) ||
+		(o.config.RotateInterval > 0 && time.Since(f.opened) >= o.config.RotateInterval)
+}
+
+// checkNames closes the files whose name changed with the date, the next packets open a new one
+func (o *PcapOutput) checkNames() {
+	if !strings.Contains(o.pathTemplate, "%") {
+		return
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	for linkType, f := range o.files {
+		if o.filename(linkType) != f.path {
+			f.close()
+			delete(o.files, linkType)
+		}
+	}
+}
+
+func openPcapFile(path string, index int, linkType layers.LinkType) (f *pcapFile, err error) {
+	f = &pcapFile{path: path, index: index, opened: time.Now()}
+
+	name := indexedName(path, index)
+	if f.file, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660); err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(name, ".gz") {
+		f.writer = gzip.NewWriter(f.file)
+	} else {
+		f.writer = bufio.NewWriter(f.file)
+	}
+
+	f.pcap = capture.NewWriterNanos(f.writer)
+	if err = f.pcap.WriteFileHeader(pcapSnaplen, linkType); err != nil {
+		f.close()
+		return nil, err
+	}
+	f.size = 24
+
+	return f, nil
+}
+
+func (f *pcapFile) flush() {
+	switch w := f.writer.(type) {
+	case *gzip.Writer:
+		w.Flush()
+	case *bufio.Writer:
+		w.Flush()
+	}
+}
+
+func (f *pcapFile) close() {
+	if w, ok := f.writer.(*gzip.Writer); ok {
+		w.Close()
+	} else {
+		f.flush()
+	}
+	f.file.Close()
+}
+
+func (o *PcapOutput) flush() {
+	o.Lock()
+	defer o.Unlock()
+
+	for _, f := range o.files {
+		f.flush()
+	}
+}
+
+func (o *PcapOutput) String() string {
+	return "Pcap output: " + o.pathTemplate
+}
+
+// Close closes the files being written to
+func (o *PcapOutput) Close() error {
+	o.Lock()
+	defer o.Unlock()
+
+	for linkType, f := range o.files {
+		f.close()
+		delete(o.files, linkType)
+	}
+	o.closed = true
+
+	return nil
+}
+
+// IsClosed returns if the output is closed or not
+func (o *PcapOutput) IsClosed() bool {
+	o.Lock()
+	defer o.Unlock()
+	return o.closed
+}
@@ -0,0 +1,134 @@
+package goreplay
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+func readPcapFile(t *testing.T, name string) (layers.LinkType, [][]byte) {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var r *pcapgo.Reader
+	if filepath.Ext(name) == ".gz" {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err = pcapgo.NewReader(gz)
+	} else {
+		r, err = pcapgo.NewReader(f)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var packets [][]byte
+	for {
+		data, _, err := r.ReadPacketData()
+		if err != nil {
+			break
+		}
+		packets = append(packets, data)
+	}
+	return r.LinkType(), packets
+}
+
+func TestPcapOutputRotation(t *testing.T) {
+	dir := t.TempDir()
+	output := NewPcapOutput(filepath.Join(dir, "capture-%Y.pcap"), &PcapOutputConfig{SizeLimit: 100})
+
+	packet := make([]byte, 60)
+	ci := gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(packet), Length: len(packet)}
+	for i := 0; i < 3; i++ {
+		packet[0] = byte(i)
+		if err := output.WritePacket(layers.LinkTypeEthernet, ci, packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	output.WritePacket(layers.LinkTypeLinuxSLL, ci, packet)
+	output.Close()
+
+	year := time.Now().Format("2006")
+	for i := 0; i < 3; i++ {
+		linkType, packets := readPcapFile(t, filepath.Join(dir, "capture-"+year+"_"+strconv.Itoa(i)+".pcap"))
+		if linkType != layers.LinkTypeEthernet || len(packets) != 1 || packets[0][0] != byte(i) {
+			t.Errorf("wrong file %d: %v %v", i, linkType, packets)
+		}
+	}
+
+	linkType, packets := readPcapFile(t, filepath.Join(dir, "capture-"+year+"-linuxsll_0.pcap"))
+	if linkType != layers.LinkTypeLinuxSLL || len(packets) != 1 {
+		t.Errorf("wrong link type file: %v %v", linkType, packets)
+	}
+
+	// a new output continues after the existing files
+	output = NewPcapOutput(filepath.Join(dir, "capture-%Y.pcap"), &PcapOutputConfig{})
+	output.WritePacket(layers.LinkTypeEthernet, ci, packet)
+	output.Close()
+	if _, err := os.Stat(filepath.Join(dir, "capture-"+year+"_3.pcap")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPcapOutputGzip(t *testing.T) {
+	dir := t.TempDir()
+	output := NewPcapOutput(filepath.Join(dir, "capture.pcap.gz"), &PcapOutputConfig{})
+
+	packet := []byte("packet")
+	output.WritePacket(layers.LinkTypeEthernet, gopacket.CaptureInfo{CaptureLength: len(packet), Length: len(packet)}, packet)
+	output.Close()
+
+	if err := output.WritePacket(layers.LinkTypeEthernet, gopacket.CaptureInfo{}, packet); err != ErrorStopped {
+		t.Errorf("expected the output to be stopped, got %v", err)
+	}
+
+	_, packets := readPcapFile(t, filepath.Join(dir, "capture_0.pcap.gz"))
+	if len(packets) != 1 || string(packets[0]) != "packet" {
+		t.Errorf("wrong packets %q", packets)
+	}
+}
+
+func TestPcapOutputNameChange(t *testing.T) {
+	dir := t.TempDir()
+	output := NewPcapOutput(filepath.Join(dir, "capture-%Y.pcap"), &PcapOutputConfig{})
+	defer output.Close()
+
+	packet := []byte("packet")
+	ci := gopacket.CaptureInfo{CaptureLength: len(packet), Length: len(packet)}
+	output.WritePacket(layers.LinkTypeEthernet, ci, packet)
+
+	// the file is kept while its name does not change
+	file := func() *pcapFile {
+		output.Lock()
+		defer output.Unlock()
+		return output.files[layers.LinkTypeEthernet]
+	}
+	f := file()
+	output.checkNames()
+	output.WritePacket(layers.LinkTypeEthernet, ci, packet)
+	if file() != f {
+		t.Error("expected the packets to be written to the same file")
+	}
+
+	// as if the file was opened the previous year
+	output.Lock()
+	f.path = filepath.Join(dir, "capture-1999.pcap")
+	output.Unlock()
+	output.checkNames()
+	output.WritePacket(layers.LinkTypeEthernet, ci, packet)
+	if f = file(); f == nil || f.path != filepath.Join(dir, "capture-"+time.Now().Format("2006")+".pcap") || f.index != 1 {
+		t.Errorf("expected a new file once the name changed, got %+v", f)
+	}
+}
@@ -0,0 +1,181 @@
+package goreplay
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/buger/goreplay/internal/redis"
+)
+
+// RedisOutputConfig struct for holding redis output configuration
+type RedisOutputConfig struct {
+	Password       string        `json:"output-redis-password"`
+	DB             int           `json:"output-redis-db"`
+	Timeout        time.Duration `json:"output-redis-timeout"`
+	TrackResponses bool          `json:"output-redis-track-response"`
+}
+
+// RedisOutput replays commands captured with `--input-raw-protocol redis`.
+// Every captured session is replayed over its own connection, so that SELECT, MULTI/EXEC
+// and other connection state behave like in the original session.
+type RedisOutput struct {
+	address    string
+	config     *RedisOutputConfig
+	responses  chan *response
+	dispatcher *sessionDispatcher
+}
+
+type redisSession struct {
+	output *RedisOutput
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisOutput constructor for RedisOutput
+func NewRedisOutput(address string, config *RedisOutputConfig) PluginReadWriter {
+	o := new(RedisOutput)
+	o.address = address
+	o.config = config
+	if o.config.Timeout <= 0 {
+		o.config.Timeout = 5 * time.Second
+	}
+
+	if o.config.TrackResponses {
+		o.responses = make(chan *response, 1000)
+	}
+	o.dispatcher = newSessionDispatcher(o.newSession)
+
+	return o
+}
+
+func (o *RedisOutput) newSession() replaySession {
+	return &redisSession{output: o}
+}
+
+func (s *redisSession) handle(msg *Message) {
+	s.send(msg)
+}
+
+func (s *redisSession) close() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func (s *redisSession) connect() (err error) {
+	s.conn, err = net.DialTimeout("tcp", s.output.address, s.output.config.Timeout)
+	if err != nil {
+		return err
+	}
+	s.reader = bufio.NewReader(s.conn)
+	s.conn.SetDeadline(time.Now().Add(s.output.config.Timeout))
+
+	if s.output.config.Password != "" {
+		err = s.command("AUTH", s.output.config.Password)
+	}
+	if err == nil && s.output.config.DB != 0 {
+		err = s.command("SELECT", strconv.Itoa(s.output.config.DB))
+	}
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// command sends a command of the output itself, which must succeed
+func (s *redisSession) command(args ...string) error {
+	cmd := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		cmd = append(cmd, "$"+strconv.Itoa(len(arg))+"\r\n"+arg+"\r\n"...)
+	}
+	if _, err := s.conn.Write(cmd); err != nil {
+		return err
+	}
+	reply, err := s.readReply()
+	if err != nil {
+		return err
+	}
+	if reply[0] == '-' {
+		return fmt.Errorf("%s failed: %s", args[0], reply[1:len(reply)-2])
+	}
+	return nil
+}
+
+func (s *redisSession) readReply() (reply []byte, err error) {
+	for {
+		if reply, err = redis.ReadValue(s.reader, reply[:0]); err != nil || !redis.IsPush(reply) {
+			return
+		}
+	}
+}
+
+func (s *redisSession) send(msg *Message) {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			Debug(1, fmt.Sprintf("[REDIS-OUTPUT] connection error: %q", err))
+			return
+		}
+	}
+
+	start := time.Now()
+	s.conn.SetDeadline(start.Add(s.output.config.Timeout))
+	_, err := s.conn.Write(msg.Data)
+	var reply []byte
+	if err == nil {
+		reply, err = s.readReply()
+	}
+	stop := time.Now()
+
+	if err != nil {
+		Debug(1, fmt.Sprintf("[REDIS-OUTPUT] error when sending: %q", err))
+		s.conn.Close()
+		s.conn = nil
+		return
+	}
+
+	if s.output.config.TrackResponses {
+		s.output.responses <- &response{reply, payloadID(msg.Meta), start.UnixNano(), stop.UnixNano() - start.UnixNano()}
+	}
+}
+
+// PluginWrite writes message to this plugin
+func (o *RedisOutput) PluginWrite(msg *Message) (n int, err error) {
+	if !isRequestPayload(msg.Meta) {
+		return len(msg.Data), nil
+	}
+
+	return o.dispatcher.dispatch(msg)
+}
+
+// PluginRead reads message from this plugin
+func (o *RedisOutput) PluginRead() (*Message, error) {
+	if !o.config.TrackResponses {
+		return nil, ErrorStopped
+	}
+	var resp *response
+	var msg Message
+	select {
+	case <-o.dispatcher.stop:
+		return nil, ErrorStopped
+	case resp = <-o.responses:
+		msg.Data = resp.payload
+	}
+
+	msg.Meta = payloadHeader(ReplayedResponsePayload, resp.uuid, resp.startedAt, resp.roundTripTime)
+
+	return &msg, nil
+}
+
+func (o *RedisOutput) String() string {
+	return "Redis output: " + o.address
+}
+
+// Close closes the data channel so that data
+func (o *RedisOutput) Close() error {
+	o.dispatcher.close()
+	return nil
+}
@@ -0,0 +1,66 @@
+package goreplay
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/buger/goreplay/internal/redis"
+)
+
+func TestRedisOutput(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for {
+			cmd, err := redis.ReadValue(r, nil)
+			if err != nil {
+				return
+			}
+			switch {
+			case bytes.Contains(cmd, []byte("AUTH")):
+				if !bytes.Contains(cmd, []byte("secret")) {
+					t.Errorf("wrong AUTH %q", cmd)
+				}
+				conn.Write([]byte("+OK\r\n"))
+			case bytes.Contains(cmd, []byte("GET")):
+				// a push before the reply
+				conn.Write([]byte(">2\r\n$10\r\ninvalidate\r\n*0\r\n$1\r\nv\r\n"))
+			default:
+				conn.Write([]byte("-ERR unknown\r\n"))
+			}
+		}
+	}()
+
+	output := NewRedisOutput(ln.Addr().String(), &RedisOutputConfig{Password: "secret", TrackResponses: true})
+	defer output.(*RedisOutput).Close()
+
+	id := []byte("0102030405060708aaaaaaaa")
+	output.PluginWrite(&Message{
+		Meta: payloadHeader(RequestPayload, id, 1, -1),
+		Data: []byte("*2\r\n$3\r\nGET\r\n$1\r\nk\r\n"),
+	})
+
+	msg, err := output.PluginRead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Meta[0] != ReplayedResponsePayload || !bytes.Equal(payloadID(msg.Meta), id) {
+		t.Errorf("wrong meta %q", msg.Meta)
+	}
+	if string(msg.Data) != "$1\r\nv\r\n" {
+		t.Errorf("wrong reply %q", msg.Data)
+	}
+}
@@ -0,0 +1,110 @@
+package goreplay
+
+import (
+	"expvar"
+	"time"
+)
+
+// sessionStats counts the messages dropped by the session dispatchers
+var sessionStats = expvar.NewMap("output-sessions")
+
+// replaySession replays the messages of a captured connection over a connection of its own
+type replaySession interface {
+	// handle replays a message, the messages of a session are handled in order by one goroutine
+	handle(msg *Message)
+	// close releases the connection of the session once it has no messages left
+	close()
+}
+
+// sessionDispatcher dispatches the messages of an output to a worker per captured connection,
+// keyed by connectionID. The workers are stopped after 2 minutes without messages.
+// The messages of a session whose worker falls behind are dropped, so that one slow connection
+// doesn't hold the others.
+type sessionDispatcher struct {
+	queue      chan *Message
+	workers    map[string]*sessionWorker
+	newSession func() replaySession
+	stop       chan bool // Channel used only to indicate goroutine should shutdown
+}
+
+type sessionWorker struct {
+	queue        chan *Message
+	lastActivity time.Time
+}
+
+func newSessionDispatcher(newSession func() replaySession) *sessionDispatcher {
+	d := &sessionDispatcher{
+		queue:      make(chan *Message, 1000),
+		workers:    make(map[string]*sessionWorker),
+		newSession: newSession,
+		stop:       make(chan bool),
+	}
+	go d.sessionMaster()
+	return d
+}
+
+// dispatch queues a message for the session of its connection
+func (d *sessionDispatcher) dispatch(msg *Message) (n int, err error) {
+	select {
+	case <-d.stop:
+		return 0, ErrorStopped
+	case d.queue <- msg:
+	}
+	return len(msg.Data) + len(msg.Meta), nil
+}
+
+func (d *sessionDispatcher) sessionMaster() {
+	gc := time.NewTicker(time.Second)
+	defer gc.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			for _, w := range d.workers {
+				close(w.queue)
+			}
+			return
+		case msg := <-d.queue:
+			id := string(connectionID(msg.Meta))
+			w, ok := d.workers[id]
+			if !ok {
+				w = d.newWorker()
+				d.workers[id] = w
+			}
+
+			select {
+			case w.queue <- msg:
+			default:
+				sessionStats.Add("dropped", 1)
+				Debug(1, "[OUTPUT-SESSION] the session is too slow, dropping a message")
+			}
+			w.lastActivity = time.Now()
+		case now := <-gc.C:
+			for id, w := range d.workers {
+				if now.Sub(w.lastActivity) >= 120*time.Second {
+					close(w.queue)
+					delete(d.workers, id)
+				}
+			}
+		}
+	}
+}
+
+func (d *sessionDispatcher) newWorker() *sessionWorker {
+	w := &sessionWorker{queue: make(chan *Message, 100)}
+	s := d.newSession()
+
+	go func() {
+		for msg := range w.queue {
+			s.handle(msg)
+		}
+		s.close()
+	}()
+
+	return w
+}
+
+// close stops the workers, the sessions are closed once they handled their queued messages
+func (d *sessionDispatcher) close() {
+	close(d.stop)
+}
@@ -0,0 +1,51 @@
+package goreplay
+
+import (
+	"testing"
+	"time"
+)
+
+type blockingSession struct {
+	handled chan *Message
+	release chan bool
+}
+
+func (s *blockingSession) handle(msg *Message) {
+	<-s.release
+	s.handled <- msg
+}
+
+func (s *blockingSession) close() {}
+
+func TestSessionDispatcherSlowSession(t *testing.T) {
+	slow := &blockingSession{handled: make(chan *Message, 1000), release: make(chan bool)}
+	fast := &blockingSession{handled: make(chan *Message, 1000), release: make(chan bool)}
+	close(fast.release)
+
+	sessions := []replaySession{slow, fast}
+	d := newSessionDispatcher(func() replaySession {
+		s := sessions[0]
+		sessions = sessions[1:]
+		return s
+	})
+	defer d.close()
+
+	slowID, fastID := "0000000000000001aaaaaaaa", "0000000000000002aaaaaaaa"
+	for i := 0; i < 200; i++ {
+		d.dispatch(&Message{Meta: payloadHeader(RequestPayload, []byte(slowID), 1, -1)})
+	}
+	d.dispatch(&Message{Meta: payloadHeader(RequestPayload, []byte(fastID), 1, -1)})
+
+	select {
+	case msg := <-fast.handled:
+		if string(payloadID(msg.Meta)) != fastID {
+			t.Errorf("expected a message of the fast session, got %q", msg.Meta)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a slow session should not hold the others")
+	}
+	if v := sessionStats.Get("dropped"); v == nil || v.String() == "0" {
+		t.Error("the messages dropped from the slow session should be counted")
+	}
+	close(slow.release)
+}
@@ -95,6 +95,8 @@ func (o *TCPOutput) worker(bufferIndex int) {
 			o.buf[bufferIndex] <- msg
 			break
 		}
+		// retained by PluginWrite
+		msg.Spill.Release()
 	}
 }
 
@@ -105,7 +107,7 @@ func (o *TCPOutput) writeToConnection(conn net.Conn, msg *Message) (err error) {
 
 	if err == nil {
 		if _, err = conn.Write(msg.Meta); err == nil {
-			if _, err = conn.Write(msg.Data); err == nil {
+			if _, err = writePayload(conn, msg); err == nil {
 				_, err = conn.Write(payloadSeparatorAsBytes)
 			}
 		}
@@ -127,10 +129,13 @@ func (o *TCPOutput) getBufferIndex(msg *Message) int {
 
 // PluginWrite writes message to this plugin
 func (o *TCPOutput) PluginWrite(msg *Message) (n int, err error) {
-	if !isOriginPayload(msg.Meta) {
+	// connection events are forwarded, so the gor reading them keeps the connections boundaries
+	if !isOriginPayload(msg.Meta) && !isConnectionPayload(msg.Meta) {
 		return len(msg.Data), nil
 	}
 
+	// the payload is streamed by the workers
+	msg.Spill.Retain()
 	bufferIndex := o.getBufferIndex(msg)
 	o.buf[bufferIndex] <- msg
 
@@ -0,0 +1,150 @@
+package goreplay
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// maxDatagramSize is the size of the largest UDP payload
+const maxDatagramSize = 1<<16 - 1
+
+// UDPOutputConfig struct for holding udp output configuration
+type UDPOutputConfig struct {
+	Workers        int           `json:"output-udp-workers"`
+	Timeout        time.Duration `json:"output-udp-timeout"`
+	TrackResponses bool          `json:"output-udp-track-response"`
+}
+
+// UDPOutput replays datagrams captured with `--input-raw-transport udp`.
+// Datagrams are stateless, so they are sent by a fixed number of workers, each with its own socket.
+// When responses are tracked, a worker waits for the response before sending the next datagram.
+type UDPOutput struct {
+	address   string
+	config    *UDPOutputConfig
+	queue     chan *Message
+	responses chan *response
+	stop      chan bool // Channel used only to indicate goroutine should shutdown
+}
+
+// NewUDPOutput constructor for UDPOutput
+func NewUDPOutput(address string, config *UDPOutputConfig) PluginReadWriter {
+	o := new(UDPOutput)
+	o.address = address
+	o.config = config
+	if o.config.Timeout <= 0 {
+		o.config.Timeout = 5 * time.Second
+	}
+	if o.config.Workers <= 0 {
+		o.config.Workers = 10
+	}
+
+	o.queue = make(chan *Message, 1000)
+	if o.config.TrackResponses {
+		o.responses = make(chan *response, 1000)
+	}
+	o.stop = make(chan bool)
+
+	for i := 0; i < o.config.Workers; i++ {
+		go o.worker()
+	}
+
+	return o
+}
+
+func (o *UDPOutput) worker() {
+	var conn net.Conn
+	buf := make([]byte, maxDatagramSize)
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-o.stop:
+			return
+		case msg := <-o.queue:
+			conn = o.send(conn, buf, msg)
+		}
+	}
+}
+
+// send sends the datagram and reads its response, it returns the socket to use for the next datagram
+func (o *UDPOutput) send(conn net.Conn, buf []byte, msg *Message) net.Conn {
+	var err error
+	if conn == nil {
+		if conn, err = net.DialTimeout("udp", o.address, o.config.Timeout); err != nil {
+			Debug(1, fmt.Sprintf("[UDP-OUTPUT] connection error: %q", err))
+			return nil
+		}
+	}
+
+	start := time.Now()
+	conn.SetDeadline(start.Add(o.config.Timeout))
+	if _, err = conn.Write(msg.Data); err != nil {
+		Debug(1, fmt.Sprintf("[UDP-OUTPUT] error when sending: %q", err))
+		conn.Close()
+		return nil
+	}
+	if !o.config.TrackResponses {
+		return conn
+	}
+
+	n, err := conn.Read(buf)
+	stop := time.Now()
+	if err != nil {
+		Debug(1, fmt.Sprintf("[UDP-OUTPUT] error when reading the response: %q", err))
+		// a late response must not be taken for the response of the next datagram
+		conn.Close()
+		return nil
+	}
+
+	o.responses <- &response{append([]byte(nil), buf[:n]...), payloadID(msg.Meta), start.UnixNano(), stop.UnixNano() - start.UnixNano()}
+	return conn
+}
+
+// PluginWrite writes message to this plugin
+func (o *UDPOutput) PluginWrite(msg *Message) (n int, err error) {
+	if !isRequestPayload(msg.Meta) {
+		return len(msg.Data), nil
+	}
+
+	select {
+	case <-o.stop:
+		return 0, ErrorStopped
+	case o.queue <- msg:
+	}
+
+	return len(msg.Data) + len(msg.Meta), nil
+}
+
+// PluginRead reads message from this plugin
+func (o *UDPOutput) PluginRead() (*Message, error) {
+	if !o.config.TrackResponses {
+		return nil, ErrorStopped
+	}
+	var resp *response
+	var msg Message
+	select {
+	case <-o.stop:
+		return nil, ErrorStopped
+	case resp = <-o.responses:
+		msg.Data = resp.payload
+	}
+
+	msg.Meta = payloadHeader(ReplayedResponsePayload, resp.uuid, resp.startedAt, resp.roundTripTime)
+
+	return &msg, nil
+}
+
+func (o *UDPOutput) String() string {
+	return "UDP output: " + o.address
+}
+
+// Close closes the data channel so that data
+func (o *UDPOutput) Close() error {
+	close(o.stop)
+	return nil
+}
@@ -0,0 +1,60 @@
+package goreplay
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUDPOutput(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			received <- string(buf[:n])
+			conn.WriteTo(append([]byte("re: "), buf[:n]...), addr)
+		}
+	}()
+
+	output := NewUDPOutput(conn.LocalAddr().String(), &UDPOutputConfig{Workers: 1, TrackResponses: true})
+	defer output.(*UDPOutput).Close()
+
+	id := []byte("0102030405060708aaaaaaaa")
+	output.PluginWrite(&Message{Meta: payloadHeader(RequestPayload, id, 1, -1), Data: []byte("query")})
+	// responses of the original capture are not sent
+	output.PluginWrite(&Message{Meta: payloadHeader(ResponsePayload, id, 2, 1), Data: []byte("answer")})
+
+	select {
+	case data := <-received:
+		if data != "query" {
+			t.Errorf("wrong datagram %q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("datagram was not sent")
+	}
+
+	msg, err := output.PluginRead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payloadID(msg.Meta), id) || msg.Meta[0] != ReplayedResponsePayload || string(msg.Data) != "re: query" {
+		t.Errorf("wrong replayed response %q %q", msg.Meta, msg.Data)
+	}
+
+	select {
+	case data := <-received:
+		t.Errorf("unexpected datagram %q", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
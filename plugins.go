@@ -3,12 +3,20 @@ package goreplay
 import (
 	"reflect"
 	"strings"
+
+	"github.com/buger/goreplay/internal/capture"
 )
 
 // Message represents data across plugins
 type Message struct {
 	Meta []byte // metadata
 	Data []byte // actual data
+
+	// the part of the payload above --copy-buffer-size, kept in a temporary file, see Message.Reader
+	Spill *Spill
+
+	// pods that sent and received the message, set by input-raw when the k8s metadata is enabled
+	SrcPod, DstPod *capture.PodInfo
 }
 
 // PluginReader is an interface for input plugins
@@ -105,6 +113,21 @@ func NewPlugins() *InOutPlugins {
 		plugins.registerPlugin(NewNullOutput)
 	}
 
+	if len(Settings.InputRAW) == 0 && (Settings.InputRAWConfig.Process != "" || Settings.InputRAWConfig.PID != 0) {
+		// capture the ports of the process on all the interfaces
+		Settings.InputRAW = []string{""}
+	}
+
+	if Settings.OutputPcap != "" && len(Settings.InputRAW) > 0 {
+		output := NewPcapOutput(Settings.OutputPcap, &Settings.OutputPcapConfig)
+		Settings.InputRAWConfig.PacketWriter = output
+		plugins.All = append(plugins.All, output)
+	}
+
+	if len(Settings.K8sFilters) > 0 || len(Settings.K8sNegativeFilters) > 0 {
+		Settings.InputRAWConfig.K8sMetadata = true
+	}
+
 	for _, options := range Settings.InputRAW {
 		plugins.registerPlugin(NewRAWInput, options, Settings.InputRAWConfig)
 	}
@@ -122,7 +145,7 @@ func NewPlugins() *InOutPlugins {
 	}
 
 	for _, options := range Settings.InputFile {
-		plugins.registerPlugin(NewFileInput, options, Settings.InputFileLoop, Settings.InputFileReadDepth, Settings.InputFileMaxWait, Settings.InputFileDryRun)
+		plugins.registerPlugin(NewFileInputWithConfig, options, Settings.InputFileLoop, Settings.InputFileReadDepth, Settings.InputFileMaxWait, Settings.InputFileDryRun, &Settings.InputFileConfig)
 	}
 
 	for _, path := range Settings.OutputFile {
@@ -154,6 +177,18 @@ func NewPlugins() *InOutPlugins {
 		plugins.registerPlugin(NewBinaryOutput, options, &Settings.OutputBinaryConfig)
 	}
 
+	for _, options := range Settings.OutputMySQL {
+		plugins.registerPlugin(NewMySQLOutput, options, &Settings.OutputMySQLConfig)
+	}
+
+	for _, options := range Settings.OutputRedis {
+		plugins.registerPlugin(NewRedisOutput, options, &Settings.OutputRedisConfig)
+	}
+
+	for _, options := range Settings.OutputUDP {
+		plugins.registerPlugin(NewUDPOutput, options, &Settings.OutputUDPConfig)
+	}
+
 	if Settings.OutputKafkaConfig.Host != "" && Settings.OutputKafkaConfig.Topic != "" {
 		plugins.registerPlugin(NewKafkaOutput, "", &Settings.OutputKafkaConfig, &Settings.KafkaTLSConfig)
 	}
@@ -353,7 +353,7 @@ func HasResponseTitle(payload []byte) bool {
 		return false
 	}
 	major, minor, ok := http.ParseHTTPVersion(s[0:VersionLen])
-	if !(ok && major == 1 && (minor == 0 || minor == 1)) {
+	if !(ok && validVersion(major, minor)) {
 		return false
 	}
 	if s[VersionLen] != ' ' {
@@ -399,7 +399,13 @@ func HasRequestTitle(payload []byte) bool {
 		return false
 	}
 	major, minor, ok := http.ParseHTTPVersion(s[path+len(method)+2 : titleLen])
-	return ok && major == 1 && (minor == 0 || minor == 1)
+	return ok && validVersion(major, minor)
+}
+
+// validVersion reports whether this is HTTP/1.0, HTTP/1.1 or HTTP/2.0,
+// the latter is only used by HTTP/2 messages converted to the HTTP/1 payload form
+func validVersion(major, minor int) bool {
+	return major == 1 && (minor == 0 || minor == 1) || major == 2 && minor == 0
 }
 
 // HasTitle reports if this payload has an http/1 title
@@ -467,6 +473,11 @@ type HTTPState struct {
 // Message param is optional but recommended on cases where 'data' is storing
 // partial-to-full stream of bytes(packets).
 func HasFullPayload(m ProtocolStateSetter, payloads ...[]byte) bool {
+	return hasFullPayload(httpState(m), payloads)
+}
+
+// httpState returns the state of the message, the state is not kept when m is nil
+func httpState(m ProtocolStateSetter) *HTTPState {
 	var state *HTTPState
 	if m != nil {
 		state, _ = m.ProtocolState().(*HTTPState)
@@ -477,7 +488,10 @@ func HasFullPayload(m ProtocolStateSetter, payloads ...[]byte) bool {
 			m.SetProtocolState(state)
 		}
 	}
+	return state
+}
 
+func hasFullPayload(state *HTTPState, payloads [][]byte) bool {
 	// Http Packets can only start with a few things, check if this is one of them
 	if len(payloads) == 0 {
 		return false
@@ -522,6 +536,10 @@ func HasFullPayload(m ProtocolStateSetter, payloads ...[]byte) bool {
 	if !state.HeaderParsed {
 		var pos int
 		for _, data := range payloads {
+			// the headers of the next pipelined message are not ours
+			if pos+len(data) > state.HeaderEnd {
+				data = data[:state.HeaderEnd-pos]
+			}
 			chunked := Header(data, []byte("Transfer-Encoding"))
 
 			if len(chunked) > 0 && bytes.Index(data, []byte("chunked")) > 0 {
@@ -577,6 +595,54 @@ func HasFullPayload(m ProtocolStateSetter, payloads ...[]byte) bool {
 	return state.BodyLen == bodyLen
 }
 
+// PipelinedLen returns the length of the first HTTP message of payloads that hold several of them,
+// like the requests of a client using HTTP pipelining, or the responses to them.
+// A 101 Switching Protocols response ends with its headers, whatever follows.
+// It is 0 while the first message is not complete, or when it is the whole payload.
+// The message param keeps the state of HasFullPayload, see HasFullPayload.
+func PipelinedLen(m ProtocolStateSetter, payloads ...[]byte) int {
+	state := httpState(m)
+	if hasFullPayload(state, payloads) || !state.HeaderParsed {
+		return 0
+	}
+
+	var total int
+	for _, data := range payloads {
+		total += len(data)
+	}
+	n := state.Body + state.BodyLen
+	if n >= total {
+		return 0
+	}
+
+	// the payloads are only joined when they can hold the end of a chunked body
+	if state.IsChunked && (state.HasTrailer || !bytes.Contains(payloads[len(payloads)-1], EmptyLine)) {
+		// the end of the trailers can not be told from the end of the chunks
+		return 0
+	}
+	data := bytes.Join(payloads, nil)
+	if state.IsChunked {
+		end, full := CheckChunked(data[state.Body:])
+		if !full {
+			return 0
+		}
+		n = state.Body + end
+	}
+
+	if n >= len(data) {
+		return 0
+	}
+	// the rest of a connection switched to another protocol is not HTTP
+	if string(Status(data)) == "101" {
+		return n
+	}
+	// the rest must be the start of another message, wait for its title
+	if !HasTitle(data[n:]) {
+		return 0
+	}
+	return n
+}
+
 // this works with positive integers
 func atoI(s []byte, base int) (num int, ok bool) {
 	var v int
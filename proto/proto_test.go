@@ -495,6 +495,39 @@ func TestHasFullPayload(t *testing.T) {
 	}
 }
 
+func TestPipelinedLen(t *testing.T) {
+	get := "GET /a HTTP/1.1\r\nHost: a\r\n\r\n"
+	post := "POST /b HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\n\r\nhello"
+	chunked := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n7\r\nMozilla\r\n0\r\n\r\n"
+	ok := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"
+
+	tests := []struct {
+		name     string
+		payloads []string
+		expected int
+	}{
+		{"single message", []string{get}, 0},
+		{"without body", []string{get + post}, len(get)},
+		{"content-length of the next message", []string{get, post + get}, len(get)},
+		{"with body", []string{post + get}, len(post)},
+		{"incomplete first message", []string{post[:len(post)-2]}, 0},
+		{"incomplete title of the next message", []string{post + "GET /a HT"}, 0},
+		{"chunked", []string{chunked + ok}, len(chunked)},
+		{"chunked across payloads", []string{chunked[:50], chunked[50:] + ok}, len(chunked)},
+		{"not a message after", []string{get + "garbage\r\n"}, 0},
+		{"switching protocols", []string{"HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n\x81\x02hi"}, 56},
+	}
+	for _, tt := range tests {
+		var payloads [][]byte
+		for _, p := range tt.payloads {
+			payloads = append(payloads, []byte(p))
+		}
+		if n := PipelinedLen(nil, payloads...); n != tt.expected {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.expected, n)
+		}
+	}
+}
+
 func BenchmarkHasFullPayload(b *testing.B) {
 	data := []byte("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n1e\r\n111111111111111111111111111111\r\n0\r\n\r\n")
 	for i := 0; i < b.N; i++ {
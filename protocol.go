@@ -5,6 +5,8 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+
+	"github.com/buger/goreplay/internal/tcp"
 )
 
 // These constants help to indicate the type of payload
@@ -12,6 +14,10 @@ const (
 	RequestPayload          = '1'
 	ResponsePayload         = '2'
 	ReplayedResponsePayload = '3'
+	WebSocketFramePayload   = '4'
+	ConnectionOpenPayload   = '5'
+	ConnectionClosePayload  = '6'
+	ConnectionResetPayload  = '7'
 )
 
 func randByte(len int) []byte {
@@ -53,6 +59,26 @@ func payloadHeader(payloadType byte, uuid []byte, timing int64, latency int64) (
 	return []byte(fmt.Sprintf("%c %s %d %d\n", payloadType, uuid, timing, latency))
 }
 
+// framePayloadHeader is the header of a WebSocket frame, its ID is the ID of the handshake
+func framePayloadHeader(uuid []byte, timing int64, latency int64, fromClient bool, opcode byte) (header []byte) {
+	//Example:
+	//  4 f45590522cd1838b4a0d5c5aab80b77929dea3b3 13923489726487326 1231 client 1\n
+	from := "server"
+	if fromClient {
+		from = "client"
+	}
+	return []byte(fmt.Sprintf("%c %s %d %d %s %d\n", WebSocketFramePayload, uuid, timing, latency, from, opcode))
+}
+
+// connectionPayload is the payload of a connection event, its ID is the start of the IDs of the requests of the connection,
+// and its body holds the addresses of the client and of the server
+func connectionPayload(payloadType byte, connID []byte, timing int64, client, server string) (header, body []byte) {
+	//Example:
+	//  5 c8500050c0a80001 13923489726487326 0\n
+	//  10.0.0.2:51234 10.0.0.1:80
+	return payloadHeader(payloadType, connID, timing, 0), []byte(client + " " + server)
+}
+
 func payloadBody(payload []byte) []byte {
 	headerSize := bytes.IndexByte(payload, '\n')
 	return payload[headerSize+1:]
@@ -85,8 +111,28 @@ func payloadID(payload []byte) (id []byte) {
 	return meta[1]
 }
 
+// connectionID returns the ID of the connection of a payload, the part of its ID made of the ports and the ip of the client.
+// The requests and responses of a connection, and its connection events, have the same.
+func connectionID(payload []byte) []byte {
+	return tcp.ConnectionID(payloadID(payload))
+}
+
 func isOriginPayload(payload []byte) bool {
-	return payload[0] == RequestPayload || payload[0] == ResponsePayload
+	return payload[0] == RequestPayload || payload[0] == ResponsePayload || payload[0] == WebSocketFramePayload
+}
+
+func isConnectionPayload(payload []byte) bool {
+	return payload[0] == ConnectionOpenPayload || payload[0] == ConnectionClosePayload || payload[0] == ConnectionResetPayload
+}
+
+func isFramePayload(payload []byte) bool {
+	return payload[0] == WebSocketFramePayload
+}
+
+// isClientFrame tells if a WebSocket frame was sent by the client, see framePayloadHeader
+func isClientFrame(meta []byte) bool {
+	fields := payloadMeta(meta)
+	return isFramePayload(meta) && len(fields) > 4 && string(fields[4]) == "client"
 }
 
 func isRequestPayload(payload []byte) bool {
@@ -71,6 +71,7 @@ type AppSettings struct {
 	Pprof                string `json:"http-pprof"`
 
 	CopyBufferSize size.Size `json:"copy-buffer-size"`
+	SpillDir       string    `json:"spill-dir"`
 
 	InputDummy   []string `json:"input-dummy"`
 	OutputDummy  []string
@@ -94,6 +95,10 @@ type AppSettings struct {
 	InputFileMaxWait   time.Duration `json:"input-file-max-wait"`
 	OutputFile         []string      `json:"output-file"`
 	OutputFileConfig   FileOutputConfig
+	InputFileConfig    FileInputConfig
+
+	OutputPcap       string `json:"output-pcap"`
+	OutputPcapConfig PcapOutputConfig
 
 	InputRAW       []string `json:"input_raw"`
 	InputRAWConfig RAWInputConfig
@@ -109,8 +114,20 @@ type AppSettings struct {
 	OutputBinary       []string `json:"output-binary"`
 	OutputBinaryConfig BinaryOutputConfig
 
+	OutputMySQL       []string `json:"output-mysql"`
+	OutputMySQLConfig MySQLOutputConfig
+
+	OutputRedis       []string `json:"output-redis"`
+	OutputRedisConfig RedisOutputConfig
+
+	OutputUDP       []string `json:"output-udp"`
+	OutputUDPConfig UDPOutputConfig
+
 	ModifierConfig HTTPModifierConfig
 
+	K8sFilters         K8sFilters `json:"k8s-allow"`
+	K8sNegativeFilters K8sFilters `json:"k8s-disallow"`
+
 	InputKafkaConfig  InputKafkaConfig
 	OutputKafkaConfig OutputKafkaConfig
 	KafkaTLSConfig    KafkaTLSConfig
@@ -167,30 +184,48 @@ func init() {
 	flag.IntVar(&Settings.InputFileReadDepth, "input-file-read-depth", 100, "GoReplay tries to read and cache multiple records, in advance. In parallel it also perform sorting of requests, if they came out of order. Since it needs hold this buffer in memory, bigger values can cause worse performance")
 	flag.BoolVar(&Settings.InputFileDryRun, "input-file-dry-run", false, "Simulate reading from the data source without replaying it. You will get information about expected replay time, number of found records etc.")
 	flag.DurationVar(&Settings.InputFileMaxWait, "input-file-max-wait", 0, "Set the maximum time between requests. Can help in situations when you have too long periods between request, and you want to skip them. Example: --input-raw-max-wait 1s")
+	flag.StringVar(&Settings.InputFileConfig.Start, "input-file-start", "", "Replay the records from this time: an offset from the start of the recording, a RFC3339 time or unix nanoseconds. The index of binary recordings is used to skip to it. Example: --input-file-start 2h30m")
+	flag.StringVar(&Settings.InputFileConfig.End, "input-file-end", "", "Stop replaying after this time: an offset from the start of the recording, a RFC3339 time or unix nanoseconds. Example: --input-file-start 2h30m --input-file-end 2h40m")
+	flag.Int64Var(&Settings.InputFileConfig.SkipRecords, "input-file-skip-records", 0, "Skip the first N records of every input file. The index of binary recordings is used to skip to them.")
+	flag.StringVar(&Settings.InputFileConfig.Checkpoint, "input-file-checkpoint", "", "Write the position of the replay in every input file to this file every second, a replay which was stopped or crashed resumes from it. It is removed once the files were replayed. Example: --input-file-checkpoint replay.checkpoint")
 
 	flag.Var(&MultiOption{&Settings.OutputFile}, "output-file", "Write incoming requests to file: \n\tgor --input-raw :80 --output-file ./requests.gor")
 	flag.DurationVar(&Settings.OutputFileConfig.FlushInterval, "output-file-flush-interval", time.Second, "Interval for forcing buffer flush to the file, default: 1s.")
 	flag.BoolVar(&Settings.OutputFileConfig.Append, "output-file-append", false, "The flushed chunk is appended to existence file or not. ")
+	flag.StringVar(&Settings.OutputFileConfig.Format, "output-file-format", FileFormatBinary, "Format of the recordings: binary, with length-prefixed and checksummed records and a time index, or text, with the records separated by a line. --input-file reads both. Convert recordings with:\n\tgor file-convert binary|text <src> <dst>")
 	flag.Var(&Settings.OutputFileConfig.SizeLimit, "output-file-size-limit", "Size of each chunk. Default: 32mb")
 	flag.IntVar(&Settings.OutputFileConfig.QueueLimit, "output-file-queue-limit", 256, "The length of the chunk queue. Default: 256")
 	flag.Var(&Settings.OutputFileConfig.OutputFileMaxSize, "output-file-max-size-limit", "Max size of output file, Default: 1TB")
 
 	flag.StringVar(&Settings.OutputFileConfig.BufferPath, "output-file-buffer", "/tmp", "The path for temporary storing current buffer: \n\tgor --input-raw :80 --output-file s3://mybucket/logs/%Y-%m-%d.gz --output-file-buffer /mnt/logs")
 
+	flag.StringVar(&Settings.OutputPcap, "output-pcap", "", "Write the raw packets captured by --input-raw to pcap files, for debugging with Wireshark. Supports the same date templating as --output-file, except %NS, the name is updated every second: \n\tgor --input-raw :80 --output-http staging.com --output-pcap /var/log/gor/%Y%m%d.pcap")
+	flag.Var(&Settings.OutputPcapConfig.SizeLimit, "output-pcap-size-limit", "Start a new pcap file when the current one reaches this size. Default: no limit")
+	flag.DurationVar(&Settings.OutputPcapConfig.RotateInterval, "output-pcap-rotate-interval", 0, "Start a new pcap file after this interval. Default: no limit")
+	flag.DurationVar(&Settings.OutputPcapConfig.FlushInterval, "output-pcap-flush-interval", time.Second, "Interval for forcing buffer flush to the pcap file, default: 1s.")
+
 	flag.BoolVar(&Settings.PrettifyHTTP, "prettify-http", false, "If enabled, will automatically decode requests and responses with: Content-Encoding: gzip and Transfer-Encoding: chunked. Useful for debugging, in conjunction with --output-stdout")
 
-	flag.Var(&Settings.CopyBufferSize, "copy-buffer-size", "Set the buffer size for an individual request (default 5MB)")
+	flag.Var(&Settings.CopyBufferSize, "copy-buffer-size", "Set the buffer size for an individual request (default 5MB). The rest of larger requests and responses is kept in a temporary file of --spill-dir, and streamed to the file, http and tcp outputs. The other outputs and the middleware receive them truncated")
+	flag.StringVar(&Settings.SpillDir, "spill-dir", "", "Directory of the temporary files holding the payloads larger than --copy-buffer-size. Default: the system temporary directory")
 
 	// input raw flags
-	flag.Var(&MultiOption{&Settings.InputRAW}, "input-raw", "Capture traffic from given port (use RAW sockets and require *sudo* access):\n\t# Capture traffic from 8080 port\n\tgor --input-raw :8080 --output-http staging.com")
+	flag.Var(&MultiOption{&Settings.InputRAW}, "input-raw", "Capture traffic from given port (use RAW sockets and require *sudo* access):\n\t# Capture traffic from 8080 port\n\tgor --input-raw :8080 --output-http staging.com\n\t# Replay capture files: pcap or pcapng, optionally gzipped, a glob or a directory. Packets of all the files are read in timestamp order\n\tgor --input-raw './captures/*.pcapng.gz:8080' --output-http staging.com\n\t# Capture the traffic of docker containers, by name or label. Their IPs are followed through restarts with the Docker Engine API\n\tgor --input-raw docker://com.docker.compose.service=web:8080 --output-http staging.com")
 	flag.BoolVar(&Settings.InputRAWConfig.TrackResponse, "input-raw-track-response", false, "If turned on Gor will track responses in addition to requests, and they will be available to middleware and file output.")
+	flag.BoolVar(&Settings.InputRAWConfig.ConnectionEvents, "input-raw-connection-events", false, "If turned on Gor will emit payloads when TCP connections are opened, closed or reset, with their connection id and client and server addresses. They are kept by the file output and passed to middleware.")
 	flag.IntVar(&Settings.InputRAWConfig.VXLANPort, "input-raw-vxlan-port", 4789, "VXLAN port. Can be used only when engine set to `vxlan`. Default: 4789")
 	flag.Var(&MultiIntOption{&Settings.InputRAWConfig.VXLANVNIs}, "input-raw-vxlan-vni", "VXLAN VNI to capture. By default capture all VNIs. Ignore VNI by setting them with minus sign, example: `--input-raw-vxlan-vni -2`")
+	flag.Var(&MultiIntOption{&Settings.InputRAWConfig.GREKeys}, "input-raw-gre-key", "GRE key to capture. Can be used only when engine set to `gre`. By default capture all keys. Ignore keys by setting them with minus sign, example: `--input-raw-gre-key -2`")
+	flag.Var(&MultiIntOption{&Settings.InputRAWConfig.ERSPANSessions}, "input-raw-erspan-session", "ERSPAN session id to capture. Can be used only when engine set to `erspan`. By default capture all sessions. Ignore sessions by setting them with minus sign, example: `--input-raw-erspan-session -2`")
+	flag.IntVar(&Settings.InputRAWConfig.GenevePort, "input-raw-geneve-port", 6081, "Geneve port. Can be used only when engine set to `geneve`. Default: 6081")
+	flag.Var(&MultiIntOption{&Settings.InputRAWConfig.GeneveVNIs}, "input-raw-geneve-vni", "Geneve VNI to capture. By default capture all VNIs. Ignore VNI by setting them with minus sign, example: `--input-raw-geneve-vni -2`")
+	flag.IntVar(&Settings.InputRAWConfig.TZSPPort, "input-raw-tzsp-port", 37008, "TZSP port. Can be used only when engine set to `tzsp`. Default: 37008")
 	flag.BoolVar(&Settings.InputRAWConfig.VLAN, "input-raw-vlan", false, "Enable VLAN (802.1Q) support")
 	flag.Var(&MultiIntOption{&Settings.InputRAWConfig.VLANVIDs}, "input-raw-vlan-vid", "VLAN VID to capture. By default capture all VIDs")
-	flag.Var(&Settings.InputRAWConfig.Engine, "input-raw-engine", "Intercept traffic using `libpcap` (default), `raw_socket`, `pcap_file`, `vxlan`")
-	flag.Var(&Settings.InputRAWConfig.Protocol, "input-raw-protocol", "Specify application protocol of intercepted traffic. Possible values: http, binary")
-	flag.StringVar(&Settings.InputRAWConfig.RealIPHeader, "input-raw-realip-header", "", "If not blank, injects header with given name and real IP value to the request payload. Usually this header should be named: X-Real-IP")
+	flag.Var(&Settings.InputRAWConfig.Engine, "input-raw-engine", "Intercept traffic using `libpcap` (default), `raw_socket`, `pcap_file`, `vxlan`, `gre`, `erspan` (type I, II and III), `geneve` or `tzsp`. The tunnel engines receive mirrored traffic, `gre` and `erspan` need a raw IPv4 socket, `tzsp` receives packets streamed by sniffers like MikroTik routers and does not need root access. `pcap_file` is selected automatically for capture files, globs and directories")
+	flag.StringVar(&Settings.InputRAWConfig.Transport, "input-raw-transport", "tcp", "Transport protocol of intercepted traffic: tcp or udp. With udp every datagram sent to the port is a request, and the next datagram sent back is its response. Example: \n\t gor --input-raw :53 --input-raw-transport udp --output-udp staging-dns:53")
+	flag.Var(&Settings.InputRAWConfig.Protocol, "input-raw-protocol", "Specify application protocol of intercepted traffic. Possible values: http, http2, postgres, mysql, redis, binary")
+	flag.StringVar(&Settings.InputRAWConfig.RealIPHeader, "input-raw-realip-header", "", "If not blank, injects header with given name and real IP value to the request payload. The client announced by a PROXY protocol header is used when the connections come from a load balancer. Usually this header should be named: X-Real-IP")
 	flag.DurationVar(&Settings.InputRAWConfig.Expire, "input-raw-expire", time.Second*2, "How much it should wait for the last TCP packet, till consider that TCP message complete.")
 	flag.StringVar(&Settings.InputRAWConfig.BPFFilter, "input-raw-bpf-filter", "", "BPF filter to write custom expressions. Can be useful in case of non standard network interfaces like tunneling or SPAN port. Example: --input-raw-bpf-filter 'dst port 80'")
 	flag.StringVar(&Settings.InputRAWConfig.TimestampType, "input-raw-timestamp-type", "", "Possible values: PCAP_TSTAMP_HOST, PCAP_TSTAMP_HOST_LOWPREC, PCAP_TSTAMP_HOST_HIPREC, PCAP_TSTAMP_ADAPTER, PCAP_TSTAMP_ADAPTER_UNSYNCED. This values not supported on all systems, GoReplay will tell you available values of you put wrong one.")
@@ -202,6 +237,13 @@ func init() {
 	flag.BoolVar(&Settings.InputRAWConfig.Stats, "input-raw-stats", false, "enable stats generator on raw TCP messages")
 	flag.BoolVar(&Settings.InputRAWConfig.AllowIncomplete, "input-raw-allow-incomplete", false, "If turned on Gor will record HTTP messages with missing packets")
 	flag.Var(&MultiOption{&Settings.InputRAWConfig.IgnoreInterface}, "input-raw-ignore-interface", "In case if you want listen for all interfaces except a few ones. Can be used in k8s environment. Example: --input-raw-ignore-interface cbr0 --input-raw-ignore-interface eth0 --input-raw-ignore-interface localhost")
+	flag.StringVar(&Settings.InputRAWConfig.TLSKeyLog, "input-raw-tls-keylog", "", "Decrypt TLS traffic using the secrets of a NSS key log file, as written by applications when SSLKEYLOGFILE is set. Supports TLS 1.2 and 1.3 with AES-GCM and ChaCha20-Poly1305 cipher suites. Example: \n\t gor --input-raw :443 --input-raw-tls-keylog /tmp/sslkeys.log --output-stdout")
+	flag.StringVar(&Settings.InputRAWConfig.Process, "input-raw-process", "", "Capture the ports the processes with the given command name listen on, instead of the ports of --input-raw. The ports are looked up again every 5 seconds. Example: \n\t gor --input-raw-process nginx --output-stdout")
+	flag.IntVar(&Settings.InputRAWConfig.PID, "input-raw-pid", 0, "Capture the ports the process with the given pid listens on, instead of the ports of --input-raw. The ports are looked up again every 5 seconds. Example: \n\t gor --input-raw 10.0.0.1 --input-raw-pid 1234 --output-stdout")
+	flag.BoolVar(&Settings.InputRAWConfig.DockerNetns, "input-raw-docker-netns", false, "Capture in the network namespace of the container of a docker:// input, on its own interfaces like eth0 and lo. The namespace is entered again when the container is restarted. Example: \n\t gor --input-raw docker://web:80 --input-raw-docker-netns --output-stdout")
+	flag.IntVar(&Settings.InputRAWConfig.Workers, "input-raw-workers", 1, "Number of parsers reassembling the messages of each interface, the packets are spread among them by connection. With the af_packet engine, it is the number of sockets reading each interface in a fanout group, each one with its own parser. Example: \n\t gor --input-raw :80 --input-raw-engine af_packet --input-raw-workers 8 --output-stdout")
+	flag.BoolVar(&Settings.InputRAWConfig.K8sMetadata, "input-raw-k8s-metadata", false, "Look up the pods of the source and destination IPs of captured messages: name, namespace, labels and owning workload. Requires read access to the pods of the cluster, see k8s/README.md")
+	flag.StringVar(&Settings.InputRAWConfig.K8sMetadataHeader, "input-raw-k8s-metadata-header", "", "If not blank, injects the metadata of the pods into the request payload, with headers named after the given prefix. Enables --input-raw-k8s-metadata. Example: \n\t gor --input-raw k8s://default/deployment/web:80 --input-raw-k8s-metadata-header X-K8s --output-stdout\n\tadds X-K8s-Src-Pod, X-K8s-Src-Workload, X-K8s-Src-Labels and their X-K8s-Dst- counterparts")
 
 	flag.StringVar(&Settings.Middleware, "middleware", "", "Used for modifying traffic using external command")
 
@@ -213,6 +255,8 @@ func init() {
 	flag.IntVar(&Settings.OutputHTTPConfig.WorkersMax, "output-http-workers", 0, "Gor uses dynamic worker scaling. Enter a number to set a maximum number of workers. default = 0 = unlimited.")
 	flag.IntVar(&Settings.OutputHTTPConfig.QueueLen, "output-http-queue-len", 1000, "Number of requests that can be queued for output, if all workers are busy. default = 1000")
 	flag.BoolVar(&Settings.OutputHTTPConfig.SkipVerify, "output-http-skip-verify", false, "Don't verify hostname on TLS secure connection.")
+	flag.BoolVar(&Settings.OutputHTTPConfig.GRPC, "output-http-grpc", false, "Replay all requests as gRPC calls over HTTP/2 (h2c for http:// urls). Requests with a application/grpc content type are always replayed this way:\n\tgor --input-raw :50051 --input-raw-protocol http2 --output-http http://staging.com:50051 --output-http-grpc")
+	flag.BoolVar(&Settings.OutputHTTPConfig.WebSocket, "output-http-websocket", false, "Replay the WebSocket sessions captured by --input-raw: the handshake, then the frames of the client with their original timing. Frames of the server are not replayed:\n\tgor --input-raw :80 --output-http http://staging.com --output-http-websocket")
 	flag.DurationVar(&Settings.OutputHTTPConfig.WorkerTimeout, "output-http-worker-timeout", 2*time.Second, "Duration to rollback idle workers.")
 
 	flag.IntVar(&Settings.OutputHTTPConfig.RedirectLimit, "output-http-redirects", 0, "Enable how often redirects should be followed.")
@@ -236,6 +280,30 @@ func init() {
 	flag.BoolVar(&Settings.OutputBinaryConfig.Debug, "output-binary-debug", false, "Enables binary debug output.")
 	/* outputBinaryConfig */
 
+	/* outputMySQLConfig */
+	flag.Var(&MultiOption{&Settings.OutputMySQL}, "output-mysql", "Replays commands captured with --input-raw-protocol mysql, each captured session over its own connection:\n\tgor --input-raw :3306 --input-raw-protocol mysql --input-raw-track-response --output-mysql staging.com:3306 --output-mysql-user replay")
+	flag.StringVar(&Settings.OutputMySQLConfig.User, "output-mysql-user", "", "User used to authenticate replayed sessions.")
+	flag.StringVar(&Settings.OutputMySQLConfig.Password, "output-mysql-password", "", "Password used to authenticate replayed sessions.")
+	flag.StringVar(&Settings.OutputMySQLConfig.Database, "output-mysql-database", "", "Default database of replayed sessions.")
+	flag.DurationVar(&Settings.OutputMySQLConfig.Timeout, "output-mysql-timeout", 5*time.Second, "Specify MySQL command timeout. By default 5s.")
+	flag.BoolVar(&Settings.OutputMySQLConfig.TrackResponses, "output-mysql-track-response", false, "If turned on, MySQL output responses will be set to all outputs like stdout, file and etc.")
+	/* outputMySQLConfig */
+
+	/* outputRedisConfig */
+	flag.Var(&MultiOption{&Settings.OutputRedis}, "output-redis", "Replays commands captured with --input-raw-protocol redis, each captured session over its own connection:\n\tgor --input-raw :6379 --input-raw-protocol redis --output-redis staging.com:6379")
+	flag.StringVar(&Settings.OutputRedisConfig.Password, "output-redis-password", "", "Password sent with AUTH when a replayed session connects.")
+	flag.IntVar(&Settings.OutputRedisConfig.DB, "output-redis-db", 0, "Database selected when a replayed session connects.")
+	flag.DurationVar(&Settings.OutputRedisConfig.Timeout, "output-redis-timeout", 5*time.Second, "Specify Redis command timeout. By default 5s.")
+	flag.BoolVar(&Settings.OutputRedisConfig.TrackResponses, "output-redis-track-response", false, "If turned on, Redis output replies will be set to all outputs like stdout, file and etc.")
+	/* outputRedisConfig */
+
+	/* outputUDPConfig */
+	flag.Var(&MultiOption{&Settings.OutputUDP}, "output-udp", "Replays datagrams captured with --input-raw-transport udp:\n\tgor --input-raw :8125 --input-raw-transport udp --output-udp staging-statsd:8125")
+	flag.IntVar(&Settings.OutputUDPConfig.Workers, "output-udp-workers", 10, "Number of sockets sending datagrams in parallel.")
+	flag.DurationVar(&Settings.OutputUDPConfig.Timeout, "output-udp-timeout", 5*time.Second, "Specify how long to wait for a response. By default 5s.")
+	flag.BoolVar(&Settings.OutputUDPConfig.TrackResponses, "output-udp-track-response", false, "If turned on, responses to the datagrams will be set to all outputs like stdout, file and etc.")
+	/* outputUDPConfig */
+
 	flag.StringVar(&Settings.OutputKafkaConfig.Host, "output-kafka-host", "", "Read request and response stats from Kafka:\n\tgor --input-raw :8080 --output-kafka-host '192.168.0.1:9092,192.168.0.2:9092'")
 	flag.StringVar(&Settings.OutputKafkaConfig.Topic, "output-kafka-topic", "", "Read request and response stats from Kafka:\n\tgor --input-raw :8080 --output-kafka-topic 'kafka-log'")
 	flag.BoolVar(&Settings.OutputKafkaConfig.UseJSON, "output-kafka-json-format", false, "If turned on, it will serialize messages from GoReplay text format to JSON.")
@@ -252,6 +320,7 @@ func init() {
 	flag.StringVar(&Settings.InputKafkaConfig.SASLConfig.Username, "input-kafka-username", "", "username\n\tgor --input-raw :8080 --output-kafka-username 'username'")
 	flag.StringVar(&Settings.InputKafkaConfig.SASLConfig.Password, "input-kafka-password", "", "password\n\tgor --input-raw :8080 --output-kafka-password 'password'")
 	flag.StringVar(&Settings.InputKafkaConfig.Offset, "input-kafka-offset", "-1", "Specify offset in Kafka partitions start to consume\n\t-1: Starts from newest, -2: Starts from oldest\nAnd supported for showdown or speedup for emitting!\n\tgor --input-kafka-offset \"-2|200%\"")
+	flag.StringVar(&Settings.InputKafkaConfig.Checkpoint, "input-kafka-checkpoint", "", "Write the offset of the last message replayed of every partition to this file every second, the consumers resume from it instead of --input-kafka-offset.")
 
 	flag.StringVar(&Settings.KafkaTLSConfig.CACert, "kafka-tls-ca-cert", "", "CA certificate for Kafka TLS Config:\n\tgor  --input-raw :3000 --output-kafka-host '192.168.0.1:9092' --output-kafka-topic 'topic' --kafka-tls-ca-cert cacert.cer.pem --kafka-tls-client-cert client.cer.pem --kafka-tls-client-key client.key.pem")
 	flag.StringVar(&Settings.KafkaTLSConfig.ClientCert, "kafka-tls-client-cert", "", "Client certificate for Kafka TLS Config (mandatory with to kafka-tls-ca-cert and kafka-tls-client-key)")
@@ -266,6 +335,8 @@ func init() {
 	flag.Var(&Settings.ModifierConfig.URLRewrite, "http-rewrite-url", "Rewrite the request url based on a mapping:\n\tgor --input-raw :8080 --output-http staging.com --http-rewrite-url /v1/user/([^\\/]+)/ping:/v2/user/$1/ping")
 	flag.Var(&Settings.ModifierConfig.HeaderFilters, "http-allow-header", "A regexp to match a specific header against. Requests with non-matching headers will be dropped:\n\t gor --input-raw :8080 --output-http staging.com --http-allow-header api-version:^v1")
 	flag.Var(&Settings.ModifierConfig.HeaderNegativeFilters, "http-disallow-header", "A regexp to match a specific header against. Requests with matching headers will be dropped:\n\t gor --input-raw :8080 --output-http staging.com --http-disallow-header \"User-Agent: Replayed by Gor\"")
+	flag.Var(&Settings.K8sFilters, "k8s-allow", "A regexp to match the pod metadata of captured requests against: src-pod, src-namespace, src-workload, src-label.<name> and their dst- counterparts. Enables --input-raw-k8s-metadata, requests without pod metadata will be dropped:\n\t gor --input-raw :8080 --output-http staging.com --k8s-allow src-namespace:^frontend$")
+	flag.Var(&Settings.K8sNegativeFilters, "k8s-disallow", "A regexp to match the pod metadata of captured requests against. Requests with matching pods will be dropped:\n\t gor --input-raw :8080 --output-http staging.com --k8s-disallow src-workload:^DaemonSet/")
 	flag.Var(&Settings.ModifierConfig.HeaderBasicAuthFilters, "http-basic-auth-filter", "A regexp to match the decoded basic auth string against. Requests with non-matching headers will be dropped:\n\t gor --input-raw :8080 --output-http staging.com --http-basic-auth-filter \"^customer[0-9].*\"")
 	flag.Var(&Settings.ModifierConfig.HeaderHashFilters, "http-header-limiter", "Takes a fraction of requests, consistently taking or rejecting a request based on the FNV32-1A hash of a specific header:\n\t gor --input-raw :8080 --output-http staging.com --http-header-limiter user-id:25%")
 	flag.Var(&Settings.ModifierConfig.ParamHashFilters, "http-param-limiter", "Takes a fraction of requests, consistently taking or rejecting a request based on the FNV32-1A hash of a specific GET param:\n\t gor --input-raw :8080 --output-http staging.com --http-param-limiter user_id:25%")
@@ -0,0 +1,121 @@
+package goreplay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// Spill holds the part of a payload above --copy-buffer-size, large uploads are kept in a temporary file
+// instead of memory. The file is removed as soon as it is created, and closed once the emitter and the outputs
+// which keep the message, see Retain, are done with it. The outputs can read it concurrently until then.
+type Spill struct {
+	file *os.File
+	size int64
+	refs int32
+}
+
+// newSpill creates an empty spill file in --spill-dir, the payload is appended with Write by its producer
+func newSpill() (*Spill, error) {
+	f, err := os.CreateTemp(Settings.SpillDir, "gor-spill-")
+	if err != nil {
+		return nil, err
+	}
+	// the file stays readable through f, the name is not needed anymore
+	os.Remove(f.Name())
+
+	return &Spill{file: f, refs: 1}, nil
+}
+
+// spillChunks writes the chunks of a payload to a new spill file
+func spillChunks(chunks ...[]byte) (*Spill, error) {
+	s, err := newSpill()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range chunks {
+		if _, err = s.Write(c); err != nil {
+			s.Release()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Write appends to the spill file, it is only called by the producer of the payload, before the message is emitted
+func (s *Spill) Write(p []byte) (n int, err error) {
+	n, err = s.file.Write(p)
+	s.size += int64(n)
+	return
+}
+
+// Size returns the number of bytes in the spill file
+func (s *Spill) Size() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.size
+}
+
+// Reader returns a new reader of the spill file, readers are independent of each other
+func (s *Spill) Reader() io.Reader {
+	return io.NewSectionReader(s.file, 0, s.size)
+}
+
+// Retain keeps the spill file open for an output which reads the message after PluginWrite returns,
+// the output calls Release once it is done with it
+func (s *Spill) Retain() {
+	if s != nil {
+		atomic.AddInt32(&s.refs, 1)
+	}
+}
+
+// Release closes the spill file once all the holders of the message are done with it
+func (s *Spill) Release() {
+	if s != nil && atomic.AddInt32(&s.refs, -1) == 0 {
+		s.file.Close()
+	}
+}
+
+// spill moves the part of the payload of msg above limit to a spill file, for the inputs which do not spill their payloads
+func spill(msg *Message, limit int) error {
+	if len(msg.Data) <= limit || msg.Spill != nil {
+		return nil
+	}
+
+	s, err := spillChunks(msg.Data[limit:])
+	if err != nil {
+		return fmt.Errorf("can't spill the payload of %d bytes: %w", len(msg.Data), err)
+	}
+
+	// copied so the large buffer of the input can be collected
+	msg.Data = append([]byte(nil), msg.Data[:limit]...)
+	msg.Spill = s
+	return nil
+}
+
+// Size returns the size of the payload of the message, including the spilled part
+func (msg *Message) Size() int64 {
+	return int64(len(msg.Data)) + msg.Spill.Size()
+}
+
+// Reader returns a reader of the whole payload of the message, including the spilled part
+func (msg *Message) Reader() io.Reader {
+	if msg.Spill == nil {
+		return bytes.NewReader(msg.Data)
+	}
+	return io.MultiReader(bytes.NewReader(msg.Data), msg.Spill.Reader())
+}
+
+// writePayload writes the whole payload of msg to w, and returns the number of bytes written
+func writePayload(w io.Writer, msg *Message) (int, error) {
+	n, err := w.Write(msg.Data)
+	if err != nil || msg.Spill == nil {
+		return n, err
+	}
+
+	nn, err := io.Copy(w, msg.Spill.Reader())
+	return n + int(nn), err
+}
@@ -0,0 +1,151 @@
+package goreplay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSpill(t *testing.T) {
+	bufferSize, spillDir := Settings.CopyBufferSize, Settings.SpillDir
+	defer func() { Settings.CopyBufferSize, Settings.SpillDir = bufferSize, spillDir }()
+	Settings.CopyBufferSize = 64
+	Settings.SpillDir = t.TempDir()
+
+	body := strings.Repeat("0123456789", 1000)
+	request := "POST / HTTP/1.1\r\nHost: www.example.com\r\nContent-Length: 10000\r\n\r\n" + body
+
+	wg := new(sync.WaitGroup)
+	wg.Add(2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer wg.Done()
+		data, _ := io.ReadAll(req.Body)
+		if string(data) != body {
+			t.Errorf("expected the whole body to be replayed, got %d bytes", len(data))
+		}
+	}))
+	defer server.Close()
+
+	var spilled *Spill
+	input := NewTestInput()
+	output := NewTestOutput(func(msg *Message) {
+		defer wg.Done()
+		spilled = msg.Spill
+		if len(msg.Data) != 64 || msg.Spill == nil {
+			t.Errorf("expected the payload to be spilled after 64 bytes, got %d bytes in memory", len(msg.Data))
+		}
+		if msg.Size() != int64(len(request)) {
+			t.Errorf("expected the size %d, got %d", len(request), msg.Size())
+		}
+		var buf bytes.Buffer
+		writePayload(&buf, msg)
+		if buf.String() != request {
+			t.Error("the payload written is not the captured one")
+		}
+		if data, _ := io.ReadAll(msg.Reader()); string(data) != request {
+			t.Error("the payload read is not the captured one")
+		}
+	})
+	httpOutput := NewHTTPOutput(server.URL, &HTTPOutputConfig{})
+
+	plugins := &InOutPlugins{
+		Inputs:  []PluginReader{input},
+		Outputs: []PluginWriter{output, httpOutput},
+	}
+	plugins.All = append(plugins.All, input, output, httpOutput)
+
+	emitter := NewEmitter()
+	go emitter.Start(plugins, Settings.Middleware)
+
+	input.EmitBytes([]byte(request))
+	wg.Wait()
+	emitter.Close()
+
+	// the spill files are removed as soon as they are written
+	if files, _ := os.ReadDir(Settings.SpillDir); len(files) > 0 {
+		t.Errorf("expected no file in the spill directory, got %d", len(files))
+	}
+	// and closed once the outputs are done with them
+	deadline := time.Now().Add(time.Second)
+	for _, err := spilled.file.Stat(); err == nil && time.Now().Before(deadline); _, err = spilled.file.Stat() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := spilled.file.Stat(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected the spill file to be closed, got %v", err)
+	}
+}
+
+func TestSpillRelease(t *testing.T) {
+	s, err := spillChunks([]byte("0123"), []byte("4567"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(s.Reader()); string(data) != "01234567" {
+		t.Errorf("expected the chunks to be spilled, got %q", data)
+	}
+
+	s.Retain()
+	s.Release()
+	if _, err := s.file.Stat(); err != nil {
+		t.Errorf("expected the spill file to be open while it is retained, got %v", err)
+	}
+	s.Release()
+	if _, err := s.file.Stat(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected the spill file to be closed, got %v", err)
+	}
+}
+
+func TestInputFileSpill(t *testing.T) {
+	bufferSize, spillDir := Settings.CopyBufferSize, Settings.SpillDir
+	defer func() { Settings.CopyBufferSize, Settings.SpillDir = bufferSize, spillDir }()
+	Settings.CopyBufferSize = 256
+	Settings.SpillDir = t.TempDir()
+
+	msgs := make([]*Message, 3)
+	for i := range msgs {
+		// the text format can't hold the separator of testRecords
+		body := fmt.Sprintf("POST /%d HTTP/1.1\r\n\r\n%s", i, strings.Repeat("a\n", 500))
+		msgs[i] = &Message{Meta: payloadHeader(RequestPayload, uuid(), int64(1000+i), 0), Data: []byte(body)}
+	}
+	var text bytes.Buffer
+	for _, msg := range msgs {
+		writeTextRecord(&text, msg)
+	}
+	recordings := map[string][]byte{
+		"binary": writeRecording(t, msgs, true),
+		"text":   text.Bytes(),
+	}
+
+	for format, data := range recordings {
+		name := filepath.Join(t.TempDir(), "requests.gor")
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		input := NewFileInput(name, false, 100, 0, false)
+		for i := range msgs {
+			msg, err := input.PluginRead()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Spill == nil || len(msg.Data) > 256 {
+				t.Errorf("%s: expected the payload to be spilled by the reader, got %d bytes in memory", format, len(msg.Data))
+				continue
+			}
+			if payload, _ := io.ReadAll(msg.Reader()); !bytes.Equal(payload, msgs[i].Data) {
+				t.Errorf("%s: expected the payload of record %d, got %q", format, i, payload)
+			}
+			msg.Spill.Release()
+		}
+		input.Close()
+	}
+}